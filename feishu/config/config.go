@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -21,6 +22,7 @@ type Config struct {
 
 	// 服务器配置
 	Port            string
+	PublicURL       string // 服务对外访问地址，用于卡片中的链接
 	ReadTimeout     time.Duration
 	WriteTimeout    time.Duration
 	ShutdownTimeout time.Duration
@@ -34,9 +36,38 @@ type Config struct {
 	IdleConnTimeout     time.Duration
 
 	// Jenkins 配置
-	JenkinsURL   string
-	JenkinsUser  string
-	JenkinsToken string
+	JenkinsURL            string
+	JenkinsUser           string
+	JenkinsToken          string
+	JenkinsInstancesFile  string        // 多 Jenkins 实例配置 JSON 文件，按项目或 Job 前缀路由，未匹配时使用上面的默认实例
+	JenkinsHealthInterval time.Duration // Jenkins 实例健康检查间隔，0 表示不检查
+	JenkinsParamCacheTTL  time.Duration // Job 参数定义的缓存时间，0 表示每次构建都重新获取
+
+	// 发布配置
+	RollbackCandidates  int                      // 回滚时可选的历史版本数量
+	CallbackDedupWindow time.Duration            // 同一操作人重复点击同一按钮的去重窗口
+	CallbackEventTTL    time.Duration            // 卡片回调幂等记录的保留时间，由后台任务定期清理
+	RequestTTL          time.Duration            // 发布卡片的默认有效期，0 表示永不过期
+	ActionTTLs          map[string]time.Duration // 按动作（如 do_official_release）单独配置的有效期
+	ActionRegistryFile  string                   // 动作注册表 JSON 文件，补充或覆盖内置动作
+	CardLocale          string                   // 卡片按钮文案语言，如 zh / en
+
+	// 通知配置
+	ProdEnvironments  []string // 视为生产环境的发布环境，生产构建失败时按下面的开关升级通知
+	FailureMentionAll bool     // 生产构建失败时 @所有人
+	FailureUrgent     bool     // 生产构建失败时对服务负责人发送应用内加急
+
+	// 演练配置
+	DryRun       bool          // 全局演练模式：卡片流程照常执行，Jenkins 构建由模拟替代
+	DryRunDelay  time.Duration // 模拟构建的耗时
+	DryRunResult string        // 模拟构建的结果，如 SUCCESS / FAILURE
+
+	// 请求存储配置
+	RequestCacheTTL        time.Duration // 内存中的请求闲置多久后淘汰（数据库中仍保留）
+	RequestCacheSize       int           // 内存中最多缓存的请求数，超出时淘汰最久未访问的
+	RequestArchiveDays     int           // 已结束或已过期且超过该天数未更新的请求会被归档，默认 0 表示不归档，需运维显式开启
+	RequestArchivePolicy   string        // 归档策略：archive（移入归档表）/ delete（直接删除）
+	RequestArchiveInterval time.Duration // 归档任务的执行间隔
 
 	//mysql 配置
 	mysqlHost     string
@@ -75,6 +106,7 @@ func LoadConfig() (*Config, error) {
 			FeishuAppID:     getEnv("FEISHU_APP_ID", ""),
 			FeishuAppSecret: getEnv("FEISHU_APP_SECRET", ""),
 			Port:            getEnv("PORT", "8080"),
+			PublicURL:       getEnv("PUBLIC_URL", "http://localhost:8080"),
 			LogLevel:        getEnv("LOG_LEVEL", "info"),
 
 			// 超时配置
@@ -92,6 +124,36 @@ func LoadConfig() (*Config, error) {
 			JenkinsUser:  getEnv("JENKINS_USER", "admin"),
 			JenkinsToken: getEnv("JENKINS_TOKEN", ""),
 
+			JenkinsInstancesFile:  getEnv("JENKINS_INSTANCES_FILE", ""),
+			JenkinsHealthInterval: getDurationEnv("JENKINS_HEALTH_INTERVAL", time.Minute),
+			JenkinsParamCacheTTL:  getDurationEnv("JENKINS_PARAM_CACHE_TTL", 5*time.Minute),
+
+			// 发布配置
+			RollbackCandidates:  getIntEnv("ROLLBACK_CANDIDATES", 5),
+			CallbackDedupWindow: getDurationEnv("CALLBACK_DEDUP_WINDOW", 5*time.Second),
+			CallbackEventTTL:    getDurationEnv("CALLBACK_EVENT_TTL", 24*time.Hour),
+			RequestTTL:          getDurationEnv("REQUEST_TTL", 0),
+			ActionTTLs:          getDurationMapEnv("ACTION_TTLS"),
+			ActionRegistryFile:  getEnv("ACTION_REGISTRY_FILE", ""),
+			CardLocale:          getEnv("CARD_LOCALE", "zh"),
+
+			// 通知配置
+			ProdEnvironments:  getListEnv("PROD_ENVIRONMENTS", []string{"prod", "production"}),
+			FailureMentionAll: getEnv("FAILURE_MENTION_ALL", "false") == "true",
+			FailureUrgent:     getEnv("FAILURE_URGENT", "false") == "true",
+
+			// 演练配置
+			DryRun:       getEnv("DRY_RUN", "false") == "true",
+			DryRunDelay:  getDurationEnv("DRY_RUN_DURATION", 10*time.Second),
+			DryRunResult: getEnv("DRY_RUN_RESULT", "SUCCESS"),
+
+			// 请求存储配置
+			RequestCacheTTL:        getDurationEnv("REQUEST_CACHE_TTL", time.Hour),
+			RequestCacheSize:       getIntEnv("REQUEST_CACHE_SIZE", 1000),
+			RequestArchiveDays:     getIntEnv("REQUEST_ARCHIVE_DAYS", 0),
+			RequestArchivePolicy:   getEnv("REQUEST_ARCHIVE_POLICY", "archive"),
+			RequestArchiveInterval: getDurationEnv("REQUEST_ARCHIVE_INTERVAL", time.Hour),
+
 			//mysql 配置
 			mysqlHost:     getEnv("MYSQL_HOST", "localhost"),
 			mysqlPort:     getIntEnv("MYSQL_PORT", 3306),
@@ -180,6 +242,21 @@ func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	return defaultValue
 }
 
+// getDurationMapEnv 获取 "key=秒,key=秒" 格式的时间间隔映射
+func getDurationMapEnv(key string) map[string]time.Duration {
+	result := make(map[string]time.Duration)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || k == "" {
+			continue
+		}
+		if intValue, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+			result[strings.TrimSpace(k)] = time.Duration(intValue) * time.Second
+		}
+	}
+	return result
+}
+
 // DNS 数据库连接字符串
 func (c *Config) DNS() string {
 	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
@@ -205,3 +282,17 @@ func (c *Config) GetDB() *gorm.DB {
 
 	return c.db
 }
+
+// getListEnv 获取逗号分隔的列表，未设置时返回默认值
+func getListEnv(key string, defaultValue []string) []string {
+	var result []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	if len(result) == 0 {
+		return defaultValue
+	}
+	return result
+}
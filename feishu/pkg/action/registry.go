@@ -0,0 +1,283 @@
+package action
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 内置动作名
+const (
+	Gray     = "gray"
+	Official = "official"
+	Rollback = "rollback"
+	Restart  = "restart"
+	Check    = "check"
+)
+
+// DefaultLocale 未配置或找不到对应语言时使用的文案语言
+const DefaultLocale = "zh"
+
+// Definition 描述卡片上的一个动作：按钮展示、回调值以及触发的 Jenkins 参数
+type Definition struct {
+	Name       string            `json:"name"`                 // 规范名，服务 actions 中使用，如 gray
+	Aliases    []string          `json:"aliases,omitempty"`    // 别名，如 灰度
+	Value      string            `json:"value"`                // 按钮回调值，如 do_gray_release
+	Labels     map[string]string `json:"labels"`               // 按语言的按钮文字
+	Style      string            `json:"style,omitempty"`      // 按钮样式：primary / danger / default
+	Confirm    map[string]string `json:"confirm,omitempty"`    // 按语言的确认框标题
+	Params     map[string]string `json:"params,omitempty"`     // 触发 Jenkins 构建时的参数，为空表示不触发构建
+	Repeatable bool              `json:"repeatable,omitempty"` // 是否允许重复点击
+	Disables   []string          `json:"disables,omitempty"`   // 点击后同时禁用的其他动作（回调值）
+	Hidden     bool              `json:"hidden,omitempty"`     // 不在卡片上展示
+	Always     bool              `json:"always,omitempty"`     // 服务未配置时也展示
+	// RequireReason 触发前必须在卡片表单中填写原因（可附带事故单号）
+	RequireReason bool `json:"require_reason,omitempty"`
+}
+
+// Label 返回按钮文字
+func (d *Definition) Label(locale string) string {
+	if label := d.Labels[locale]; label != "" {
+		return label
+	}
+	if label := d.Labels[DefaultLocale]; label != "" {
+		return label
+	}
+	return d.Name
+}
+
+// ConfirmText 返回确认框标题
+func (d *Definition) ConfirmText(locale string) string {
+	if text := d.Confirm[locale]; text != "" {
+		return text
+	}
+	if text := d.Confirm[DefaultLocale]; text != "" {
+		return text
+	}
+	return "是否确认？"
+}
+
+// DeployType 返回动作对应的 DEPLOY_TYPE 参数
+func (d *Definition) DeployType() string {
+	return d.Params["DEPLOY_TYPE"]
+}
+
+// TriggersBuild 点击后是否触发 Jenkins 构建
+func (d *Definition) TriggersBuild() bool {
+	return len(d.Params) > 0
+}
+
+// Registry 动作注册表，按注册顺序保存
+type Registry struct {
+	mu      sync.RWMutex
+	defs    map[string]*Definition // key: Name
+	aliases map[string]string      // key: 小写的名称或别名
+	values  map[string]string      // key: Value
+	order   []string
+}
+
+// Default 全局动作注册表，包含内置动作，可通过配置文件或数据库覆盖和扩展
+var Default = NewRegistry()
+
+// NewRegistry 创建包含内置动作的注册表
+func NewRegistry() *Registry {
+	r := &Registry{
+		defs:    make(map[string]*Definition),
+		aliases: make(map[string]string),
+		values:  make(map[string]string),
+	}
+	for _, def := range builtins() {
+		if err := r.Register(def); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+func builtins() []Definition {
+	return []Definition{
+		{
+			Name: Gray, Aliases: []string{"灰度"}, Value: "do_gray_release",
+			Labels: map[string]string{"zh": "🚀 灰度", "en": "🚀 Gray"}, Style: "primary",
+			Params: map[string]string{"DEPLOY_TYPE": "Gray"}, Repeatable: true,
+		},
+		{
+			Name: Official, Aliases: []string{"release", "正式"}, Value: "do_official_release",
+			Labels: map[string]string{"zh": "🎉 正式", "en": "🎉 Release"}, Style: "danger",
+			Params: map[string]string{"DEPLOY_TYPE": "Deploy"}, Repeatable: true,
+		},
+		{
+			Name: Rollback, Aliases: []string{"回滚"}, Value: "do_rollback",
+			Labels: map[string]string{"zh": "🔙 回滚", "en": "🔙 Rollback"}, Style: "danger",
+			Params: map[string]string{"DEPLOY_TYPE": "Rollback"}, Always: true, RequireReason: true,
+		},
+		{
+			Name: Restart, Aliases: []string{"重启"}, Value: "do_restart",
+			Labels: map[string]string{"zh": "🔄 重启", "en": "🔄 Restart"}, Style: "primary",
+			Params: map[string]string{"DEPLOY_TYPE": "Restart"}, Repeatable: true, Always: true, RequireReason: true,
+		},
+		{
+			Name: Check, Aliases: []string{"验收"}, Value: "do_check",
+			Labels: map[string]string{"zh": "✅ 验收", "en": "✅ Check"}, Style: "primary",
+			Hidden: true,
+		},
+	}
+}
+
+// Register 注册动作，同名动作会被覆盖；回调值已被其他动作使用时返回错误
+func (r *Registry) Register(def Definition) error {
+	def.Name = strings.TrimSpace(def.Name)
+	if def.Name == "" {
+		return fmt.Errorf("action name is required")
+	}
+	if def.Value == "" {
+		def.Value = "do_" + def.Name
+	}
+	if def.Style == "" {
+		def.Style = "primary"
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if owner, ok := r.values[def.Value]; ok && owner != def.Name {
+		return fmt.Errorf("action %s: value %s is already used by action %s", def.Name, def.Value, owner)
+	}
+	if old, ok := r.defs[def.Name]; ok {
+		for _, alias := range old.Aliases {
+			delete(r.aliases, strings.ToLower(alias))
+		}
+		delete(r.values, old.Value)
+	} else {
+		r.order = append(r.order, def.Name)
+	}
+
+	r.defs[def.Name] = &def
+	r.aliases[strings.ToLower(def.Name)] = def.Name
+	for _, alias := range def.Aliases {
+		r.aliases[strings.ToLower(alias)] = def.Name
+	}
+	r.values[def.Value] = def.Name
+	return nil
+}
+
+// Lookup 按名称或别名（不区分大小写）查找动作
+func (r *Registry) Lookup(name string) (*Definition, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	def, ok := r.defs[r.aliases[strings.ToLower(strings.TrimSpace(name))]]
+	return def, ok
+}
+
+// ByValue 按按钮回调值查找动作
+func (r *Registry) ByValue(value string) (*Definition, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	def, ok := r.defs[r.values[value]]
+	return def, ok
+}
+
+// Is 判断名称或别名是否指向指定动作
+func (r *Registry) Is(name, canonical string) bool {
+	def, ok := r.Lookup(name)
+	return ok && def.Name == canonical
+}
+
+// ValueOf 返回动作的按钮回调值，未注册时为 do_<name>
+func (r *Registry) ValueOf(name string) string {
+	if def, ok := r.Lookup(name); ok {
+		return def.Value
+	}
+	return "do_" + name
+}
+
+// DeployTypeOf 返回动作的 DEPLOY_TYPE，未注册时为空
+func (r *Registry) DeployTypeOf(name string) string {
+	if def, ok := r.Lookup(name); ok {
+		return def.DeployType()
+	}
+	return ""
+}
+
+// All 按注册顺序返回全部动作
+func (r *Registry) All() []*Definition {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	defs := make([]*Definition, 0, len(r.order))
+	for _, name := range r.order {
+		defs = append(defs, r.defs[name])
+	}
+	return defs
+}
+
+// LoadFile 从 JSON 文件（动作定义数组）加载动作，路径为空时忽略
+func (r *Registry) LoadFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var defs []Definition
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, def := range defs {
+		if err := r.Register(def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ActionModel 数据库中的动作定义，Data 为 Definition 的 JSON
+type ActionModel struct {
+	Name      string `gorm:"primaryKey;size:64"`
+	Data      string `gorm:"type:text"`
+	Del       int    `gorm:"default:0"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (ActionModel) TableName() string {
+	return "feishu_actions"
+}
+
+// LoadFromDB 从 feishu_actions 表加载动作，表不存在时自动创建
+func (r *Registry) LoadFromDB(db *gorm.DB) error {
+	if db == nil {
+		return nil
+	}
+	if !db.Migrator().HasTable(&ActionModel{}) {
+		if err := db.AutoMigrate(&ActionModel{}); err != nil {
+			return err
+		}
+	}
+
+	var models []ActionModel
+	if err := db.Where("del = ?", 0).Order("name").Find(&models).Error; err != nil {
+		return err
+	}
+	for _, m := range models {
+		var def Definition
+		if err := json.Unmarshal([]byte(m.Data), &def); err != nil {
+			return fmt.Errorf("parse action %s: %w", m.Name, err)
+		}
+		if def.Name == "" {
+			def.Name = m.Name
+		}
+		if err := r.Register(def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package action
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+
+	t.Run("builtin aliases", func(t *testing.T) {
+		for _, name := range []string{"gray", "GRAY", "灰度"} {
+			if !r.Is(name, Gray) {
+				t.Errorf("%s should resolve to gray", name)
+			}
+		}
+		if !r.Is("release", Official) || !r.Is("正式", Official) {
+			t.Error("release/正式 should resolve to official")
+		}
+		def, ok := r.ByValue("do_restart")
+		if !ok || def.DeployType() != "Restart" || !def.Repeatable {
+			t.Errorf("Unexpected restart definition: %+v", def)
+		}
+		if r.ValueOf("unknown") != "do_unknown" {
+			t.Error("Unregistered action should fall back to do_<name>")
+		}
+	})
+
+	t.Run("load from file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "actions.json")
+		data := `[
+			{"name": "scale", "aliases": ["扩容"], "labels": {"zh": "📈 扩容", "en": "📈 Scale"},
+			 "params": {"DEPLOY_TYPE": "Scale", "REPLICAS": "4"}, "disables": ["do_restart"]},
+			{"name": "gray", "aliases": ["灰度"], "value": "do_gray_release", "labels": {"zh": "🐤 灰度"},
+			 "params": {"DEPLOY_TYPE": "Canary"}, "repeatable": true}
+		]`
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.LoadFile(path); err != nil {
+			t.Fatalf("LoadFile failed: %v", err)
+		}
+
+		def, ok := r.Lookup("扩容")
+		if !ok || def.Value != "do_scale" || def.Style != "primary" || def.Label("en") != "📈 Scale" {
+			t.Errorf("Unexpected scale definition: %+v", def)
+		}
+		if r.DeployTypeOf("灰度") != "Canary" {
+			t.Error("Builtin gray should be overridden by file")
+		}
+		if def.Label("fr") != "📈 扩容" {
+			t.Error("Unknown locale should fall back to zh")
+		}
+	})
+
+	t.Run("duplicate value", func(t *testing.T) {
+		if err := r.Register(Definition{Name: "deploy", Value: "do_official_release"}); err == nil {
+			t.Fatal("Expected error when value is used by another action")
+		}
+		if def, ok := r.ByValue("do_official_release"); !ok || def.Name != Official {
+			t.Errorf("Existing action should be kept, got %+v", def)
+		}
+		// 同名动作可以修改回调值
+		if err := r.Register(Definition{Name: "scale", Value: "do_scale_out"}); err != nil {
+			t.Errorf("Re-registering with a new value failed: %v", err)
+		}
+		if _, ok := r.ByValue("do_scale"); ok {
+			t.Error("Old value should be released")
+		}
+	})
+}
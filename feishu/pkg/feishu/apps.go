@@ -0,0 +1,133 @@
+package feishu
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"devops/feishu/config"
+	"devops/feishu/pkg/robot"
+
+	"gorm.io/gorm"
+)
+
+// App 描述一个飞书应用（来自 feishu_robots 表）
+type App struct {
+	Name              string
+	Project           string
+	AppID             string
+	AppSecret         string
+	EncryptKey        string
+	VerificationToken string
+	Client            *Client
+}
+
+// AppRegistry 按项目管理多个飞书应用，每个 AppID 只持有一个客户端（独立的 token 缓存）
+type AppRegistry struct {
+	mu       sync.RWMutex
+	apps     map[string]*App // key: AppID
+	projects map[string]string
+}
+
+// Apps 全局飞书应用注册表
+var Apps = NewAppRegistry()
+
+// NewAppRegistry 创建空的应用注册表
+func NewAppRegistry() *AppRegistry {
+	return &AppRegistry{
+		apps:     make(map[string]*App),
+		projects: make(map[string]string),
+	}
+}
+
+// Register 注册应用，同一 AppID 复用已有客户端，项目映射以先注册者为准
+func (r *AppRegistry) Register(cfg *config.Config, app *App) error {
+	if app == nil || app.AppID == "" || app.AppSecret == "" {
+		return fmt.Errorf("app_id and app_secret are required")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.apps[app.AppID]
+	if !ok {
+		if app.Client == nil {
+			app.Client = NewClientForApp(cfg, app.AppID, app.AppSecret)
+		}
+		r.apps[app.AppID] = app
+		existing = app
+	}
+
+	if app.Project != "" {
+		if _, taken := r.projects[app.Project]; !taken {
+			r.projects[app.Project] = existing.AppID
+		}
+	}
+	return nil
+}
+
+// Client 返回项目对应的飞书客户端，未配置时返回 nil
+func (r *AppRegistry) Client(project string) *Client {
+	if project == "" {
+		return nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	appID, ok := r.projects[project]
+	if !ok {
+		return nil
+	}
+	if app, ok := r.apps[appID]; ok {
+		return app.Client
+	}
+	return nil
+}
+
+// List 返回所有已注册的应用（按 AppID 排序）
+func (r *AppRegistry) List() []*App {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]*App, 0, len(r.apps))
+	for _, app := range r.apps {
+		list = append(list, app)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].AppID < list[j].AppID })
+	return list
+}
+
+// LoadFromDB 从 feishu_robots 表加载配置了 AppID/AppSecret 的机器人
+// 默认应用（FEISHU_APP_ID）不在此注册，由调用方单独处理
+func (r *AppRegistry) LoadFromDB(cfg *config.Config, db *gorm.DB) error {
+	if db == nil {
+		return fmt.Errorf("database connection is nil")
+	}
+	if !db.Migrator().HasTable(&robot.CreateFeishuRobotRequest{}) {
+		return nil
+	}
+
+	var robots []robot.CreateFeishuRobotRequest
+	if err := db.Where("del = ? AND app_id <> '' AND app_secret <> ''", 0).
+		Order("id asc").Find(&robots).Error; err != nil {
+		return err
+	}
+
+	for _, ro := range robots {
+		if ro.AppID == cfg.FeishuAppID {
+			continue
+		}
+		if err := r.Register(cfg, &App{
+			Name:              ro.Name,
+			Project:           ro.Project,
+			AppID:             ro.AppID,
+			AppSecret:         ro.AppSecret,
+			EncryptKey:        ro.EncryptKey,
+			VerificationToken: ro.VerificationToken,
+		}); err != nil {
+			return fmt.Errorf("register robot %s: %w", ro.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package feishu
+
+import (
+	cfg "devops/feishu/config"
+	"testing"
+)
+
+func TestAppRegistry_RouteByProject(t *testing.T) {
+	c := &cfg.Config{FeishuAppID: "cli_default", FeishuAppSecret: "secret", LogLevel: "debug"}
+	r := NewAppRegistry()
+
+	if err := r.Register(c, &App{Name: "java-bot", Project: "java", AppID: "cli_java", AppSecret: "s1"}); err != nil {
+		t.Fatalf("register java app: %v", err)
+	}
+	// 同一个 AppID 的第二个机器人复用客户端，只新增项目映射
+	if err := r.Register(c, &App{Name: "java-bot-2", Project: "java-ops", AppID: "cli_java", AppSecret: "s1"}); err != nil {
+		t.Fatalf("register java-ops app: %v", err)
+	}
+	if err := r.Register(c, &App{Name: "web-bot", Project: "web", AppID: "cli_web", AppSecret: "s2"}); err != nil {
+		t.Fatalf("register web app: %v", err)
+	}
+
+	if got := len(r.List()); got != 2 {
+		t.Fatalf("expected 2 distinct apps, got %d", got)
+	}
+
+	java := r.Client("java")
+	if java == nil || java.AppID() != "cli_java" {
+		t.Fatalf("expected java project to route to cli_java, got %v", java)
+	}
+	if r.Client("java-ops") != java {
+		t.Error("projects sharing an app should share the same client")
+	}
+	if web := r.Client("web"); web == nil || web.AppID() != "cli_web" {
+		t.Errorf("expected web project to route to cli_web, got %v", web)
+	}
+	if r.Client("unknown") != nil || r.Client("") != nil {
+		t.Error("unknown or empty project should not resolve to a client")
+	}
+
+	if err := r.Register(c, &App{Project: "bad"}); err == nil {
+		t.Error("expected error when app_id/app_secret missing")
+	}
+}
@@ -20,12 +20,22 @@ func SetCardActionHandler(h func(context.Context, *callback.CardActionTriggerEve
 	cardActionHandler = h
 }
 
+// RegisterCallback 为默认应用及注册表中的每个飞书应用各建立一条长连接
+// 默认应用的连接在当前 goroutine 中阻塞运行
 func RegisterCallback(cfg *config.Config) {
+	for _, app := range Apps.List() {
+		go startCallback(cfg, app.AppID, app.AppSecret, app.VerificationToken, app.EncryptKey)
+	}
+	startCallback(cfg, cfg.FeishuAppID, cfg.FeishuAppSecret, "", "")
+}
+
+// startCallback 为单个飞书应用建立长连接并注册事件处理
+func startCallback(cfg *config.Config, appID, appSecret, verificationToken, encryptKey string) {
 	// 初始化日志
 	logger := log.NewLogger(cfg.LogLevel)
 
 	// 注册回调
-	eventHandler := dispatcher.NewEventDispatcher("", "").
+	eventHandler := dispatcher.NewEventDispatcher(verificationToken, encryptKey).
 
 		// 监听「卡片回传交互 card.action.trigger」
 		OnP2CardActionTrigger(func(ctx context.Context, event *callback.CardActionTriggerEvent) (*callback.CardActionTriggerResponse, error) {
@@ -54,13 +64,13 @@ func RegisterCallback(cfg *config.Config) {
 			return nil
 		})
 	// 创建Client
-	cli := larkws.NewClient(cfg.FeishuAppID, cfg.FeishuAppSecret,
+	cli := larkws.NewClient(appID, appSecret,
 		larkws.WithEventHandler(eventHandler),
 		larkws.WithLogLevel(larkcore.LogLevelDebug),
 	)
 	// 建立长连接
 	err := cli.Start(context.Background())
 	if err != nil {
-		logger.Error("Failed to start Feishu WebSocket client: %v", err)
+		logger.Error("Failed to start Feishu WebSocket client for app %s: %v", appID, err)
 	}
 }
@@ -26,8 +26,13 @@ type Client struct {
 	mu            sync.RWMutex
 }
 
-// NewClient 创建新的飞书客户端
+// NewClient 创建新的飞书客户端（使用默认应用 FEISHU_APP_ID）
 func NewClient(cfg *config.Config) *Client {
+	return NewClientForApp(cfg, cfg.FeishuAppID, cfg.FeishuAppSecret)
+}
+
+// NewClientForApp 为指定飞书应用创建客户端，每个应用独立缓存 tenant_access_token
+func NewClientForApp(cfg *config.Config, appID, appSecret string) *Client {
 	log := logger.NewLogger(cfg.LogLevel)
 
 	httpClient := &http.Client{
@@ -39,11 +44,11 @@ func NewClient(cfg *config.Config) *Client {
 		},
 	}
 
-	log.Info("Feishu client initialized")
+	log.Info("Feishu client initialized, app_id: %s", appID)
 
 	return &Client{
-		appID:      cfg.FeishuAppID,
-		appSecret:  cfg.FeishuAppSecret,
+		appID:      appID,
+		appSecret:  appSecret,
 		logger:     log,
 		httpClient: httpClient,
 	}
@@ -177,13 +182,19 @@ func (c *Client) CreateCard(ctx context.Context, title, content string) (string,
 
 // SendMessage 发送消息（使用飞书应用真实API）
 func (c *Client) SendMessage(ctx context.Context, receiveID, receiveIdType, msgType, content string) error {
+	_, err := c.SendMessageWithID(ctx, receiveID, receiveIdType, msgType, content)
+	return err
+}
+
+// SendMessageWithID 发送消息并返回消息 ID，用于后续加急等操作
+func (c *Client) SendMessageWithID(ctx context.Context, receiveID, receiveIdType, msgType, content string) (string, error) {
 	c.logger.Debug("Sending message to %s, type: %s", receiveID, msgType)
 
 	// 获取tenant_access_token
 	token, err := c.getTenantAccessToken(ctx)
 	if err != nil {
 		c.logger.Error("Failed to get tenant access token: %v", err)
-		return fmt.Errorf("failed to get tenant access token: %w", err)
+		return "", fmt.Errorf("failed to get tenant access token: %w", err)
 	}
 
 	// 飞书发送消息API（receive_id_type 需作为查询参数）
@@ -207,14 +218,14 @@ func (c *Client) SendMessage(ctx context.Context, receiveID, receiveIdType, msgT
 
 	default:
 		c.logger.Error("Unsupported message type: %s", msgType)
-		return fmt.Errorf("unsupported message type: %s", msgType)
+		return "", fmt.Errorf("unsupported message type: %s", msgType)
 	}
 
 	// 序列化请求体
 	payloadData, err := json.Marshal(messagePayload)
 	if err != nil {
 		c.logger.Error("Failed to marshal message payload: %v", err)
-		return fmt.Errorf("failed to marshal message payload: %w", err)
+		return "", fmt.Errorf("failed to marshal message payload: %w", err)
 	}
 
 	c.logger.Debug("Message payload: %s", string(payloadData))
@@ -224,7 +235,7 @@ func (c *Client) SendMessage(ctx context.Context, receiveID, receiveIdType, msgT
 	req, err := http.NewRequestWithContext(ctx, "POST", sendURL, bytes.NewBuffer(payloadData))
 	if err != nil {
 		c.logger.Error("Failed to create message request: %v", err)
-		return fmt.Errorf("failed to create message request: %w", err)
+		return "", fmt.Errorf("failed to create message request: %w", err)
 	}
 
 	// 设置请求头
@@ -235,7 +246,7 @@ func (c *Client) SendMessage(ctx context.Context, receiveID, receiveIdType, msgT
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		c.logger.Error("Failed to send message request: %v", err)
-		return fmt.Errorf("failed to send message request: %w", err)
+		return "", fmt.Errorf("failed to send message request: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -243,40 +254,87 @@ func (c *Client) SendMessage(ctx context.Context, receiveID, receiveIdType, msgT
 	var response map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
 		c.logger.Error("Failed to decode message response: %v", err)
-		return fmt.Errorf("failed to decode message response: %w", err)
+		return "", fmt.Errorf("failed to decode message response: %w", err)
 	}
 
 	// 检查HTTP状态码
 	if resp.StatusCode != http.StatusOK {
 		c.logger.Error("Message send failed: status=%d, response=%v", resp.StatusCode, response)
-		return fmt.Errorf("message send failed: status=%d, response=%v", resp.StatusCode, response)
+		return "", fmt.Errorf("message send failed: status=%d, response=%v", resp.StatusCode, response)
 	}
 
 	// 检查业务错误码
 	if code, ok := response["code"].(float64); ok && code != 0 {
 		msg, _ := response["msg"].(string)
 		c.logger.Error("Message API error: code=%v, msg=%s", code, msg)
-		return fmt.Errorf("message API error: code=%v, msg=%s", code, msg)
+		return "", fmt.Errorf("message API error: code=%v, msg=%s", code, msg)
 	}
 
 	// 提取message_id
 	data, ok := response["data"].(map[string]interface{})
 	if !ok {
 		c.logger.Error("Invalid response data format: %v", response)
-		return fmt.Errorf("invalid response data format")
+		return "", fmt.Errorf("invalid response data format")
 	}
 
 	messageID, ok := data["message_id"].(string)
 	if !ok {
 		c.logger.Error("Message ID not found in response: %v", data)
-		return fmt.Errorf("message ID not found in response")
+		return "", fmt.Errorf("message ID not found in response")
 	}
 
 	c.logger.Info("Message sent successfully, message_id: %s", messageID)
 
+	return messageID, nil
+}
+
+// UrgentApp 对已发送的消息发起应用内加急，userIDType 为 open_id / user_id / union_id
+func (c *Client) UrgentApp(ctx context.Context, messageID, userIDType string, userIDs []string) error {
+	token, err := c.getTenantAccessToken(ctx)
+	if err != nil {
+		c.logger.Error("Failed to get tenant access token: %v", err)
+		return fmt.Errorf("failed to get tenant access token: %w", err)
+	}
+
+	urgentURL := fmt.Sprintf("https://open.feishu.cn/open-apis/im/v1/messages/%s/urgent_app?user_id_type=%s", messageID, userIDType)
+	payloadData, err := json.Marshal(map[string]interface{}{"user_id_list": userIDs})
+	if err != nil {
+		return fmt.Errorf("failed to marshal urgent payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "PATCH", urgentURL, bytes.NewBuffer(payloadData))
+	if err != nil {
+		return fmt.Errorf("failed to create urgent request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		c.logger.Error("Failed to send urgent request: %v", err)
+		return fmt.Errorf("failed to send urgent request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var response map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("failed to decode urgent response: %w", err)
+	}
+	if code, ok := response["code"].(float64); resp.StatusCode != http.StatusOK || (ok && code != 0) {
+		msg, _ := response["msg"].(string)
+		c.logger.Error("Urgent API error: status=%d, code=%v, msg=%s", resp.StatusCode, response["code"], msg)
+		return fmt.Errorf("urgent API error: status=%d, code=%v, msg=%s", resp.StatusCode, response["code"], msg)
+	}
+
+	c.logger.Info("Urgent notification sent, message_id: %s, users: %v", messageID, userIDs)
 	return nil
 }
 
+// AppID 返回客户端所属的飞书应用 ID
+func (c *Client) AppID() string {
+	return c.appID
+}
+
 // GetLogger 获取日志记录器
 func (c *Client) GetLogger() *logger.Logger {
 	return c.logger
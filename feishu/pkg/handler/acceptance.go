@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"devops/feishu/pkg/action"
+
+	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher/callback"
+)
+
+// 验收表单提交的结果
+const (
+	acceptPass   = "pass"
+	acceptReject = "reject"
+)
+
+// requiresAcceptance 服务是否配置了验收动作
+func requiresAcceptance(svc Service) bool {
+	for _, a := range svc.Actions {
+		if action.Default.Is(a, action.Check) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptanceBlocks 服务需要验收且尚未验收通过时返回 true，此时不允许正式发布
+func acceptanceBlocks(svc Service) bool {
+	return requiresAcceptance(svc) && (svc.Acceptance == nil || svc.Acceptance.Status != AcceptancePassed)
+}
+
+// testersFor 返回服务的验收人，服务未配置时使用卡片的验收人
+func testersFor(req GrayCardRequest, svc Service) []string {
+	if len(svc.Testers) > 0 {
+		return svc.Testers
+	}
+	return req.Testers
+}
+
+// startAcceptance 灰度成功后将需要验收的服务置为待验收
+// 分阶段灰度只有最后一个阶段成功后才进入验收；重新灰度会清除上一次的验收结果
+func startAcceptance(ctx context.Context, requestID, serviceName string) {
+	reqData, ok := GlobalStore.Get(requestID)
+	if !ok {
+		return
+	}
+	svc := findService(reqData, serviceName)
+	if svc == nil || !requiresAcceptance(*svc) {
+		return
+	}
+	if len(svc.GrayPhases) > 0 && svc.GrayPhase < len(svc.GrayPhases) {
+		return
+	}
+
+	GlobalStore.SetAcceptance(requestID, serviceName, Acceptance{Status: AcceptancePending})
+	notifyBatch(ctx, requestID, fmt.Sprintf("🧪 灰度成功，等待验收: %s\n验收通过后才能正式发布", serviceName))
+}
+
+// submitAcceptance 处理验收表单：验收通过后开放正式发布，不通过时必须填写说明
+// 拒绝时第二个返回值为写入审计记录的拒绝原因
+func submitAcceptance(requestID, serviceName, result, comment, operator string) (*callback.CardActionTriggerResponse, string) {
+	reqData, ok := GlobalStore.Get(requestID)
+	if !ok {
+		return toast("请求数据已过期或不存在"), "request not found"
+	}
+	svc := findService(reqData, serviceName)
+	if svc == nil || !requiresAcceptance(*svc) {
+		return toast("该服务无需验收"), "acceptance not required"
+	}
+	if svc.Acceptance == nil || svc.Acceptance.Status != AcceptancePending {
+		return refreshCard(requestID, "当前不在待验收状态"), "acceptance not pending"
+	}
+
+	if testers := testersFor(reqData.OriginalRequest, *svc); len(testers) > 0 {
+		allowed := false
+		for _, t := range testers {
+			if t == operator {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return toast("仅指定的验收人可以验收"), "not a tester"
+		}
+	}
+
+	comment = strings.TrimSpace(comment)
+	acceptance := Acceptance{Comment: comment, Operator: operator, At: time.Now().Unix()}
+	switch result {
+	case acceptPass:
+		acceptance.Status = AcceptancePassed
+	case acceptReject:
+		if comment == "" {
+			return toast("验收不通过时请填写说明"), "comment required"
+		}
+		acceptance.Status = AcceptanceRejected
+	default:
+		return toast("无效的验收结果"), "invalid acceptance result"
+	}
+	GlobalStore.SetAcceptance(requestID, serviceName, acceptance)
+
+	fmt.Printf("Acceptance %s: %s %s by %s\n", acceptance.Status, requestID, serviceName, operator)
+	if acceptance.Status == AcceptancePassed {
+		return refreshCard(requestID, "验收通过，已开放正式发布"), ""
+	}
+	return refreshCard(requestID, "已记录验收不通过"), ""
+}
+
+// acceptanceDisplay 返回服务验收状态的展示文本
+func acceptanceDisplay(svc Service) string {
+	a := svc.Acceptance
+	if a == nil {
+		return "灰度成功后进行验收"
+	}
+
+	var text string
+	switch a.Status {
+	case AcceptancePending:
+		return "⏳ 待验收"
+	case AcceptancePassed:
+		text = "✅ 验收通过"
+	default:
+		text = "❌ 验收不通过"
+	}
+	if a.Operator != "" {
+		text += fmt.Sprintf("（<at id=%s></at> %s）", a.Operator, time.Unix(a.At, 0).Format("01-02 15:04"))
+	}
+	if a.Comment != "" {
+		text += "\n💬 " + a.Comment
+	}
+	return text
+}
+
+// buildAcceptanceSection 构建服务的验收区：状态行，待验收时附带说明输入框和通过/不通过按钮
+func buildAcceptanceSection(svc Service, requestID string) []interface{} {
+	elements := []interface{}{
+		map[string]interface{}{
+			"tag": "div",
+			"text": map[string]interface{}{
+				"tag":     "lark_md",
+				"content": fmt.Sprintf("🧪 **验收：** %s", acceptanceDisplay(svc)),
+			},
+		},
+	}
+	if svc.Acceptance == nil || svc.Acceptance.Status != AcceptancePending {
+		return elements
+	}
+
+	checkValue := action.Default.ValueOf(action.Check)
+	button := func(text, btnType, result string) map[string]interface{} {
+		return map[string]interface{}{
+			"tag": "button",
+			"text": map[string]interface{}{
+				"tag":     "plain_text",
+				"content": text,
+			},
+			"type":        btnType,
+			"action_type": "form_submit",
+			"name":        "acceptance_" + result,
+			"value": map[string]interface{}{
+				"action":     checkValue,
+				"service":    svc.Name,
+				"request_id": requestID,
+				"result":     result,
+			},
+		}
+	}
+
+	return append(elements, map[string]interface{}{
+		"tag":  "form",
+		"name": "acceptance_" + svc.Name,
+		"elements": []interface{}{
+			map[string]interface{}{
+				"tag":  "input",
+				"name": "comment",
+				"placeholder": map[string]interface{}{
+					"tag":     "plain_text",
+					"content": "验收说明（不通过时必填）",
+				},
+			},
+			button("✅ 验收通过", "primary", acceptPass),
+			button("❌ 验收不通过", "danger", acceptReject),
+		},
+	})
+}
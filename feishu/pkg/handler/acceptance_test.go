@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher/callback"
+)
+
+// findAcceptanceForm 返回卡片中的验收表单
+func findAcceptanceForm(card map[string]interface{}) map[string]interface{} {
+	elements, _ := card["elements"].([]interface{})
+	for _, el := range elements {
+		if eMap, _ := el.(map[string]interface{}); eMap["tag"] == "form" {
+			return eMap
+		}
+	}
+	return nil
+}
+
+func TestAcceptance(t *testing.T) {
+	InitCallbackHandler(nil)
+
+	reqID := fmt.Sprintf("test-req-acceptance-%d", time.Now().UnixNano())
+	GlobalStore.Save(reqID, GrayCardRequest{
+		Testers: []string{"ou_qa"},
+		Services: []Service{
+			{Name: "svc", ObjectID: "proj", Branches: []string{"master"}, Actions: []string{"check", "gray", "official"}},
+		},
+	})
+
+	click := func(actionName, operator string, value map[string]interface{}, comment string) *callback.CardActionTriggerResponse {
+		v := map[string]interface{}{"request_id": reqID, "service": "svc", "action": actionName, "branch": "master"}
+		for k, val := range value {
+			v[k] = val
+		}
+		resp, _ := handleCardAction(context.Background(), &callback.CardActionTriggerEvent{
+			Event: &callback.CardActionTriggerRequest{
+				Operator: &callback.Operator{OpenID: operator},
+				Action: &callback.CallBackAction{
+					Value:     v,
+					FormValue: map[string]interface{}{"comment": comment},
+				},
+			},
+		})
+		return resp
+	}
+	card := func() map[string]interface{} {
+		storedReq, _ := GlobalStore.Get(reqID)
+		return renderStoredCard(reqID, storedReq)
+	}
+
+	t.Run("official blocked before acceptance", func(t *testing.T) {
+		if findButton(card(), "do_official_release") != nil {
+			t.Error("Official button should be hidden before acceptance")
+		}
+		if findAcceptanceForm(card()) != nil {
+			t.Error("Acceptance form should not be shown before gray succeeds")
+		}
+		resp := click("do_official_release", "ou_dev", nil, "")
+		if resp.Toast.Content != "验收通过后才能正式发布" {
+			t.Errorf("Expected official release to be refused, got %+v", resp.Toast)
+		}
+		if resp := click("do_check", "ou_qa", map[string]interface{}{"result": acceptPass}, ""); resp.Toast.Content != "当前不在待验收状态" {
+			t.Errorf("Expected acceptance to be refused before gray, got %+v", resp.Toast)
+		}
+	})
+
+	t.Run("reject requires comment and tester", func(t *testing.T) {
+		startAcceptance(context.Background(), reqID, "svc")
+		if findAcceptanceForm(card()) == nil {
+			t.Fatal("Acceptance form should be shown after gray succeeds")
+		}
+		if resp := click("do_check", "ou_dev", map[string]interface{}{"result": acceptPass}, ""); resp.Toast.Content != "仅指定的验收人可以验收" {
+			t.Errorf("Expected non-tester to be refused, got %+v", resp.Toast)
+		}
+		if resp := click("do_check", "ou_qa", map[string]interface{}{"result": acceptReject}, " "); resp.Toast.Content != "验收不通过时请填写说明" {
+			t.Errorf("Expected comment to be required, got %+v", resp.Toast)
+		}
+		click("do_check", "ou_qa", map[string]interface{}{"result": acceptReject}, "登录页报错")
+
+		storedReq, _ := GlobalStore.Get(reqID)
+		a := storedReq.OriginalRequest.Services[0].Acceptance
+		if a == nil || a.Status != AcceptanceRejected || a.Comment != "登录页报错" || a.Operator != "ou_qa" {
+			t.Errorf("Unexpected acceptance: %+v", a)
+		}
+	})
+
+	t.Run("pass enables official", func(t *testing.T) {
+		startAcceptance(context.Background(), reqID, "svc")
+		resp := click("do_check", "ou_qa", map[string]interface{}{"result": acceptPass}, "")
+		respCard, _ := resp.Card.Data.(map[string]interface{})
+		btn := findButton(respCard, "do_official_release")
+		if btn == nil || btn["disabled"] == true {
+			t.Fatalf("Official button should be enabled after acceptance, got %+v", btn)
+		}
+		if findAcceptanceForm(respCard) != nil {
+			t.Error("Acceptance form should be removed after decision")
+		}
+	})
+
+	t.Run("state cannot be preset by caller", func(t *testing.T) {
+		var req GrayCardRequest
+		body := `{"services": [{"name": "svc", "acceptance": {"status": "passed"}, "gray_phase": 3, "promote_at": 1, "reason_action": "do_restart"}]}`
+		if err := json.Unmarshal([]byte(body), &req); err != nil {
+			t.Fatal(err)
+		}
+		svc := req.Services[0]
+		if svc.Acceptance != nil || svc.GrayPhase != 0 || svc.PromoteAt != 0 || svc.ReasonAction != "" {
+			t.Errorf("Server-side state should be ignored, got %+v", svc)
+		}
+	})
+}
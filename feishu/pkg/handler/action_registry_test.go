@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"devops/feishu/pkg/action"
+
+	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher/callback"
+)
+
+func TestCustomAction(t *testing.T) {
+	// 注册自定义的扩容动作
+	action.Default.Register(action.Definition{
+		Name:    "scale",
+		Aliases: []string{"扩容"},
+		Labels:  map[string]string{"zh": "📈 扩容"},
+		Params:  map[string]string{"DEPLOY_TYPE": "Scale", "REPLICAS": "4"},
+	})
+
+	reqID := "test-req-action-001"
+	GlobalStore.Save(reqID, GrayCardRequest{Services: []Service{
+		{Name: "svc", ObjectID: "proj", Branches: []string{"master"}, Actions: []string{"gray", "扩容"}},
+	}})
+
+	t.Run("button rendered from registry", func(t *testing.T) {
+		storedReq, _ := GlobalStore.Get(reqID)
+		card := renderStoredCard(reqID, storedReq)
+		btn := findButton(card, "do_scale")
+		if btn == nil {
+			t.Fatal("Scale button should be rendered")
+		}
+		text, _ := btn["text"].(map[string]interface{})
+		if text["content"] != "📈 扩容" {
+			t.Errorf("Unexpected label: %v", text["content"])
+		}
+	})
+
+	t.Run("click triggers build with params", func(t *testing.T) {
+		origRun := runBuild
+		defer func() { runBuild = origRun }()
+		got := make(chan buildTask, 1)
+		runBuild = func(ctx context.Context, task buildTask) string {
+			got <- task
+			return "SUCCESS"
+		}
+
+		InitCallbackHandler(nil)
+		event := &callback.CardActionTriggerEvent{
+			Event: &callback.CardActionTriggerRequest{
+				Action: &callback.CallBackAction{
+					Value: map[string]interface{}{"request_id": reqID, "service": "svc", "action": "do_scale", "branch": "master"},
+				},
+			},
+		}
+		resp, _ := handleCardAction(context.Background(), event)
+
+		select {
+		case task := <-got:
+			if task.DeployType != "Scale" || task.Params["REPLICAS"] != "4" {
+				t.Errorf("Unexpected task: %+v", task)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Scale action should trigger a build")
+		}
+
+		// 非可重复动作点击后按钮禁用
+		card, _ := resp.Card.Data.(map[string]interface{})
+		if btn := findButton(card, "do_scale"); btn == nil || btn["disabled"] != true {
+			t.Errorf("Scale button should be disabled after click: %+v", btn)
+		}
+	})
+}
@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"devops/feishu/config"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 审计记录的操作来源
+const (
+	AuditSourceCard = "card" // 飞书卡片按钮
+	AuditSourceAPI  = "api"  // HTTP 接口
+	AuditSourceAuto = "auto" // 系统自动触发，如灰度自动转正式
+)
+
+// 审计记录的结果，构建类记录的结果为 Jenkins 构建结果（SUCCESS / FAILURE / ABORTED / ERROR）
+const (
+	AuditAccepted = "ACCEPTED"
+	AuditRejected = "REJECTED"
+)
+
+// AuditLogModel 发布操作审计记录，只追加不修改
+// 每次点击记录一条，触发的构建结束后再追加一条带队列号、构建号和结果的记录
+type AuditLogModel struct {
+	ID          uint64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	RequestID   string     `gorm:"size:191;index" json:"request_id"`
+	Service     string     `gorm:"size:191;index" json:"service"`
+	Action      string     `gorm:"size:64;index" json:"action"`
+	Branch      string     `gorm:"size:191" json:"branch"`
+	Operator    string     `gorm:"size:191;index" json:"operator"`
+	Source      string     `gorm:"size:32" json:"source"`
+	QueueID     int64      `json:"queue_id"`
+	BuildNumber int64      `json:"build_number"`
+	Outcome     string     `gorm:"size:32" json:"outcome"`
+	Detail      string     `gorm:"type:text" json:"detail"` // 原因、事故单号、拒绝原因等，长度不限
+	CreatedAt   time.Time  `gorm:"index" json:"created_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+func (AuditLogModel) TableName() string {
+	return "feishu_audit_logs"
+}
+
+// AuditLog 审计日志，写入失败只打印日志，不影响发布流程
+type AuditLog struct {
+	mu       sync.Mutex
+	migrated bool
+}
+
+var GlobalAudit = &AuditLog{}
+
+func (a *AuditLog) getDB() *gorm.DB {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Printf("Failed to load config: %v\n", err)
+		return nil
+	}
+	db := cfg.GetDB()
+	if db == nil {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.migrated {
+		// 表已存在时同样迁移，将旧版本 varchar(512) 的 detail 列改为 text
+		if err := db.AutoMigrate(&AuditLogModel{}); err != nil {
+			fmt.Printf("Failed to migrate audit table: %v\n", err)
+			return nil
+		}
+		a.migrated = true
+	}
+	return db
+}
+
+// Record 追加一条审计记录
+func (a *AuditLog) Record(entry AuditLogModel) {
+	entry.ID = 0
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	fmt.Printf("Audit: source=%s operator=%s request=%s service=%s action=%s outcome=%s\n",
+		entry.Source, entry.Operator, entry.RequestID, entry.Service, entry.Action, entry.Outcome)
+
+	db := a.getDB()
+	if db == nil {
+		return
+	}
+	if err := db.Create(&entry).Error; err != nil {
+		fmt.Printf("Failed to write audit log: %v\n", err)
+	}
+}
+
+// AuditFilter 审计记录查询条件，空字段不过滤
+type AuditFilter struct {
+	RequestID string
+	Service   string
+	Action    string
+	Operator  string
+	Source    string
+	Outcome   string
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+	Offset    int
+}
+
+// Query 按条件查询审计记录，按时间倒序
+func (a *AuditLog) Query(f AuditFilter) ([]AuditLogModel, int64, error) {
+	db := a.getDB()
+	if db == nil {
+		return nil, 0, fmt.Errorf("database is not available")
+	}
+
+	q := db.Model(&AuditLogModel{})
+	for column, value := range map[string]string{
+		"request_id": f.RequestID,
+		"service":    f.Service,
+		"action":     f.Action,
+		"operator":   f.Operator,
+		"source":     f.Source,
+		"outcome":    f.Outcome,
+	} {
+		if value != "" {
+			q = q.Where(column+" = ?", value)
+		}
+	}
+	if !f.Since.IsZero() {
+		q = q.Where("created_at >= ?", f.Since)
+	}
+	if !f.Until.IsZero() {
+		q = q.Where("created_at < ?", f.Until)
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var logs []AuditLogModel
+	if err := q.Order("created_at DESC, id DESC").Limit(f.Limit).Offset(f.Offset).Find(&logs).Error; err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
+
+// parseQueryTime 解析查询参数中的时间，支持 RFC3339 和 Unix 秒
+func parseQueryTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if sec, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// auditFilterFrom 从查询参数构建过滤条件
+func auditFilterFrom(c *gin.Context) (AuditFilter, error) {
+	f := AuditFilter{
+		RequestID: c.Query("request_id"),
+		Service:   c.Query("service"),
+		Action:    c.Query("action"),
+		Operator:  c.Query("operator"),
+		Source:    c.Query("source"),
+		Outcome:   c.Query("outcome"),
+		Limit:     100,
+	}
+
+	var err error
+	if f.Since, err = parseQueryTime(c.Query("since")); err != nil {
+		return f, fmt.Errorf("invalid since: %v", err)
+	}
+	if f.Until, err = parseQueryTime(c.Query("until")); err != nil {
+		return f, fmt.Errorf("invalid until: %v", err)
+	}
+	if v := c.Query("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit <= 0 {
+			return f, fmt.Errorf("invalid limit: %s", v)
+		}
+	}
+	if f.Limit > 1000 {
+		f.Limit = 1000
+	}
+	if v := c.Query("offset"); v != "" {
+		if f.Offset, err = strconv.Atoi(v); err != nil || f.Offset < 0 {
+			return f, fmt.Errorf("invalid offset: %s", v)
+		}
+	}
+	return f, nil
+}
+
+// AuditLogs 查询审计记录，format=csv 时导出 CSV
+func (h *Handler) AuditLogs(c *gin.Context) {
+	filter, err := auditFilterFrom(c)
+	if err != nil {
+		h.writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	logs, total, err := GlobalAudit.Query(filter)
+	if err != nil {
+		h.writeError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to query audit logs: %v", err))
+		return
+	}
+
+	if c.Query("format") == "csv" {
+		writeAuditCSV(c, logs)
+		return
+	}
+	if logs == nil {
+		logs = []AuditLogModel{}
+	}
+	h.writeSuccess(c, map[string]interface{}{
+		"total": total,
+		"items": logs,
+	})
+}
+
+func writeAuditCSV(c *gin.Context, logs []AuditLogModel) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=audit-%s.csv", time.Now().Format("20060102150405")))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"id", "created_at", "finished_at", "source", "operator", "request_id", "service", "action", "branch", "queue_id", "build_number", "outcome", "detail"})
+	for _, l := range logs {
+		finishedAt := ""
+		if l.FinishedAt != nil {
+			finishedAt = l.FinishedAt.Format(time.RFC3339)
+		}
+		w.Write([]string{
+			strconv.FormatUint(l.ID, 10),
+			l.CreatedAt.Format(time.RFC3339),
+			finishedAt,
+			l.Source,
+			l.Operator,
+			l.RequestID,
+			l.Service,
+			l.Action,
+			l.Branch,
+			strconv.FormatInt(l.QueueID, 10),
+			strconv.FormatInt(l.BuildNumber, 10),
+			l.Outcome,
+			l.Detail,
+		})
+	}
+	w.Flush()
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher/callback"
+)
+
+func TestAuditLog(t *testing.T) {
+	InitCallbackHandler(nil)
+	gin.SetMode(gin.TestMode)
+
+	reqID := fmt.Sprintf("test-req-audit-%d", time.Now().UnixNano())
+	GlobalStore.Save(reqID, GrayCardRequest{Services: []Service{
+		{Name: "svc", ObjectID: "proj", Branches: []string{"master", "dev"}, Actions: []string{"gray"}},
+	}})
+
+	// 选择分支记录一条卡片操作
+	handleCardAction(context.Background(), &callback.CardActionTriggerEvent{
+		Event: &callback.CardActionTriggerRequest{
+			Operator: &callback.Operator{OpenID: "ou_audit"},
+			Action: &callback.CallBackAction{
+				Value:  map[string]interface{}{"request_id": reqID, "service": "svc", "action": "select_branch"},
+				Option: "dev",
+			},
+		},
+	})
+	// 构建结束的记录
+	GlobalAudit.Record(AuditLogModel{RequestID: reqID, Service: "svc", Action: "do_gray_release", Source: AuditSourceAuto, QueueID: 12, BuildNumber: 34, Outcome: "SUCCESS"})
+
+	query := func(rawQuery string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/audit?"+rawQuery, nil)
+		(&Handler{}).AuditLogs(c)
+		return w
+	}
+
+	t.Run("filter by operator", func(t *testing.T) {
+		w := query("request_id=" + reqID + "&operator=ou_audit")
+		var resp struct {
+			Data struct {
+				Total int64           `json:"total"`
+				Items []AuditLogModel `json:"items"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Invalid response: %s", w.Body.String())
+		}
+		if resp.Data.Total != 1 || len(resp.Data.Items) != 1 {
+			t.Fatalf("Expected 1 record, got %s", w.Body.String())
+		}
+		item := resp.Data.Items[0]
+		if item.Action != "select_branch" || item.Source != AuditSourceCard || item.Detail != "dev" || item.Outcome != AuditAccepted {
+			t.Errorf("Unexpected record: %+v", item)
+		}
+	})
+
+	t.Run("csv export", func(t *testing.T) {
+		w := query("request_id=" + reqID + "&source=auto&format=csv")
+		if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+			t.Fatalf("Expected CSV, got %s", w.Header().Get("Content-Type"))
+		}
+		lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+		if len(lines) != 2 || !strings.Contains(lines[1], ",12,34,SUCCESS,") {
+			t.Errorf("Unexpected CSV: %s", w.Body.String())
+		}
+	})
+
+	t.Run("invalid time", func(t *testing.T) {
+		if w := query("since=yesterday"); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("rejected click and long detail", func(t *testing.T) {
+		// 分支不在候选列表中，点击被拒绝
+		handleCardAction(context.Background(), &callback.CardActionTriggerEvent{
+			Event: &callback.CardActionTriggerRequest{
+				Operator: &callback.Operator{OpenID: "ou_audit_reject"},
+				Action: &callback.CallBackAction{
+					Value:  map[string]interface{}{"request_id": reqID, "service": "svc", "action": "select_branch"},
+					Option: "missing",
+				},
+			},
+		})
+		long := strings.Repeat("事故说明", 200)
+		GlobalAudit.Record(AuditLogModel{RequestID: reqID, Service: "svc", Action: "do_restart", Operator: "ou_audit_long", Source: AuditSourceCard, Outcome: AuditAccepted, Detail: long})
+
+		items, _, err := GlobalAudit.Query(AuditFilter{RequestID: reqID, Outcome: AuditRejected, Limit: 10})
+		if err != nil || len(items) != 1 || items[0].Operator != "ou_audit_reject" || !strings.Contains(items[0].Detail, "invalid branch") {
+			t.Errorf("Expected one rejected record with reason, got %+v %v", items, err)
+		}
+		items, _, _ = GlobalAudit.Query(AuditFilter{RequestID: reqID, Operator: "ou_audit_long", Limit: 10})
+		if len(items) != 1 || items[0].Detail != long {
+			t.Errorf("Long detail should be stored in full, got %d records", len(items))
+		}
+	})
+
+	t.Run("refused helper action", func(t *testing.T) {
+		// 没有进行中的批量发布时暂停被拒绝
+		handleCardAction(context.Background(), &callback.CardActionTriggerEvent{
+			Event: &callback.CardActionTriggerRequest{
+				Operator: &callback.Operator{OpenID: "ou_audit_pause"},
+				Action: &callback.CallBackAction{
+					Value: map[string]interface{}{"request_id": reqID, "service": "BATCH", "action": "pause_batch"},
+				},
+			},
+		})
+		items, _, err := GlobalAudit.Query(AuditFilter{RequestID: reqID, Operator: "ou_audit_pause", Limit: 10})
+		if err != nil || len(items) != 1 || items[0].Outcome != AuditRejected || !strings.Contains(items[0].Detail, "no running batch") {
+			t.Errorf("Expected rejected pause record, got %+v %v", items, err)
+		}
+	})
+}
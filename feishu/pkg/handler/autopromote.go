@@ -0,0 +1,305 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"devops/feishu/pkg/action"
+
+	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher/callback"
+)
+
+// defaultPromoteNotice 未配置提醒时间时，提前 10 分钟提醒
+const defaultPromoteNotice = 10 * time.Minute
+
+// afterFunc 延迟执行任务，测试中可替换
+var afterFunc = func(d time.Duration, f func()) {
+	time.AfterFunc(d, f)
+}
+
+// healthCheck 请求健康检查地址，返回 2xx 视为通过，测试中可替换
+var healthCheck = func(ctx context.Context, url string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("health check returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// findService 在请求中查找服务
+func findService(req *StoredRequest, serviceName string) *Service {
+	for i := range req.OriginalRequest.Services {
+		if req.OriginalRequest.Services[i].Name == serviceName {
+			return &req.OriginalRequest.Services[i]
+		}
+	}
+	return nil
+}
+
+// scheduleAutoPromote 灰度构建成功后，按服务的自动发布策略计划正式发布
+// 分阶段灰度只有最后一个阶段成功后才计划；已正式发布过的服务不再计划
+func scheduleAutoPromote(requestID, serviceName string) {
+	reqData, ok := GlobalStore.Get(requestID)
+	if !ok {
+		return
+	}
+	svc := findService(reqData, serviceName)
+	if svc == nil || svc.AutoPromote == nil || svc.AutoPromote.SoakMinutes <= 0 {
+		return
+	}
+	if len(svc.GrayPhases) > 0 && svc.GrayPhase < len(svc.GrayPhases) {
+		return
+	}
+	if reqData.ActionCounts[serviceName+":"+action.Default.ValueOf(action.Official)] > 0 {
+		return
+	}
+
+	soak := time.Duration(svc.AutoPromote.SoakMinutes) * time.Minute
+	promoteAt := time.Now().Add(soak)
+	GlobalStore.SetPromoteAt(requestID, serviceName, promoteAt)
+	fmt.Printf("Auto promote scheduled: %s %s at %s\n", requestID, serviceName, promoteAt.Format(time.RFC3339))
+
+	armPromotion(requestID, serviceName, promoteAt, soak, promoteNotice(*svc))
+}
+
+// promoteNotice 返回自动发布前提前提醒的时间
+func promoteNotice(svc Service) time.Duration {
+	if svc.AutoPromote != nil && svc.AutoPromote.NoticeMinutes > 0 {
+		return time.Duration(svc.AutoPromote.NoticeMinutes) * time.Minute
+	}
+	return defaultPromoteNotice
+}
+
+// armedPromotions 本进程已设置定时器的自动发布计划，key: 请求:服务:promoteAt
+var armedPromotions sync.Map
+
+// armPromotion 为自动发布计划设置提醒和执行定时器，本进程内同一计划只设置一次
+// 提醒和执行前都会在存储中认领，多个副本为同一计划设置了定时器也只执行一次
+func armPromotion(requestID, serviceName string, promoteAt time.Time, delay, notice time.Duration) {
+	key := fmt.Sprintf("%s:%s:%d", requestID, serviceName, promoteAt.Unix())
+	if _, armed := armedPromotions.LoadOrStore(key, true); armed {
+		return
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	// 已过提醒时间（如重启后恢复）时立即提醒
+	noticeDelay := delay - notice
+	if noticeDelay < 0 {
+		noticeDelay = 0
+	}
+
+	afterFunc(noticeDelay, func() {
+		sendPromoteNotice(context.Background(), requestID, serviceName, promoteAt)
+	})
+	afterFunc(delay, func() {
+		armedPromotions.Delete(key)
+		autoPromote(context.Background(), requestID, serviceName, promoteAt)
+	})
+}
+
+// resumePromotions 为数据库中计划的自动发布设置定时器
+// 定时器只在内存中，进程重启或由其他副本计划的自动发布靠此恢复
+func resumePromotions(now time.Time) {
+	pending, err := GlobalStore.PendingPromotions(now)
+	if err != nil {
+		fmt.Printf("Failed to load pending auto promotions: %v\n", err)
+		return
+	}
+	for _, p := range pending {
+		promoteAt := time.Unix(p.PromoteAt, 0)
+		if _, svc := pendingPromotion(p.RequestID, p.Service, promoteAt); svc != nil {
+			armPromotion(p.RequestID, p.Service, promoteAt, promoteAt.Sub(now), promoteNotice(*svc))
+		}
+	}
+}
+
+var promoteSweepOnce sync.Once
+
+// StartPromoteSweep 启动时及之后每分钟恢复计划中的自动发布
+func StartPromoteSweep(ctx context.Context) {
+	promoteSweepOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(time.Minute)
+			defer ticker.Stop()
+			for {
+				resumePromotions(time.Now())
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	})
+}
+
+// pendingPromotion 返回仍在等待 promoteAt 自动发布的服务，已取消、重新计划或卡片已过期（关闭）时返回 nil
+func pendingPromotion(requestID, serviceName string, promoteAt time.Time) (*StoredRequest, *Service) {
+	reqData, ok := GlobalStore.Get(requestID)
+	if !ok || reqData.IsExpired(time.Now()) {
+		return nil, nil
+	}
+	svc := findService(reqData, serviceName)
+	if svc == nil || svc.PromoteAt == 0 || svc.PromoteAt != promoteAt.Unix() {
+		return nil, nil
+	}
+	return reqData, svc
+}
+
+// sendPromoteNotice 在自动发布前发送带"取消自动发布"按钮的提醒卡片
+func sendPromoteNotice(ctx context.Context, requestID, serviceName string, promoteAt time.Time) {
+	reqData, svc := pendingPromotion(requestID, serviceName, promoteAt)
+	if svc == nil || !GlobalStore.ClaimPromoteNotice(requestID, serviceName, promoteAt) {
+		return
+	}
+	req := reqData.OriginalRequest
+	client := clientFor(req.Project)
+	if client == nil || req.ReceiveID == "" || req.ReceiveIDType == "" {
+		fmt.Println("Feishu client is nil, cannot send auto promote notice:", requestID)
+		return
+	}
+
+	cardBytes, _ := json.Marshal(buildPromoteNoticeCard(requestID, *svc, promoteAt, ""))
+	if err := client.SendMessage(ctx, req.ReceiveID, req.ReceiveIDType, "interactive", string(cardBytes)); err != nil {
+		fmt.Printf("Failed to send auto promote notice: %v\n", err)
+	}
+}
+
+// autoPromote 观察期结束后检查灰度状态和健康检查，通过后触发正式发布
+func autoPromote(ctx context.Context, requestID, serviceName string, promoteAt time.Time) {
+	reqData, svc := pendingPromotion(requestID, serviceName, promoteAt)
+	if svc == nil || !GlobalStore.ClaimPromotion(requestID, serviceName, promoteAt) {
+		return
+	}
+
+	// 观察期内有回滚、重新灰度或其他操作时不自动发布
+	record, ok := reqData.LatestBuild(serviceName)
+	if !ok || record.DeployType != action.Default.DeployTypeOf(action.Gray) || record.Result != "SUCCESS" {
+		notifyBatch(ctx, requestID, fmt.Sprintf("⚠️ 已取消自动发布: %s\n观察期内灰度状态发生变化，请手动确认", serviceName))
+		return
+	}
+	if reqData.ActionCounts[serviceName+":"+action.Default.ValueOf(action.Official)] > 0 {
+		return
+	}
+	if acceptanceBlocks(*svc) {
+		notifyBatch(ctx, requestID, fmt.Sprintf("⚠️ 已取消自动发布: %s\n尚未验收通过，请验收后手动发布", serviceName))
+		return
+	}
+	if url := svc.AutoPromote.HealthCheckURL; url != "" {
+		if err := healthCheck(ctx, url); err != nil {
+			notifyBatch(ctx, requestID, fmt.Sprintf("⚠️ 已取消自动发布: %s\n健康检查未通过: %v", serviceName, err))
+			return
+		}
+	}
+
+	fmt.Printf("Auto promoting %s (Branch: %s)\n", serviceName, record.Branch)
+	notifyBatch(ctx, requestID, fmt.Sprintf("🤖 灰度观察期结束，自动触发正式发布: %s\nBranch: %s", serviceName, record.Branch))
+	GlobalStore.IncrementActionCount(requestID, serviceName, action.Default.ValueOf(action.Official))
+	runBuild(ctx, withAction(action.Official, buildTask{RequestID: requestID, Service: serviceName, Branch: record.Branch, Source: AuditSourceAuto}))
+}
+
+// cancelAutoPromote 取消服务计划中的自动发布
+// 拒绝时第二个返回值为写入审计记录的拒绝原因
+func cancelAutoPromote(requestID, serviceName, operator string) (*callback.CardActionTriggerResponse, string) {
+	reqData, ok := GlobalStore.Get(requestID)
+	if !ok {
+		return toast("请求数据已过期或不存在"), "request not found"
+	}
+	svc := findService(reqData, serviceName)
+	if svc == nil || svc.PromoteAt == 0 {
+		return toast("自动发布已执行或已取消"), "no pending promotion"
+	}
+	promoteAt := time.Unix(svc.PromoteAt, 0)
+	GlobalStore.SetPromoteAt(requestID, serviceName, time.Time{})
+
+	if operator == "" {
+		operator = "unknown"
+	}
+	return cardResponse("已取消自动发布", buildPromoteNoticeCard(requestID, *svc, promoteAt, operator)), ""
+}
+
+// buildPromoteNoticeCard 构建自动发布提醒卡片，cancelledBy 非空时展示已取消状态
+func buildPromoteNoticeCard(requestID string, svc Service, promoteAt time.Time, cancelledBy string) map[string]interface{} {
+	elements := []interface{}{
+		map[string]interface{}{
+			"tag": "div",
+			"text": map[string]interface{}{
+				"tag": "lark_md",
+				"content": fmt.Sprintf("服务 `%s` 灰度观察期即将结束，将于 **%s** 自动触发正式发布（分支 `%s`）",
+					svc.Name, promoteAt.Format("01-02 15:04"), svc.CurrentBranch()),
+			},
+		},
+	}
+
+	template := "orange"
+	if cancelledBy != "" {
+		template = "grey"
+		elements = append(elements, map[string]interface{}{
+			"tag": "div",
+			"text": map[string]interface{}{
+				"tag":     "lark_md",
+				"content": fmt.Sprintf("🚫 自动发布已由 <at id=%s></at> 取消", cancelledBy),
+			},
+		})
+	} else {
+		elements = append(elements, map[string]interface{}{
+			"tag": "action",
+			"actions": []interface{}{
+				map[string]interface{}{
+					"tag": "button",
+					"text": map[string]interface{}{
+						"tag":     "plain_text",
+						"content": "取消自动发布",
+					},
+					"type": "danger",
+					"value": map[string]interface{}{
+						"action":     "cancel_auto_promote",
+						"service":    svc.Name,
+						"request_id": requestID,
+					},
+					"confirm": map[string]interface{}{
+						"title": map[string]interface{}{
+							"tag":     "plain_text",
+							"content": "是否确认取消自动发布？",
+						},
+						"ok_text": map[string]interface{}{
+							"tag":     "plain_text",
+							"content": "确认",
+						},
+						"cancel_text": map[string]interface{}{
+							"tag":     "plain_text",
+							"content": "取消",
+						},
+					},
+				},
+			},
+		})
+	}
+
+	return map[string]interface{}{
+		"header": map[string]interface{}{
+			"title": map[string]interface{}{
+				"content": "⏰ 自动发布提醒",
+				"tag":     "plain_text",
+			},
+			"template": template,
+		},
+		"elements": elements,
+	}
+}
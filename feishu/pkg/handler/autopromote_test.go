@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"devops/feishu/config"
+	"devops/feishu/pkg/feishu"
+
+	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher/callback"
+)
+
+func TestAutoPromote(t *testing.T) {
+	InitCallbackHandler(nil)
+
+	origAfter, origRun, origHealth := afterFunc, runBuild, healthCheck
+	defer func() { afterFunc, runBuild, healthCheck = origAfter, origRun, origHealth }()
+
+	var delays []time.Duration
+	var scheduled []func()
+	afterFunc = func(d time.Duration, f func()) {
+		delays = append(delays, d)
+		scheduled = append(scheduled, f)
+	}
+	var promoted []buildTask
+	runBuild = func(ctx context.Context, task buildTask) string {
+		promoted = append(promoted, task)
+		return "SUCCESS"
+	}
+	healthErr := error(nil)
+	healthCheck = func(ctx context.Context, url string) error { return healthErr }
+
+	serviceName := "service-promote"
+	setup := func(reqID string) {
+		delays, scheduled, promoted = nil, nil, nil
+		GlobalStore.Save(reqID, GrayCardRequest{
+			Services: []Service{{
+				Name: serviceName, ObjectID: serviceName, Branches: []string{"master"}, Actions: []string{"gray"},
+				AutoPromote: &AutoPromotePolicy{SoakMinutes: 30, NoticeMinutes: 5, HealthCheckURL: "http://health"},
+			}},
+		})
+		idx := GlobalStore.StartBuild(reqID, BuildRecord{Service: serviceName, Branch: "master", DeployType: "Gray"})
+		GlobalStore.UpdateBuild(reqID, idx, func(r *BuildRecord) { r.Result = "SUCCESS" })
+		scheduleAutoPromote(reqID, serviceName)
+	}
+
+	t.Run("promotes after soak", func(t *testing.T) {
+		reqID := "test-req-promote-001"
+		setup(reqID)
+		if len(delays) != 2 || delays[0] != 25*time.Minute || delays[1] != 30*time.Minute {
+			t.Fatalf("Expected notice at 25m and promotion at 30m, got %v", delays)
+		}
+		storedReq, _ := GlobalStore.Get(reqID)
+		if storedReq.OriginalRequest.Services[0].PromoteAt == 0 {
+			t.Error("PromoteAt should be recorded")
+		}
+
+		scheduled[1]()
+		if len(promoted) != 1 || promoted[0].DeployType != "Deploy" || promoted[0].Branch != "master" {
+			t.Fatalf("Expected official build to be triggered, got %+v", promoted)
+		}
+		if GlobalStore.GetActionCount(reqID, serviceName, "do_official_release") != 1 {
+			t.Error("Auto promotion should count as an official release")
+		}
+	})
+
+	t.Run("cancel button stops promotion", func(t *testing.T) {
+		reqID := "test-req-promote-002"
+		setup(reqID)
+		resp, _ := handleCardAction(context.Background(), &callback.CardActionTriggerEvent{
+			Event: &callback.CardActionTriggerRequest{
+				Operator: &callback.Operator{OpenID: "ou_cancel"},
+				Action: &callback.CallBackAction{
+					Value: map[string]interface{}{"request_id": reqID, "service": serviceName, "action": "cancel_auto_promote"},
+				},
+			},
+		})
+		if resp.Toast.Content != "已取消自动发布" || resp.Card == nil {
+			t.Fatalf("Expected cancel confirmation, got %+v", resp.Toast)
+		}
+
+		scheduled[1]()
+		if len(promoted) != 0 {
+			t.Error("Cancelled promotion should not trigger a build")
+		}
+	})
+
+	t.Run("failed health check skips promotion", func(t *testing.T) {
+		reqID := "test-req-promote-003"
+		setup(reqID)
+		healthErr = errors.New("unhealthy")
+		defer func() { healthErr = nil }()
+
+		scheduled[1]()
+		if len(promoted) != 0 {
+			t.Error("Promotion should be skipped when health check fails")
+		}
+	})
+
+	t.Run("closed or expired request does not promote", func(t *testing.T) {
+		reqID := "test-req-promote-004"
+		setup(reqID)
+		if _, ok := GlobalStore.Close(reqID); !ok {
+			t.Fatal("Close failed")
+		}
+		if storedReq, _ := GlobalStore.Get(reqID); storedReq.OriginalRequest.Services[0].PromoteAt != 0 {
+			t.Error("Close should clear PromoteAt")
+		}
+		scheduled[1]()
+
+		reqID = "test-req-promote-005"
+		setup(reqID)
+		GlobalStore.mutate(reqID, func(req *StoredRequest) bool {
+			req.ExpiresAt = time.Now().Add(-time.Minute)
+			return true
+		})
+		scheduled[1]()
+		if len(promoted) != 0 {
+			t.Errorf("Closed or expired request should not promote, got %+v", promoted)
+		}
+	})
+
+	t.Run("resume after restart", func(t *testing.T) {
+		if cfg, _ := config.LoadConfig(); cfg == nil || cfg.GetDB() == nil {
+			t.Skip("database is not available")
+		}
+		reqID := fmt.Sprintf("test-req-promote-resume-%d", time.Now().UnixNano())
+		setup(reqID)
+		defer GlobalStore.Delete(reqID)
+		// 模拟重启：内存中的定时器丢失，到期后由扫描恢复
+		armedPromotions = sync.Map{}
+		delays, scheduled = nil, nil
+		storedReq, _ := GlobalStore.Get(reqID)
+		promoteAt := time.Unix(storedReq.OriginalRequest.Services[0].PromoteAt, 0)
+
+		resumePromotions(promoteAt.Add(time.Second))
+		for _, f := range scheduled {
+			f()
+		}
+		var resumed int
+		for _, task := range promoted {
+			if task.RequestID == reqID {
+				resumed++
+			}
+		}
+		if resumed != 1 {
+			t.Errorf("Expected the pending promotion to run once after resume, got %d", resumed)
+		}
+		// 已认领的计划不会再次执行
+		resumePromotions(promoteAt.Add(time.Second))
+		for _, f := range scheduled {
+			f()
+		}
+		if GlobalStore.GetActionCount(reqID, serviceName, "do_official_release") != 1 {
+			t.Error("Promotion should only run once")
+		}
+	})
+
+	t.Run("stop batch card does not inherit schedule", func(t *testing.T) {
+		cfg, _ := config.LoadConfig()
+		if cfg == nil || cfg.GetDB() == nil {
+			t.Skip("database is not available")
+		}
+		// 只有飞书客户端可用时才生成新卡片；请求没有接收者，不会真正发送
+		origClient := GlobalClient
+		defer func() { GlobalClient = origClient }()
+		GlobalClient = feishu.NewClientForApp(cfg, "app", "secret")
+
+		reqID := fmt.Sprintf("test-req-promote-clone-%d", time.Now().UnixNano())
+		setup(reqID)
+		defer GlobalStore.Delete(reqID)
+		handleCardAction(context.Background(), &callback.CardActionTriggerEvent{
+			Event: &callback.CardActionTriggerRequest{
+				Operator: &callback.Operator{OpenID: "ou_ops"},
+				Action: &callback.CallBackAction{
+					Value: map[string]interface{}{"request_id": reqID, "service": "BATCH", "action": "stop_batch_release"},
+				},
+			},
+		})
+
+		ids, err := GlobalStore.FindRequestsByService(serviceName)
+		if err != nil || len(ids) == 0 || ids[0] == reqID {
+			t.Fatalf("Expected a new request to be created, got %v %v", ids, err)
+		}
+		defer GlobalStore.Delete(ids[0])
+		newReq, _ := GlobalStore.Get(ids[0])
+		if svc := newReq.OriginalRequest.Services[0]; svc.PromoteAt != 0 || svc.PromoteNoticeSent {
+			t.Errorf("New card should not inherit the promotion schedule, got %+v", svc)
+		}
+	})
+}
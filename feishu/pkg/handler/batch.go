@@ -0,0 +1,411 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"devops/feishu/pkg/action"
+	"devops/jenkins"
+
+	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher/callback"
+)
+
+// runBuild 执行单个服务的构建并返回结果，测试中可替换
+// 在 init 中赋值，避免与 triggerAndMonitorBuild -> 自动发布 -> runBuild 形成初始化循环
+var runBuild func(ctx context.Context, task buildTask) string
+
+func init() {
+	runBuild = triggerAndMonitorBuild
+}
+
+// planStages 根据发布计划把参与批量发布的服务划分为有序阶段
+// 优先使用 plan.stages；未配置时按服务的 depends_on 分层；计划中未出现的服务放在最后一个阶段
+func planStages(req GrayCardRequest, tasks map[string]buildTask) ([][]string, error) {
+	var stages [][]string
+	planned := make(map[string]bool)
+
+	if req.Plan != nil && len(req.Plan.Stages) > 0 {
+		for _, stage := range req.Plan.Stages {
+			var names []string
+			for _, name := range stage {
+				if _, ok := tasks[name]; ok && !planned[name] {
+					names = append(names, name)
+					planned[name] = true
+				}
+			}
+			if len(names) > 0 {
+				stages = append(stages, names)
+			}
+		}
+	} else {
+		layers, err := dependencyLayers(req.Services, tasks)
+		if err != nil {
+			return nil, err
+		}
+		for _, layer := range layers {
+			for _, name := range layer {
+				planned[name] = true
+			}
+		}
+		stages = layers
+	}
+
+	var rest []string
+	for name := range tasks {
+		if !planned[name] {
+			rest = append(rest, name)
+		}
+	}
+	if len(rest) > 0 {
+		sort.Strings(rest)
+		stages = append(stages, rest)
+	}
+	return stages, nil
+}
+
+// dependencyLayers 按 depends_on 拓扑分层，同一层的服务互不依赖；只考虑参与本次发布的服务
+func dependencyLayers(services []Service, tasks map[string]buildTask) ([][]string, error) {
+	deps := make(map[string][]string)
+	for _, svc := range services {
+		if _, ok := tasks[svc.Name]; !ok {
+			continue
+		}
+		for _, dep := range svc.DependsOn {
+			if _, ok := tasks[dep]; ok && dep != svc.Name {
+				deps[svc.Name] = append(deps[svc.Name], dep)
+			}
+		}
+	}
+
+	done := make(map[string]bool)
+	var layers [][]string
+	for len(done) < len(tasks) {
+		var layer []string
+		for name := range tasks {
+			if done[name] {
+				continue
+			}
+			ready := true
+			for _, dep := range deps[name] {
+				if !done[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				layer = append(layer, name)
+			}
+		}
+		if len(layer) == 0 {
+			return nil, fmt.Errorf("服务依赖存在循环")
+		}
+		sort.Strings(layer)
+		for _, name := range layer {
+			done[name] = true
+		}
+		layers = append(layers, layer)
+	}
+	return layers, nil
+}
+
+// maxParallel 返回每个阶段的最大并发构建数，0 表示不限制
+func maxParallel(req GrayCardRequest) int {
+	if req.Plan == nil || req.Plan.MaxParallel < 0 {
+		return 0
+	}
+	return req.Plan.MaxParallel
+}
+
+// failurePolicy 返回批量发布的失败策略，未配置或无法识别时为 stop
+func failurePolicy(req GrayCardRequest) string {
+	if req.Plan != nil {
+		switch req.Plan.OnFailure {
+		case FailureContinue, FailureRollback:
+			return req.Plan.OnFailure
+		}
+	}
+	return FailureStop
+}
+
+// batchPollInterval 暂停期间检查是否恢复的间隔
+var batchPollInterval = time.Second
+
+// runBatchRelease 按阶段执行批量发布，上一阶段全部成功后才开始下一阶段
+// 构建失败时按 policy 处理：stop 停止后续构建，continue 继续发布，rollback 停止并回滚本批次已成功的服务
+func runBatchRelease(ctx context.Context, requestID string, stages [][]string, tasks map[string]buildTask, parallel int, policy string) {
+	var succeeded, failed []string
+	for i, stage := range stages {
+		GlobalStore.UpdateBatch(requestID, func(b *BatchState) {
+			b.Current = i
+		})
+
+		results := runStage(ctx, requestID, stage, tasks, parallel, policy != FailureContinue)
+
+		var stageFailed []string
+		for _, name := range stage {
+			switch results[name] {
+			case "SUCCESS":
+				succeeded = append(succeeded, name)
+			case "SKIPPED":
+			default:
+				stageFailed = append(stageFailed, fmt.Sprintf("%s(%s)", name, results[name]))
+			}
+		}
+		failed = append(failed, stageFailed...)
+		if len(stageFailed) == 0 || policy == FailureContinue {
+			continue
+		}
+
+		GlobalStore.UpdateBatch(requestID, func(b *BatchState) {
+			b.Status = BatchFailed
+			b.Paused = false
+			b.FinishedAt = time.Now()
+		})
+		notifyBatch(ctx, requestID, fmt.Sprintf("⛔ 批量发布在第 %d 阶段失败，后续构建已停止\n失败服务: %s", i+1, strings.Join(stageFailed, ", ")))
+		if policy == FailureRollback {
+			rollbackCompleted(ctx, requestID, succeeded, tasks)
+		}
+		return
+	}
+
+	GlobalStore.UpdateBatch(requestID, func(b *BatchState) {
+		b.Current = len(stages) - 1
+		b.Status = BatchSucceeded
+		if len(failed) > 0 {
+			b.Status = BatchFailed
+		}
+		b.Paused = false
+		b.FinishedAt = time.Now()
+	})
+	if len(failed) > 0 {
+		notifyBatch(ctx, requestID, fmt.Sprintf("⚠️ 批量发布已完成，部分服务失败\n失败服务: %s", strings.Join(failed, ", ")))
+	}
+}
+
+// runStage 并发执行一个阶段内的构建，parallel 限制同时运行的数量
+// 每个构建开始前等待暂停结束；stopOnFailure 时阶段内出现失败后，尚未开始的构建记为 SKIPPED
+func runStage(ctx context.Context, requestID string, stage []string, tasks map[string]buildTask, parallel int, stopOnFailure bool) map[string]string {
+	if parallel <= 0 || parallel > len(stage) {
+		parallel = len(stage)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		failed  bool
+		results = make(map[string]string)
+		sem     = make(chan struct{}, parallel)
+	)
+	for _, name := range stage {
+		task := tasks[name]
+		sem <- struct{}{}
+		waitWhilePaused(ctx, requestID)
+
+		mu.Lock()
+		skip := stopOnFailure && failed
+		if skip {
+			results[name] = "SKIPPED"
+		}
+		mu.Unlock()
+		if skip {
+			<-sem
+			continue
+		}
+
+		wg.Add(1)
+		go func(name string, task buildTask) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fmt.Printf("Batch triggering %s for %s (Branch: %s)\n", task.DeployType, name, task.Branch)
+			result := runBuild(ctx, task)
+			mu.Lock()
+			results[name] = result
+			if result != "SUCCESS" {
+				failed = true
+			}
+			mu.Unlock()
+		}(name, task)
+	}
+	wg.Wait()
+	return results
+}
+
+// waitWhilePaused 批量发布暂停时阻塞，直到恢复、批次结束或 ctx 取消
+func waitWhilePaused(ctx context.Context, requestID string) {
+	for {
+		reqData, ok := GlobalStore.Get(requestID)
+		if !ok || reqData.Batch == nil || !reqData.Batch.Paused || reqData.Batch.Status != BatchRunning {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(batchPollInterval):
+		}
+	}
+}
+
+// rollbackCompleted 按发布的逆序回滚本批次已成功的服务，目标为批次开始前最近一次成功构建
+func rollbackCompleted(ctx context.Context, requestID string, services []string, tasks map[string]buildTask) {
+	reqData, ok := GlobalStore.Get(requestID)
+	if !ok || reqData.Batch == nil {
+		return
+	}
+	batchStart := reqData.Batch.StartedAt
+
+	for i := len(services) - 1; i >= 0; i-- {
+		name := services[i]
+		candidates, err := fetchRollbackCandidates(ctx, reqData.OriginalRequest.Project, name, rollbackCandidateLimit())
+		if err != nil {
+			notifyBatch(ctx, requestID, fmt.Sprintf("❌ 自动回滚失败: %s\nError: %v", name, err))
+			continue
+		}
+		var target *jenkins.BuildSummary
+		for j := range candidates {
+			if candidates[j].Timestamp.Before(batchStart) {
+				target = &candidates[j]
+				break
+			}
+		}
+		if target == nil {
+			notifyBatch(ctx, requestID, fmt.Sprintf("❌ 自动回滚失败: %s 未找到批次开始前的成功构建", name))
+			continue
+		}
+
+		fmt.Printf("Auto rollback: %s -> #%d (%s)\n", name, target.Number, target.ImageVersion)
+		runBuild(ctx, withAction(action.Rollback, buildTask{
+			RequestID:    requestID,
+			Service:      name,
+			Branch:       target.Branch,
+			ImageVersion: target.ImageVersion,
+			Operator:     tasks[name].Operator,
+			Source:       AuditSourceAuto,
+			Reason:       "批量发布失败自动回滚",
+		}))
+	}
+}
+
+// setBatchPaused 暂停或继续正在执行的批量发布，已开始的构建不受影响
+// 拒绝时第二个返回值为写入审计记录的拒绝原因
+func setBatchPaused(requestID string, paused bool) (*callback.CardActionTriggerResponse, string) {
+	reqData, ok := GlobalStore.Get(requestID)
+	if !ok {
+		return toast("请求数据已过期或不存在"), "request not found"
+	}
+	if reqData.Batch == nil || reqData.Batch.Status != BatchRunning {
+		return toast("当前没有进行中的批量发布"), "no running batch"
+	}
+
+	GlobalStore.UpdateBatch(requestID, func(b *BatchState) {
+		b.Paused = paused
+	})
+	if paused {
+		return refreshCard(requestID, "批量发布已暂停，进行中的构建会继续完成"), ""
+	}
+	return refreshCard(requestID, "批量发布已继续"), ""
+}
+
+// notifyBatch 向卡片接收者发送批量发布通知
+func notifyBatch(ctx context.Context, requestID, content string) {
+	reqData, ok := GlobalStore.Get(requestID)
+	if !ok {
+		return
+	}
+	req := reqData.OriginalRequest
+	sendFeishuMessage(ctx, req.Project, req.ReceiveID, req.ReceiveIDType, dryRunPrefix(req)+content)
+}
+
+// batchServiceIcon 返回批量发布中某个服务的状态图标
+func batchServiceIcon(storedReq *StoredRequest, name string) string {
+	record, ok := storedReq.LatestBuild(name)
+	if !ok || record.StartedAt.Before(storedReq.Batch.StartedAt) {
+		return "⏳"
+	}
+	if !record.Finished() {
+		return "🔄"
+	}
+	return resultIcon(record.Result)
+}
+
+// appendBatchProgress 在批量操作区之前展示发布计划各阶段的进度
+func appendBatchProgress(card map[string]interface{}, requestID string, storedReq *StoredRequest) {
+	batch := storedReq.Batch
+	if card == nil || batch == nil || len(batch.Stages) == 0 {
+		return
+	}
+
+	status := map[string]string{
+		BatchRunning:   "执行中",
+		BatchSucceeded: "已完成",
+		BatchFailed:    "已停止",
+	}[batch.Status]
+	if batch.Status == BatchRunning && batch.Paused {
+		status = "已暂停"
+	}
+	lines := []string{fmt.Sprintf("🧭 **发布计划（%s）**", status)}
+	for i, stage := range batch.Stages {
+		var items []string
+		for _, name := range stage {
+			items = append(items, fmt.Sprintf("%s `%s`", batchServiceIcon(storedReq, name), name))
+		}
+		marker := ""
+		if i == batch.Current && batch.Status == BatchRunning {
+			marker = " 👈"
+		}
+		lines = append(lines, fmt.Sprintf("阶段 %d：%s%s", i+1, strings.Join(items, "  "), marker))
+	}
+
+	progress := map[string]interface{}{
+		"tag": "div",
+		"text": map[string]interface{}{
+			"tag":     "lark_md",
+			"content": strings.Join(lines, "\n"),
+		},
+	}
+
+	blocks := []interface{}{progress}
+	if batch.Status == BatchRunning {
+		blocks = append(blocks, map[string]interface{}{
+			"tag":     "action",
+			"actions": []interface{}{buildPauseButton(requestID, batch.Paused)},
+		})
+	}
+
+	elements, _ := card["elements"].([]interface{})
+	for i, el := range elements {
+		elem, _ := el.(map[string]interface{})
+		text, _ := elem["text"].(map[string]interface{})
+		if text["content"] == "⚡ **批量操作**" {
+			merged := append([]interface{}{}, elements[:i]...)
+			merged = append(merged, blocks...)
+			card["elements"] = append(merged, elements[i:]...)
+			return
+		}
+	}
+	card["elements"] = append(elements, blocks...)
+}
+
+// buildPauseButton 构建批量发布的暂停/继续按钮
+func buildPauseButton(requestID string, paused bool) map[string]interface{} {
+	text, action, btnType := "⏸ 暂停", "pause_batch", "default"
+	if paused {
+		text, action, btnType = "▶ 继续", "resume_batch", "primary"
+	}
+	return map[string]interface{}{
+		"tag": "button",
+		"text": map[string]interface{}{
+			"tag":     "plain_text",
+			"content": text,
+		},
+		"type": btnType,
+		"value": map[string]interface{}{
+			"action":     action,
+			"service":    "BATCH",
+			"request_id": requestID,
+		},
+	}
+}
@@ -0,0 +1,231 @@
+package handler
+
+import (
+	"context"
+	"devops/jenkins"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher/callback"
+)
+
+func TestBatchReleasePlan(t *testing.T) {
+	tasks := map[string]buildTask{
+		"user-svc":  {Service: "user-svc"},
+		"order-svc": {Service: "order-svc"},
+		"gateway":   {Service: "gateway"},
+		"web":       {Service: "web"},
+	}
+
+	t.Run("stages from depends_on", func(t *testing.T) {
+		req := GrayCardRequest{Services: []Service{
+			{Name: "user-svc"},
+			{Name: "order-svc", DependsOn: []string{"user-svc"}},
+			{Name: "gateway", DependsOn: []string{"user-svc", "order-svc"}},
+			{Name: "web", DependsOn: []string{"gateway"}},
+		}}
+		stages, err := planStages(req, tasks)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := [][]string{{"user-svc"}, {"order-svc"}, {"gateway"}, {"web"}}
+		if !reflect.DeepEqual(stages, want) {
+			t.Errorf("Expected %v, got %v", want, stages)
+		}
+	})
+
+	t.Run("explicit stages keep unplanned services last", func(t *testing.T) {
+		req := GrayCardRequest{Plan: &ReleasePlan{Stages: [][]string{{"order-svc", "user-svc"}, {"gateway"}}}}
+		stages, _ := planStages(req, tasks)
+		want := [][]string{{"order-svc", "user-svc"}, {"gateway"}, {"web"}}
+		if !reflect.DeepEqual(stages, want) {
+			t.Errorf("Expected %v, got %v", want, stages)
+		}
+	})
+
+	t.Run("dependency cycle", func(t *testing.T) {
+		req := GrayCardRequest{Services: []Service{
+			{Name: "gateway", DependsOn: []string{"web"}},
+			{Name: "web", DependsOn: []string{"gateway"}},
+		}}
+		if _, err := planStages(req, tasks); err == nil {
+			t.Error("Expected cycle error")
+		}
+	})
+}
+
+func TestRunBatchRelease(t *testing.T) {
+	reqID := "test-req-batch-001"
+	GlobalStore.Save(reqID, GrayCardRequest{
+		Services: []Service{
+			{Name: "a", ObjectID: "proj", Branches: []string{"master"}, Actions: []string{"gray"}},
+			{Name: "b", ObjectID: "proj", Branches: []string{"master"}, Actions: []string{"gray"}},
+			{Name: "c", ObjectID: "proj", Branches: []string{"master"}, Actions: []string{"gray"}},
+			{Name: "d", ObjectID: "proj", Branches: []string{"master"}, Actions: []string{"gray"}},
+		},
+	})
+
+	origRun := runBuild
+	defer func() { runBuild = origRun }()
+
+	var (
+		mu       sync.Mutex
+		started  []string
+		running  int32
+		maxSeen  int32
+		failWith = map[string]string{"c": "FAILURE"}
+	)
+	runBuild = func(ctx context.Context, task buildTask) string {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxSeen)
+			if n <= m || atomic.CompareAndSwapInt32(&maxSeen, m, n) {
+				break
+			}
+		}
+		mu.Lock()
+		started = append(started, task.Service)
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		if r, ok := failWith[task.Service]; ok {
+			return r
+		}
+		return "SUCCESS"
+	}
+
+	stages := [][]string{{"a", "b"}, {"c"}, {"d"}}
+	tasks := map[string]buildTask{"a": {Service: "a"}, "b": {Service: "b"}, "c": {Service: "c"}, "d": {Service: "d"}}
+	if !GlobalStore.StartBatch(reqID, stages) {
+		t.Fatal("StartBatch should succeed")
+	}
+	if GlobalStore.StartBatch(reqID, stages) {
+		t.Error("A second batch should be refused while one is running")
+	}
+
+	runBatchRelease(context.Background(), reqID, stages, tasks, 1, FailureStop)
+
+	if maxSeen > 1 {
+		t.Errorf("Expected at most 1 concurrent build, got %d", maxSeen)
+	}
+	if len(started) != 3 || started[2] != "c" {
+		t.Errorf("Expected stage 3 to be skipped after failure, started: %v", started)
+	}
+	storedReq, _ := GlobalStore.Get(reqID)
+	if storedReq.Batch.Status != BatchFailed || storedReq.Batch.Current != 1 {
+		t.Errorf("Expected batch failed at stage 2, got %+v", storedReq.Batch)
+	}
+
+	card := renderStoredCard(reqID, storedReq)
+	found := false
+	for _, el := range card["elements"].([]interface{}) {
+		elem, _ := el.(map[string]interface{})
+		text, _ := elem["text"].(map[string]interface{})
+		if content, _ := text["content"].(string); strings.HasPrefix(content, "🧭") {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Batch progress should be shown on the card")
+	}
+}
+
+func TestBatchFailurePolicies(t *testing.T) {
+	origRun, origFetch, origPoll := runBuild, fetchRollbackCandidates, batchPollInterval
+	defer func() { runBuild, fetchRollbackCandidates, batchPollInterval = origRun, origFetch, origPoll }()
+	batchPollInterval = 5 * time.Millisecond
+
+	stages := [][]string{{"a"}, {"b"}, {"c"}}
+	tasks := map[string]buildTask{"a": {Service: "a"}, "b": {Service: "b"}, "c": {Service: "c"}}
+
+	var mu sync.Mutex
+	var calls []string
+	runBuild = func(ctx context.Context, task buildTask) string {
+		mu.Lock()
+		calls = append(calls, task.DeployType+":"+task.Service)
+		mu.Unlock()
+		if task.Service == "b" && task.DeployType != "Rollback" {
+			return "FAILURE"
+		}
+		return "SUCCESS"
+	}
+	fetchRollbackCandidates = func(ctx context.Context, project, jobName string, limit int) ([]jenkins.BuildSummary, error) {
+		return []jenkins.BuildSummary{{Number: 1, Branch: "master", ImageVersion: "v1", Timestamp: time.Now().Add(-time.Hour)}}, nil
+	}
+
+	start := func(reqID string) {
+		calls = nil
+		GlobalStore.Save(reqID, GrayCardRequest{Services: []Service{
+			{Name: "a", ObjectID: "proj", Branches: []string{"master"}, Actions: []string{"gray"}},
+		}})
+		GlobalStore.StartBatch(reqID, stages)
+	}
+
+	t.Run("continue", func(t *testing.T) {
+		start("test-req-batch-continue")
+		runBatchRelease(context.Background(), "test-req-batch-continue", stages, tasks, 0, FailureContinue)
+		if want := []string{":a", ":b", ":c"}; !reflect.DeepEqual(calls, want) {
+			t.Errorf("Expected %v, got %v", want, calls)
+		}
+		storedReq, _ := GlobalStore.Get("test-req-batch-continue")
+		if storedReq.Batch.Status != BatchFailed {
+			t.Errorf("Expected failed status, got %s", storedReq.Batch.Status)
+		}
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		start("test-req-batch-rollback")
+		runBatchRelease(context.Background(), "test-req-batch-rollback", stages, tasks, 0, FailureRollback)
+		if want := []string{":a", ":b", "Rollback:a"}; !reflect.DeepEqual(calls, want) {
+			t.Errorf("Expected %v, got %v", want, calls)
+		}
+	})
+
+	t.Run("pause and resume", func(t *testing.T) {
+		reqID := "test-req-batch-pause"
+		start(reqID)
+		InitCallbackHandler(nil)
+		newEvent := func(action string) *callback.CardActionTriggerEvent {
+			return &callback.CardActionTriggerEvent{
+				Event: &callback.CardActionTriggerRequest{
+					Action: &callback.CallBackAction{
+						Value: map[string]interface{}{"request_id": reqID, "service": "BATCH", "action": action},
+					},
+				},
+			}
+		}
+
+		resp, _ := handleCardAction(context.Background(), newEvent("pause_batch"))
+		card, _ := resp.Card.Data.(map[string]interface{})
+		if findButton(card, "resume_batch") == nil {
+			t.Fatalf("Expected resume button after pausing, got %+v", resp.Toast)
+		}
+
+		done := make(chan struct{})
+		go func() {
+			runBatchRelease(context.Background(), reqID, stages, tasks, 0, FailureStop)
+			close(done)
+		}()
+		time.Sleep(30 * time.Millisecond)
+		mu.Lock()
+		started := len(calls)
+		mu.Unlock()
+		if started != 0 {
+			t.Fatalf("No build should start while paused, got %v", calls)
+		}
+
+		handleCardAction(context.Background(), newEvent("resume_batch"))
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Batch should continue after resume")
+		}
+		if want := []string{":a", ":b"}; !reflect.DeepEqual(calls, want) {
+			t.Errorf("Expected %v, got %v", want, calls)
+		}
+	})
+}
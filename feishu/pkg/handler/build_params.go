@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"devops/jenkins"
+
+	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher/callback"
+)
+
+// checkBuildParams 按 Job 的参数定义校验构建参数（测试中可替换）
+var checkBuildParams = func(ctx context.Context, project string, req jenkins.BuildRequest) error {
+	client := jenkins.Instances.Resolve(project, req.JobName)
+	if client == nil {
+		return fmt.Errorf("jenkins client init failed")
+	}
+	_, err := client.ValidateBuild(ctx, req)
+	return err
+}
+
+// buildRequest 返回任务对应的 Jenkins 构建请求
+func (t buildTask) buildRequest() jenkins.BuildRequest {
+	return jenkins.BuildRequest{
+		JobName:      t.Service,
+		Branch:       t.Branch,
+		DeployType:   t.DeployType,
+		ImageVersion: t.ImageVersion,
+		GrayPercent:  t.GrayPercent,
+		Params:       t.Params,
+	}
+}
+
+// paramMismatch 在卡片回调中触发构建前校验参数，返回各服务不匹配的参数（如 svc: DEPLOY_TYPE is not defined）
+// 参数定义有缓存，通常不会拖慢回调；Jenkins 不可访问等其他错误不阻止触发，由构建通知报告
+func paramMismatch(ctx context.Context, requestID string, tasks ...buildTask) []string {
+	reqData, ok := GlobalStore.Get(requestID)
+	if !ok || isDryRun(reqData.OriginalRequest) {
+		return nil
+	}
+
+	// 与拉取回滚版本相同，需在飞书回调的 3 秒时限内返回
+	ctx, cancel := context.WithTimeout(ctx, rollbackFetchTimeout)
+	defer cancel()
+
+	var problems []string
+	for _, task := range tasks {
+		err := checkBuildParams(ctx, reqData.OriginalRequest.Project, task.buildRequest())
+		var mismatch *jenkins.ParamMismatchError
+		if errors.As(err, &mismatch) {
+			problems = append(problems, fmt.Sprintf("%s: %s", task.Service, strings.Join(mismatch.Problems, "; ")))
+		} else if err != nil {
+			fmt.Printf("Failed to check build params for %s: %v\n", task.Service, err)
+		}
+	}
+	return problems
+}
+
+// paramMismatchToast 参数不匹配时的卡片提示
+func paramMismatchToast(problems []string) *callback.CardActionTriggerResponse {
+	return toast("构建参数与 Jenkins Job 不匹配，未触发构建\n" + strings.Join(problems, "\n"))
+}
+
+// paramMismatchReason 参数不匹配时写入审计记录的拒绝原因
+func paramMismatchReason(problems []string) string {
+	return "param mismatch: " + strings.Join(problems, "; ")
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"devops/jenkins"
+
+	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher/callback"
+)
+
+func TestBuildParamMismatch(t *testing.T) {
+	InitCallbackHandler(nil)
+
+	origRun, origCheck := runBuild, checkBuildParams
+	defer func() { runBuild, checkBuildParams = origRun, origCheck }()
+	got := make(chan buildTask, 2)
+	runBuild = func(ctx context.Context, task buildTask) string {
+		got <- task
+		return "SUCCESS"
+	}
+	// svc-missing 的 Job 未定义 DEPLOY_TYPE
+	var checked []jenkins.BuildRequest
+	checkBuildParams = func(ctx context.Context, project string, req jenkins.BuildRequest) error {
+		checked = append(checked, req)
+		if req.JobName == "svc-missing" {
+			return &jenkins.ParamMismatchError{JobName: req.JobName, Problems: []string{"DEPLOY_TYPE is not defined"}}
+		}
+		return nil
+	}
+
+	reqID := fmt.Sprintf("test-req-params-%d", time.Now().UnixNano())
+	GlobalStore.Save(reqID, GrayCardRequest{Services: []Service{
+		{Name: "svc-ok", ObjectID: "proj", Branches: []string{"master"}, Actions: []string{"official"}},
+		{Name: "svc-missing", ObjectID: "proj", Branches: []string{"master"}, Actions: []string{"official"}},
+	}})
+	defer GlobalStore.Delete(reqID)
+
+	click := func(value map[string]interface{}) *callback.CardActionTriggerResponse {
+		value["request_id"] = reqID
+		resp, _ := handleCardAction(context.Background(), &callback.CardActionTriggerEvent{
+			Event: &callback.CardActionTriggerRequest{
+				Operator: &callback.Operator{OpenID: "ou_ops"},
+				Action:   &callback.CallBackAction{Value: value},
+			},
+		})
+		return resp
+	}
+
+	t.Run("mismatch shown in toast", func(t *testing.T) {
+		resp := click(map[string]interface{}{"service": "svc-missing", "action": "do_official_release", "branch": "master"})
+		if resp.Toast == nil || !strings.Contains(resp.Toast.Content, "svc-missing: DEPLOY_TYPE is not defined") {
+			t.Fatalf("Expected mismatch toast, got %+v", resp.Toast)
+		}
+		if GlobalStore.GetActionCount(reqID, "svc-missing", "do_official_release") != 0 {
+			t.Error("Rejected click should not be counted")
+		}
+		select {
+		case task := <-got:
+			t.Errorf("Build should not be triggered: %+v", task)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("matching params trigger build", func(t *testing.T) {
+		checked = nil
+		click(map[string]interface{}{"service": "svc-ok", "action": "do_official_release", "branch": "master"})
+		select {
+		case task := <-got:
+			if task.Service != "svc-ok" {
+				t.Errorf("Unexpected task: %+v", task)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected a build to be triggered")
+		}
+		if len(checked) != 1 || checked[0].DeployType != "Deploy" || checked[0].Branch != "master" {
+			t.Errorf("Unexpected checked request: %+v", checked)
+		}
+	})
+
+	t.Run("batch rejected as a whole", func(t *testing.T) {
+		resp := click(map[string]interface{}{"service": "", "action": "batch_release_all", "all_branches": map[string]interface{}{"svc-ok": "master", "svc-missing": "master"}})
+		if resp.Toast == nil || !strings.Contains(resp.Toast.Content, "svc-missing") {
+			t.Fatalf("Expected mismatch toast, got %+v", resp.Toast)
+		}
+		select {
+		case task := <-got:
+			t.Errorf("Build should not be triggered: %+v", task)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("dry run skips check", func(t *testing.T) {
+		dryID := reqID + "-dry"
+		GlobalStore.Save(dryID, GrayCardRequest{DryRun: true, Services: []Service{
+			{Name: "svc-missing", ObjectID: "proj", Branches: []string{"master"}, Actions: []string{"official"}},
+		}})
+		defer GlobalStore.Delete(dryID)
+		if problems := paramMismatch(context.Background(), dryID, buildTask{RequestID: dryID, Service: "svc-missing"}); len(problems) > 0 {
+			t.Errorf("Dry run should skip the check, got %v", problems)
+		}
+	})
+}
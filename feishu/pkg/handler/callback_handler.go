@@ -4,9 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"devops/feishu/pkg/action"
 	"devops/feishu/pkg/feishu"
 	"devops/jenkins"
 
@@ -22,59 +25,240 @@ func InitCallbackHandler(client *feishu.Client) {
 
 }
 
+// clientFor 返回项目对应的飞书客户端，未配置时回退到默认客户端
+func clientFor(project string) *feishu.Client {
+	if client := feishu.Apps.Client(project); client != nil {
+		return client
+	}
+	return GlobalClient
+}
+
 func handleCardAction(ctx context.Context, event *callback.CardActionTriggerEvent) (*callback.CardActionTriggerResponse, error) {
 
 	// 1. 解析 action value
 	// 注意：SDK 解析后的 Value 是 interface{}，通常是 map[string]interface{}
-	action := event.Event.Action
-	if action == nil || action.Value == nil {
+	cardAction := event.Event.Action
+	if cardAction == nil || cardAction.Value == nil {
 		return toast("无效的操作数据"), nil
 	}
 
-	valueMap := action.Value
+	valueMap := cardAction.Value
 	requestID, _ := valueMap["request_id"].(string)
 	serviceName, _ := valueMap["service"].(string)
 	actionName, _ := valueMap["action"].(string)
 	branch, _ := valueMap["branch"].(string)
+	operator := operatorOf(event)
+	reason, incidentID := reasonFromForm(cardAction)
 
 	if requestID == "" {
 		// 如果没有 requestID，可能是旧卡片或者未适配的卡片，直接返回成功但不处理
 		return toast("无法获取请求ID，请重试"), nil
 	}
+	audit := AuditLogModel{
+		RequestID: requestID,
+		Service:   serviceName,
+		Action:    actionName,
+		Branch:    branch,
+		Operator:  operator,
+		Source:    AuditSourceCard,
+		Outcome:   AuditAccepted,
+	}
+	switch actionName {
+	case "select_branch":
+		audit.Detail = cardAction.Option
+	case "rollback_version":
+		audit.Detail = strings.TrimSpace(rollbackVersionOf(cardAction) + " " + reasonText(reason, incidentID))
+	case "submit_reason":
+		audit.Action, _ = valueMap["target"].(string)
+		audit.Detail = reasonText(reason, incidentID)
+	}
+	if actionName == action.Default.ValueOf(action.Check) {
+		result, _ := valueMap["result"].(string)
+		comment, _ := cardAction.FormValue["comment"].(string)
+		audit.Detail = strings.TrimSpace(result + " " + comment)
+	}
+	// 过期的卡片拒绝任何操作，并刷新为过期状态
+	if storedReq, ok := GlobalStore.Get(requestID); ok {
+		now := time.Now()
+		if storedReq.IsExpired(now) {
+			audit.Outcome, audit.Detail = AuditRejected, "card expired"
+			GlobalAudit.Record(audit)
+			return expiredResponse(requestID, storedReq, "该发布卡片已过期，操作被拒绝"), nil
+		}
+		// 原因表单按目标动作判断是否过期，取消时目标动作以服务端记录为准
+		checkAction := actionName
+		switch actionName {
+		case "submit_reason":
+			checkAction = audit.Action
+		case "cancel_reason":
+			if svc := findService(storedReq, serviceName); svc != nil && svc.ReasonAction != "" {
+				checkAction = svc.ReasonAction
+			}
+		}
+		if storedReq.IsActionExpired(checkAction, now) {
+			audit.Outcome, audit.Detail = AuditRejected, "action expired"
+			GlobalAudit.Record(audit)
+			return expiredResponse(requestID, storedReq, "该操作已过期，操作被拒绝"), nil
+		}
+	}
+	// 飞书重复投递：返回当前卡片，不触发任何操作；连击在动作通过全部检查后由 GlobalDeduper.Claim 判断
+	if GlobalDeduper.IsDuplicate(event, requestID, serviceName, actionName) {
+		fmt.Printf("Duplicate card callback ignored: %s %s %s\n", requestID, serviceName, actionName)
+		return duplicateResponse(requestID), nil
+	}
+	// 审计记录在处理完成后写入，被拒绝的点击记录为 REJECTED 并附带拒绝原因
+	var rejection string
+	defer func() {
+		if rejection != "" {
+			audit.Outcome = AuditRejected
+			audit.Detail = strings.TrimSpace(audit.Detail + " " + rejection)
+		}
+		GlobalAudit.Record(audit)
+	}()
+	reject := func(reason string, resp *callback.CardActionTriggerResponse) (*callback.CardActionTriggerResponse, error) {
+		rejection = reason
+		return resp, nil
+	}
+
+	// 原因表单提交后按目标动作继续处理
+	reasonSubmitted := actionName == "submit_reason"
+	if reasonSubmitted {
+		actionName = audit.Action
+	}
+
+	// 分支下拉框：只记录选中的分支并刷新卡片，不触发构建
+	if actionName == "select_branch" {
+		if !GlobalStore.SelectBranch(requestID, serviceName, cardAction.Option) {
+			return reject("invalid branch", toast("无效的分支选择"))
+		}
+		return refreshCard(requestID, fmt.Sprintf("已选择分支: %s", cardAction.Option)), nil
+	}
+	// 以服务端记录的选中分支为准，防止旧卡片携带过期的分支
+	branch = selectedBranch(requestID, serviceName, branch)
+
 	// 2. 检查是否重复点击
 	if GlobalStore.IsActionDisabled(requestID, serviceName, actionName) {
-		return toast("该操作已执行，请勿重复点击"), nil
+		return reject("action disabled", toast("该操作已执行，请勿重复点击"))
+	}
+
+	// 验收表单只记录验收结果，不计数也不禁用按钮
+	if actionName == action.Default.ValueOf(action.Check) {
+		result, _ := valueMap["result"].(string)
+		comment, _ := cardAction.FormValue["comment"].(string)
+		resp, rejected := submitAcceptance(requestID, serviceName, result, comment, operator)
+		return reject(rejected, resp)
+	}
+
+	// 回滚需要先选择目标版本：点击回滚按钮只展开历史版本，选中版本后才触发构建
+	// 批量发布的暂停/继续只修改批次状态，不计数也不禁用按钮
+	switch actionName {
+	case action.Default.ValueOf(action.Rollback):
+		resp, rejected := openRollbackPicker(ctx, requestID, serviceName)
+		return reject(rejected, resp)
+	case "rollback_version":
+		resp, rejected := confirmRollback(requestID, serviceName, rollbackVersionOf(cardAction), reason, incidentID, operator)
+		return reject(rejected, resp)
+	case "cancel_rollback":
+		GlobalStore.SetRollbackOptions(requestID, serviceName, nil)
+		return refreshCard(requestID, "已取消回滚"), nil
+	case "pause_batch":
+		resp, rejected := setBatchPaused(requestID, true)
+		return reject(rejected, resp)
+	case "resume_batch":
+		resp, rejected := setBatchPaused(requestID, false)
+		return reject(rejected, resp)
+	case "cancel_auto_promote":
+		resp, rejected := cancelAutoPromote(requestID, serviceName, operator)
+		return reject(rejected, resp)
+	case "cancel_reason":
+		GlobalStore.SetReasonAction(requestID, serviceName, "")
+		return refreshCard(requestID, "已取消操作"), nil
+	}
+
+	// 分阶段灰度：先校验本次触发的阶段，其余检查都通过后才记录
+	grayPhase, grayPercent := -1, 0
+	if phase, ok := valueMap["phase"].(string); ok && actionName == action.Default.ValueOf(action.Gray) {
+		idx, err := strconv.Atoi(phase)
+		valid := false
+		if reqData, found := GlobalStore.Get(requestID); found && err == nil {
+			if svc := findService(reqData, serviceName); svc != nil {
+				grayPercent, valid = svc.GrayPhasePercent(idx)
+			}
+		}
+		if !valid {
+			return reject("invalid gray phase", refreshCard(requestID, "该灰度阶段已完成或无效"))
+		}
+		grayPhase = idx
+	}
+
+	def, registered := action.Default.ByValue(actionName)
+
+	// 需要验收的服务验收通过前拒绝正式发布
+	if registered && def.Name == action.Official {
+		if reqData, ok := GlobalStore.Get(requestID); ok {
+			if svc := findService(reqData, serviceName); svc != nil && acceptanceBlocks(*svc) {
+				return reject("acceptance not passed", refreshCard(requestID, "验收通过后才能正式发布"))
+			}
+		}
+	}
+
+	// 需要填写原因的动作（如重启）：点击按钮先展开原因表单，提交表单后才触发
+	if registered && def.RequireReason {
+		if !reasonSubmitted {
+			return openReasonForm(requestID, serviceName, def), nil
+		}
+		if reason == "" {
+			return reject("reason required", toast("请填写操作原因"))
+		}
+		GlobalStore.SetReasonAction(requestID, serviceName, "")
+	}
+
+	// 配置了 Jenkins 参数的动作：参数与 Job 定义不匹配时不计数、不禁用按钮，直接提示
+	var task buildTask
+	triggersBuild := registered && def.TriggersBuild()
+	if triggersBuild {
+		task = buildTask{RequestID: requestID, Service: serviceName, Branch: branch, DeployType: def.DeployType(), Params: def.Params, Operator: operator, Action: actionName, Reason: reason, IncidentID: incidentID}
+		if def.Name == action.Gray {
+			task.GrayPercent = grayPercent
+		}
+		if problems := paramMismatch(ctx, requestID, task); len(problems) > 0 {
+			return reject(paramMismatchReason(problems), paramMismatchToast(problems))
+		}
+	}
+	// 所有检查通过：同一操作人在去重窗口内的连击只受理一次（批量发布在启动批次前判断）
+	if actionName != "batch_release_all" && !GlobalDeduper.Claim(requestID, serviceName, actionName, operator) {
+		return reject("duplicate click", duplicateResponse(requestID))
+	}
+	// 记录触发的灰度阶段（并发点击时以存储中的阶段为准重新校验）
+	if grayPhase >= 0 {
+		if _, ok := GlobalStore.AdvanceGrayPhase(requestID, serviceName, grayPhase); !ok {
+			return reject("invalid gray phase", refreshCard(requestID, "该灰度阶段已完成或无效"))
+		}
 	}
 
-	// 3. 标记为已执行 (除了重启操作，重启允许重复执行)
-	// 记录点击次数（排除批量操作和回滚操作）
-	if actionName != "batch_release_all" && actionName != "stop_batch_release" && actionName != "do_rollback" {
+	// 3. 标记为已执行
+	// 记录点击次数（排除批量操作）
+	if actionName != "batch_release_all" && actionName != "stop_batch_release" {
 		GlobalStore.IncrementActionCount(requestID, serviceName, actionName)
 	}
 
-	// 修改逻辑：正式发布也像灰度发布一样，允许重复点击，不立即禁用按钮
-	if actionName != "do_restart" && actionName != "do_gray_release" && actionName != "batch_release_all" && actionName != "do_official_release" {
+	// 注册表中可重复的动作（灰度、正式、重启）不禁用按钮，并禁用动作声明的互斥动作
+	// 未注册的动作（如结束批量发布）点击后禁用
+	if registered {
+		if !def.Repeatable {
+			GlobalStore.MarkActionDisabled(requestID, serviceName, actionName)
+		}
+		for _, other := range def.Disables {
+			GlobalStore.MarkActionDisabled(requestID, serviceName, other)
+		}
+	} else if actionName != "batch_release_all" {
 		GlobalStore.MarkActionDisabled(requestID, serviceName, actionName)
 	}
-	switch actionName {
-	case "do_gray_release":
-		// 3. 执行灰度发布操作
-		fmt.Printf("Triggering Gray Release: %s, %s\n", serviceName, branch)
-		go triggerAndMonitorBuild(context.Background(), serviceName, branch, "Gray", requestID)
-	case "do_official_release":
-		// 3. 执行正式发布操作
-		fmt.Printf("Triggering Official Release: %s, %s\n", serviceName, branch)
-		// 显式增加正式发布计数 (上面统一逻辑已处理，这里移除)
-		// GlobalStore.IncrementActionCount(requestID, serviceName, actionName)
-		go triggerAndMonitorBuild(context.Background(), serviceName, branch, "Deploy", requestID)
-	case "do_rollback":
-		// 3. 执行回滚操作
-		fmt.Printf("Triggering Rollback: %s, %s\n", serviceName, branch)
-		go triggerAndMonitorBuild(context.Background(), serviceName, branch, "Rollback", requestID)
-	case "do_restart":
-		// 3. 执行重启操作
-		fmt.Printf("Triggering Restart: %s, %s\n", serviceName, branch)
-		go triggerAndMonitorBuild(context.Background(), serviceName, branch, "Restart", requestID)
+
+	// 配置了 Jenkins 参数的动作触发构建
+	if triggersBuild {
+		fmt.Printf("Triggering %s: %s, %s\n", def.Name, serviceName, branch)
+		go runBuild(context.Background(), task)
 	}
 
 	// 同时，如果点击了其中一个批量按钮，另一个批量按钮也应该被禁用
@@ -102,11 +286,14 @@ func handleCardAction(ctx context.Context, event *callback.CardActionTriggerEven
 			reqData, ok := GlobalStore.Get(requestID)
 			if !ok {
 				fmt.Printf("Error: RequestID %s not found\n", requestID)
-				return toast("请求数据不存在"), nil
+				return reject("request not found", toast("请求数据不存在"))
 			}
 
+			tasks := make(map[string]buildTask)
+			grayPhases := make(map[string]int) // 分阶段灰度的服务本次触发的阶段，批次启动后才记录
 			for svc, br := range branchMap {
-				deployType := "Deploy" // 默认为正式发布
+				br = selectedBranch(requestID, svc, br)
+				def, _ := action.Default.Lookup(action.Official) // 默认为正式发布
 
 				// 查找服务定义
 				var targetService *Service
@@ -117,27 +304,73 @@ func handleCardAction(ctx context.Context, event *callback.CardActionTriggerEven
 					}
 				}
 
+				isGray := false
 				if targetService != nil {
 					// 检查是否包含灰度动作
 					for _, act := range targetService.Actions {
-						if strings.EqualFold(act, "gray") || act == "灰度" {
-							deployType = "Gray"
+						if action.Default.Is(act, action.Gray) {
+							def, _ = action.Default.Lookup(action.Gray)
+							isGray = true
 							break
 						}
 					}
+					// 未验收通过的服务不参与批量正式发布
+					if !isGray && acceptanceBlocks(*targetService) {
+						fmt.Printf("Batch skip %s: acceptance not passed\n", svc)
+						continue
+					}
 				}
 
-				fmt.Printf("Batch triggering %s for %s (Branch: %s)\n", deployType, svc, br)
-				go triggerAndMonitorBuild(context.Background(), svc, br, deployType, requestID)
+				task := buildTask{RequestID: requestID, Service: svc, Branch: br, DeployType: def.DeployType(), Params: def.Params, Operator: operator, Action: def.Value}
+				// 分阶段灰度的服务推进到下一阶段，已到最后阶段时重试最后阶段
+				if isGray && len(targetService.GrayPhases) > 0 {
+					next := targetService.GrayPhase
+					if next >= len(targetService.GrayPhases) {
+						next = len(targetService.GrayPhases) - 1
+					}
+					task.GrayPercent, _ = targetService.GrayPhasePercent(next)
+					grayPhases[svc] = next
+				}
+				tasks[svc] = task
 			}
 
+			// 任一服务的参数与 Job 定义不匹配时整批不触发
+			names := make([]string, 0, len(tasks))
+			for svc := range tasks {
+				names = append(names, svc)
+			}
+			sort.Strings(names)
+			checks := make([]buildTask, 0, len(names))
+			for _, svc := range names {
+				checks = append(checks, tasks[svc])
+			}
+			if problems := paramMismatch(ctx, requestID, checks...); len(problems) > 0 {
+				return reject(paramMismatchReason(problems), paramMismatchToast(problems))
+			}
+
+			// 按发布计划分阶段执行，上一阶段全部成功后才开始下一阶段
+			stages, err := planStages(reqData.OriginalRequest, tasks)
+			if err != nil {
+				return reject(fmt.Sprintf("invalid release plan: %v", err), toast(fmt.Sprintf("发布计划无效: %v", err)))
+			}
+			if !GlobalDeduper.Claim(requestID, serviceName, actionName, operator) {
+				return reject("duplicate click", duplicateResponse(requestID))
+			}
+			if !GlobalStore.StartBatch(requestID, stages) {
+				return reject("batch running", toast("批量发布进行中，请等待当前批次完成"))
+			}
+			for svc, phase := range grayPhases {
+				GlobalStore.AdvanceGrayPhase(requestID, svc, phase)
+			}
+			go runBatchRelease(context.Background(), requestID, stages, tasks, maxParallel(reqData.OriginalRequest), failurePolicy(reqData.OriginalRequest))
+
 		case "stop_batch_release":
 			// 3. 执行批量结束灰度发布操作
 			fmt.Println("--------------------------------------------------------------")
 			fmt.Printf("StopBatchReleaseService(ctx, branches=%v)\n", branchMap)
 			// 发送新的卡片，把灰度发布按钮改成正式发布按钮
 			// 同时过滤掉已经完成正式发布的服务
-			if reqData, ok := GlobalStore.Get(requestID); ok && GlobalClient != nil {
+			if reqData, ok := GlobalStore.Get(requestID); ok && clientFor(reqData.OriginalRequest.Project) != nil {
 				// 1. 创建新请求ID
 				newrequestID := fmt.Sprintf("req_%d", time.Now().UnixNano())
 
@@ -150,7 +383,7 @@ func handleCardAction(ctx context.Context, event *callback.CardActionTriggerEven
 					// 检查该服务是否已经完成了正式发布
 					isOfficialDone := false
 					if reqData.ActionCounts != nil {
-						if count, ok := reqData.ActionCounts[s.Name+":do_official_release"]; ok && count > 0 {
+						if count, ok := reqData.ActionCounts[s.Name+":"+action.Default.ValueOf(action.Official)]; ok && count > 0 {
 							isOfficialDone = true
 						}
 					}
@@ -168,6 +401,8 @@ func handleCardAction(ctx context.Context, event *callback.CardActionTriggerEven
 					branches := make([]string, len(s.Branches))
 					copy(branches, s.Branches)
 					newService.Branches = branches
+					// 新卡片是新的请求，不继承原卡片的灰度阶段、自动发布计划、验收结果等状态
+					newService.resetState()
 
 					filteredServices = append(filteredServices, newService)
 				}
@@ -189,14 +424,14 @@ func handleCardAction(ctx context.Context, event *callback.CardActionTriggerEven
 						seenOfficial := false // 用于去重 official
 
 						for _, a := range s.Actions {
-							if strings.EqualFold(a, "gray") || a == "灰度" {
+							if action.Default.Is(a, action.Gray) {
 								if !seenOfficial {
-									newActions = append(newActions, "official")
+									newActions = append(newActions, action.Official)
 									seenOfficial = true
 								}
-							} else if strings.EqualFold(a, "official") || strings.EqualFold(a, "release") || a == "正式" {
+							} else if action.Default.Is(a, action.Official) {
 								if !seenOfficial {
-									newActions = append(newActions, "official")
+									newActions = append(newActions, action.Official)
 									seenOfficial = true
 								}
 							} else {
@@ -218,7 +453,7 @@ func handleCardAction(ctx context.Context, event *callback.CardActionTriggerEven
 					if newCardReq.ReceiveID != "" && newCardReq.ReceiveIDType != "" {
 						cardContent := BuildCard(newCardReq, newrequestID, nil, nil)
 						cardBytes, _ := json.Marshal(cardContent)
-						GlobalClient.SendMessage(ctx, newCardReq.ReceiveID, newCardReq.ReceiveIDType, "interactive", string(cardBytes))
+						clientFor(newCardReq.Project).SendMessage(ctx, newCardReq.ReceiveID, newCardReq.ReceiveIDType, "interactive", string(cardBytes))
 					}
 				}
 			}
@@ -243,26 +478,19 @@ func handleCardAction(ctx context.Context, event *callback.CardActionTriggerEven
 				if actionName == "stop_batch_release" {
 					// 遍历该服务的所有可能动作并禁用
 					// 我们需要将配置中的动作名映射回按钮的 action value (例如 "gray" -> "do_gray_release")
-					actionsToDisable := []string{"do_rollback", "do_restart", "do_gray_release"} // 默认总是包含这两个，并且禁用灰度
+					// 默认总是包含回滚、重启，并且禁用灰度
+					actionsToDisable := []string{
+						action.Default.ValueOf(action.Rollback),
+						action.Default.ValueOf(action.Restart),
+						action.Default.ValueOf(action.Gray),
+					}
 
 					for _, act := range service.Actions {
-						var valueAction string
-						switch strings.ToLower(act) {
-						case "gray", "灰度":
-							valueAction = "do_gray_release"
-						case "official", "release", "正式":
-							valueAction = "do_official_release"
-							//continue // 不要禁用正式发布按钮
-						case "check", "验收":
-							valueAction = "do_check"
-						case "rollback", "回滚":
-							continue // 已经在默认列表中
-						case "restart", "重启":
-							continue // 已经在默认列表中
-						default:
-							valueAction = "do_" + act
+						// 回滚、重启已经在默认列表中
+						if action.Default.Is(act, action.Rollback) || action.Default.Is(act, action.Restart) {
+							continue
 						}
-						actionsToDisable = append(actionsToDisable, valueAction)
+						actionsToDisable = append(actionsToDisable, action.Default.ValueOf(act))
 					}
 
 					for _, act := range actionsToDisable {
@@ -272,9 +500,9 @@ func handleCardAction(ctx context.Context, event *callback.CardActionTriggerEven
 					// 批量发布时：
 					// 1. 禁用灰度发布按钮?
 					// 2. 增加灰度发布计数
-					GlobalStore.IncrementActionCount(requestID, service.Name, "do_gray_release")
-					if strings.EqualFold(actionName, "official") || strings.EqualFold(actionName, "release") || actionName == "正式" {
-						GlobalStore.IncrementActionCount(requestID, service.Name, "do_official_release")
+					GlobalStore.IncrementActionCount(requestID, service.Name, action.Default.ValueOf(action.Gray))
+					if action.Default.Is(actionName, action.Official) {
+						GlobalStore.IncrementActionCount(requestID, service.Name, action.Default.ValueOf(action.Official))
 					}
 				}
 
@@ -282,7 +510,7 @@ func handleCardAction(ctx context.Context, event *callback.CardActionTriggerEven
 					serverList = make(map[string]string)
 				}
 				if len(service.Branches) > 0 {
-					serverList[service.Name] = service.Branches[0]
+					serverList[service.Name] = service.CurrentBranch()
 				}
 			}
 		}
@@ -292,16 +520,42 @@ func handleCardAction(ctx context.Context, event *callback.CardActionTriggerEven
 	storedReq, exists := GlobalStore.Get(requestID)
 
 	if !exists {
-		return toast("请求数据已过期或不存在"), nil
+		return reject("request not found", toast("请求数据已过期或不存在"))
+	}
+
+	// 5. 返回更新后的卡片
+	return cardResponse("操作成功", renderStoredCard(requestID, storedReq)), nil
+}
+
+// renderStoredCard 根据存储的请求重新构建卡片
+// 原始请求包含灰度服务时保持灰度视图（隐藏正式发布按钮）
+func renderStoredCard(requestID string, storedReq *StoredRequest) map[string]interface{} {
+	displayRequest := GrayView(storedReq.OriginalRequest)
+
+	// 重新构建卡片（按钮会被禁用）
+	// 注意：storedReq 是读取时的快照，Store 的修改会生成新对象，调用方需在修改后重新 Get
+	card := BuildCard(displayRequest, requestID, storedReq.DisabledActions, storedReq.ActionCounts)
+	appendBatchProgress(card, requestID, storedReq)
+
+	// 过期的卡片或动作置灰
+	now := time.Now()
+	if storedReq.IsExpired(now) {
+		markExpired(card, nil)
+	} else {
+		markExpired(card, func(action string) bool {
+			return storedReq.IsActionExpired(action, now)
+		})
 	}
+	return card
+}
 
-	// 检查是否需要过滤显示（灰度模式）
-	// 原始请求包含灰度服务，我们需要保持灰度视图（隐藏正式发布按钮）
-	displayRequest := storedReq.OriginalRequest
+// GrayView 返回卡片上实际展示的请求：包含灰度服务时只展示灰度服务，并隐藏正式发布按钮
+// 需要验收的服务验收通过后保留正式发布按钮
+func GrayView(req GrayCardRequest) GrayCardRequest {
 	hasGray := false
-	for _, s := range displayRequest.Services {
+	for _, s := range req.Services {
 		for _, a := range s.Actions {
-			if strings.EqualFold(a, "gray") || a == "灰度" {
+			if action.Default.Is(a, action.Gray) {
 				hasGray = true
 				break
 			}
@@ -310,57 +564,74 @@ func handleCardAction(ctx context.Context, event *callback.CardActionTriggerEven
 			break
 		}
 	}
+	if !hasGray {
+		return req
+	}
 
-	if hasGray {
-		var filteredServices []Service
-		for _, s := range displayRequest.Services {
-			hasGrayAction := false
-			for _, a := range s.Actions {
-				if strings.EqualFold(a, "gray") || a == "灰度" {
-					hasGrayAction = true
-					break
-				}
+	var filteredServices []Service
+	for _, s := range req.Services {
+		hasGrayAction := false
+		for _, a := range s.Actions {
+			if action.Default.Is(a, action.Gray) {
+				hasGrayAction = true
+				break
 			}
+		}
 
-			if hasGrayAction {
-				newService := s
-				newActions := []string{}
-				for _, a := range s.Actions {
-					if strings.EqualFold(a, "official") || strings.EqualFold(a, "release") || a == "正式" {
-						continue
-					}
-					newActions = append(newActions, a)
+		if hasGrayAction {
+			newService := s
+			newActions := []string{}
+			accepted := requiresAcceptance(s) && !acceptanceBlocks(s)
+			for _, a := range s.Actions {
+				if action.Default.Is(a, action.Official) && !accepted {
+					continue
 				}
-				newService.Actions = newActions
-				filteredServices = append(filteredServices, newService)
+				newActions = append(newActions, a)
 			}
+			newService.Actions = newActions
+			filteredServices = append(filteredServices, newService)
 		}
-		displayRequest.Services = filteredServices
 	}
+	req.Services = filteredServices
+	return req
+}
 
-	// 重新构建卡片（按钮会被禁用）
-	// 注意：这里需要传入最新的 disabledActions，已经在 Store 中更新了
-	// Store.Get 返回的是指针，所以 MarkActionDisabled 修改的是同一个对象
-	// BuildGrayCard 会读取这个 map
-	newCard := BuildCard(displayRequest, requestID, storedReq.DisabledActions, storedReq.ActionCounts)
+// refreshCard 重新渲染存储的请求卡片并附带提示
+func refreshCard(requestID, msg string) *callback.CardActionTriggerResponse {
+	storedReq, ok := GlobalStore.Get(requestID)
+	if !ok {
+		return toast("请求数据已过期或不存在")
+	}
+	return cardResponse(msg, renderStoredCard(requestID, storedReq))
+}
 
-	// 如果是结束发布，删除持久化文件（清理数据）
-	// if actionName == "stop_batch_release" {
-	// 	GlobalStore.Delete(requestID)
-	// }
+// selectedBranch 返回服务在卡片下拉框中选中的分支，未选择时返回 fallback
+func selectedBranch(requestID, serviceName, fallback string) string {
+	reqData, ok := GlobalStore.Get(requestID)
+	if !ok {
+		return fallback
+	}
+	for _, s := range reqData.OriginalRequest.Services {
+		if s.Name == serviceName && s.SelectedBranch != "" {
+			return s.CurrentBranch()
+		}
+	}
+	return fallback
+}
 
-	// 5. 返回更新后的卡片
-	// Card 字段在 SDK 中通常定义为 interface{}，可以直接传入 map
+// cardResponse 返回成功提示并替换卡片内容
+// Card 字段在 SDK 中通常定义为 interface{}，可以直接传入 map
+func cardResponse(msg string, card map[string]interface{}) *callback.CardActionTriggerResponse {
 	return &callback.CardActionTriggerResponse{
 		Toast: &callback.Toast{
 			Type:    "success",
-			Content: "操作成功",
+			Content: msg,
 		},
 		Card: &callback.Card{
 			Type: "raw",
-			Data: newCard,
+			Data: card,
 		},
-	}, nil
+	}
 }
 
 func toast(msg string) *callback.CardActionTriggerResponse {
@@ -372,68 +643,193 @@ func toast(msg string) *callback.CardActionTriggerResponse {
 	}
 }
 
-// triggerAndMonitorBuild 触发 Jenkins 构建并监控直到完成
-func triggerAndMonitorBuild(ctx context.Context, jobName, branch, deployType, requestID string) {
+// buildTask 描述一次由卡片触发的 Jenkins 构建
+type buildTask struct {
+	RequestID    string
+	Service      string // 服务名即 Jenkins Job 名
+	Branch       string
+	DeployType   string
+	ImageVersion string            // 回滚时指定的目标镜像版本
+	Params       map[string]string // 动作注册表中配置的 Jenkins 参数
+	GrayPercent  int               // 分阶段灰度的流量百分比
+	Operator     string            // 点击按钮的飞书 open_id
+	Action       string            // 触发构建的动作回调值，用于审计
+	Source       string            // 操作来源，为空表示卡片
+	Reason       string            // 回滚、重启等操作填写的原因
+	IncidentID   string            // 关联的事故单号
+}
+
+// withAction 按动作注册表填充任务的部署类型和 Jenkins 参数
+func withAction(name string, task buildTask) buildTask {
+	if def, ok := action.Default.Lookup(name); ok {
+		task.DeployType = def.DeployType()
+		task.Params = def.Params
+		task.Action = def.Value
+	}
+	return task
+}
+
+// triggerAndMonitorBuild 触发 Jenkins 构建并监控直到完成，返回构建结果
+func triggerAndMonitorBuild(ctx context.Context, task buildTask) (result string) {
+	jobName, branch, deployType, requestID := task.Service, task.Branch, task.DeployType, task.RequestID
+	if task.ImageVersion != "" {
+		// 通知中展示回滚目标版本
+		deployType = fmt.Sprintf("%s (%s)", deployType, task.ImageVersion)
+	}
+	if task.GrayPercent > 0 {
+		deployType = fmt.Sprintf("%s %d%%", deployType, task.GrayPercent)
+	}
+	// 回滚、重启等操作在通知中附带原因
+	var reasonNote string
+	if reason := reasonText(task.Reason, task.IncidentID); reason != "" {
+		reasonNote = "\nReason: " + reason
+	}
+
 	// 获取发送消息的 ID
-	var receiveID, receiveIDType string
+	var receiveID, receiveIDType, project, environment, label string
+	var client buildClient
 	if reqData, ok := GlobalStore.Get(requestID); ok {
 		receiveID = reqData.OriginalRequest.ReceiveID
 		receiveIDType = reqData.OriginalRequest.ReceiveIDType
+		project = reqData.OriginalRequest.Project
+		environment = reqData.OriginalRequest.Environment
+		// 演练模式用模拟构建替代 Jenkins，通知标注「演练」
+		if label = dryRunPrefix(reqData.OriginalRequest); label != "" {
+			client = newSimulatedBuild(reqData.OriginalRequest)
+		}
 	} else {
 		fmt.Printf("Error: RequestID %s not found in store, cannot send notifications\n", requestID)
-		return
+		return "ERROR"
 	}
 
-	client := jenkins.NewClient()
-	if client == nil {
-		sendFeishuMessage(ctx, receiveID, receiveIDType, fmt.Sprintf("❌ Jenkins 初始化失败: %s", jobName))
-		return
-	}
+	// 记录构建，结束时回写结果并追加审计记录；所有服务都结束后发送汇总卡片
+	startedAt := time.Now()
+	recordIndex := GlobalStore.StartBuild(requestID, BuildRecord{
+		Service:      jobName,
+		Branch:       branch,
+		DeployType:   task.DeployType,
+		ImageVersion: task.ImageVersion,
+		GrayPercent:  task.GrayPercent,
+		Operator:     task.Operator,
+		Reason:       task.Reason,
+		IncidentID:   task.IncidentID,
+		StartedAt:    startedAt,
+	})
+	var queueID, buildNum, durationMs int64
+	imageVersion := task.ImageVersion
+	result = "ERROR" // 未拿到 Jenkins 结果的异常退出
+	defer func() {
+		finishedAt := time.Now()
+		// 已在 Jenkins 上执行的构建写入发布历史，演练不计入
+		if buildNum > 0 && label == "" {
+			GlobalReleases.Record(ReleaseModel{
+				RequestID:    requestID,
+				Service:      jobName,
+				Environment:  environment,
+				Branch:       branch,
+				DeployType:   task.DeployType,
+				GrayPercent:  task.GrayPercent,
+				ImageVersion: imageVersion,
+				BuildNumber:  buildNum,
+				Result:       result,
+				DurationMs:   durationMs,
+				Operator:     task.Operator,
+				Reason:       task.Reason,
+				IncidentID:   task.IncidentID,
+				StartedAt:    startedAt,
+				FinishedAt:   finishedAt,
+			})
+		}
+		source := task.Source
+		if source == "" {
+			source = AuditSourceCard
+		}
+		GlobalAudit.Record(AuditLogModel{
+			RequestID:   requestID,
+			Service:     jobName,
+			Action:      task.Action,
+			Branch:      branch,
+			Operator:    task.Operator,
+			Source:      source,
+			QueueID:     queueID,
+			BuildNumber: buildNum,
+			Outcome:     result,
+			Detail:      strings.TrimSpace(label + deployType + " " + reasonText(task.Reason, task.IncidentID)),
+			CreatedAt:   startedAt,
+			FinishedAt:  &finishedAt,
+		})
+		summaryDue := GlobalStore.UpdateBuild(requestID, recordIndex, func(r *BuildRecord) {
+			r.BuildNumber = buildNum
+			r.Result = result
+			r.DurationMs = durationMs
+			r.FinishedAt = finishedAt
+		})
+		if summaryDue {
+			sendSummaryCard(ctx, requestID)
+		}
+	}()
 
-	req := jenkins.BuildRequest{
-		JobName:    jobName,
-		Branch:     branch,
-		DeployType: deployType,
+	if client == nil {
+		// 按项目或 Job 前缀选择 Jenkins 实例
+		instance := jenkins.Instances.Route(project, jobName)
+		jenkinsClient := jenkins.Instances.Client(instance)
+		if jenkinsClient == nil {
+			notifyResult(ctx, requestID, task, fmt.Sprintf("❌ Jenkins 初始化失败: %s (instance: %s)", jobName, instance), true)
+			return
+		}
+		client = jenkinsClient
 	}
 
 	// 触发构建
-	queueID, err := client.Build(ctx, req)
+	queueID, err := client.Build(ctx, task.buildRequest())
 	if err != nil {
-		sendFeishuMessage(ctx, receiveID, receiveIDType, fmt.Sprintf("❌ 构建触发失败: %s\nBranch: %s\nType: %s\nError: %v", jobName, branch, deployType, err))
+		notifyResult(ctx, requestID, task, fmt.Sprintf("❌ 构建触发失败: %s\nBranch: %s\nType: %s\nError: %v", jobName, branch, deployType, err), true)
 		return
 	}
 
-	sendFeishuMessage(ctx, receiveID, receiveIDType, fmt.Sprintf("⏳ 正在排队: %s\nBranch: %s\nType: %s\nQueueID: %d", jobName, branch, deployType, queueID))
+	sendFeishuMessage(ctx, project, receiveID, receiveIDType, label+fmt.Sprintf("⏳ 正在排队: %s\nBranch: %s\nType: %s\nQueueID: %d%s", jobName, branch, deployType, queueID, reasonNote))
 
 	// 等待构建开始
-	buildNum, err := client.WaitForBuildToStart(ctx, queueID)
+	buildNum, err = client.WaitForBuildToStart(ctx, queueID)
 	if err != nil {
-		sendFeishuMessage(ctx, receiveID, receiveIDType, fmt.Sprintf("❌ 等待构建开始超时: %s\nQueueID: %d\nError: %v", jobName, queueID, err))
+		notifyResult(ctx, requestID, task, fmt.Sprintf("❌ 等待构建开始超时: %s\nQueueID: %d\nError: %v", jobName, queueID, err), true)
 		return
 	}
 
-	sendFeishuMessage(ctx, receiveID, receiveIDType, fmt.Sprintf("🚀 构建已开始: %s #%d\nBranch: %s\nType: %s", jobName, buildNum, branch, deployType))
+	sendFeishuMessage(ctx, project, receiveID, receiveIDType, label+fmt.Sprintf("🚀 构建已开始: %s #%d\nBranch: %s\nType: %s", jobName, buildNum, branch, deployType))
 
 	// 监控构建
 	build, err := client.MonitorBuildUntilCompletion(ctx, jobName, buildNum)
 	if err != nil {
-		sendFeishuMessage(ctx, receiveID, receiveIDType, fmt.Sprintf("❌ 监控构建出错: %s #%d\nError: %v", jobName, buildNum, err))
+		notifyResult(ctx, requestID, task, fmt.Sprintf("❌ 监控构建出错: %s #%d\nError: %v", jobName, buildNum, err), true)
 		return
 	}
 
-	result := build.GetResult()
+	result = build.GetResult()
+	durationMs = int64(build.Raw.Duration)
+	for _, p := range build.GetParameters() {
+		if p.Name == "IMAGE_VERSION" && p.Value != "" {
+			imageVersion = p.Value
+		}
+	}
 	duration := build.Raw.Duration / 1000 // ms -> s
 
 	if result == "SUCCESS" {
-		sendFeishuMessage(ctx, receiveID, receiveIDType, fmt.Sprintf("✅ 构建成功: %s #%d\nBranch: %s\nType: %s\nDuration: %ds", jobName, buildNum, branch, deployType, int64(duration)))
+		if task.DeployType == action.Default.DeployTypeOf(action.Gray) {
+			startAcceptance(ctx, requestID, jobName)
+			scheduleAutoPromote(requestID, jobName)
+		}
+		notifyResult(ctx, requestID, task, fmt.Sprintf("✅ 构建成功: %s #%d\nBranch: %s\nType: %s\nDuration: %ds%s", jobName, buildNum, branch, deployType, int64(duration), reasonNote), false)
 	} else {
-		sendFeishuMessage(ctx, receiveID, receiveIDType, fmt.Sprintf("❌ 构建失败: %s #%d\nBranch: %s\nType: %s\nResult: %s", jobName, buildNum, branch, deployType, result))
+		notifyResult(ctx, requestID, task, fmt.Sprintf("❌ 构建失败: %s #%d\nBranch: %s\nType: %s\nResult: %s%s", jobName, buildNum, branch, deployType, result, reasonNote), true)
 	}
+	return result
 }
 
-func sendFeishuMessage(ctx context.Context, receiveID, receiveIDType, content string) {
-	if GlobalClient == nil {
-		fmt.Println("GlobalClient is nil, cannot send message:", content)
+func sendFeishuMessage(ctx context.Context, project, receiveID, receiveIDType, content string) {
+	client := clientFor(project)
+	if client == nil {
+		fmt.Println("Feishu client is nil, cannot send message:", content)
 		return
 	}
 	// 构造简单的文本消息
@@ -442,7 +838,7 @@ func sendFeishuMessage(ctx context.Context, receiveID, receiveIDType, content st
 	}
 	msgBytes, _ := json.Marshal(msgContent)
 
-	err := GlobalClient.SendMessage(ctx, receiveID, receiveIDType, "text", string(msgBytes))
+	err := client.SendMessage(ctx, receiveID, receiveIDType, "text", string(msgBytes))
 	if err != nil {
 		fmt.Printf("Failed to send Feishu message: %v\n", err)
 	}
@@ -428,3 +428,50 @@ func TestCallbackHandler(t *testing.T) {
 		// Actually, we CAN verify if we use a fixed ID generator or mock `time.Now`? No.
 	})
 }
+
+func TestCallbackHandler_SelectBranch(t *testing.T) {
+	client := &feishu.Client{}
+	InitCallbackHandler(client)
+
+	reqID := "test-req-select-branch-001"
+	serviceName := "service-branch"
+	GlobalStore.Save(reqID, GrayCardRequest{
+		Services: []Service{
+			{Name: serviceName, ObjectID: serviceName, Branches: []string{"master", "release/1.2"}, Actions: []string{"gray"}},
+		},
+	})
+
+	selectEvent := func(option string) *callback.CardActionTriggerEvent {
+		return &callback.CardActionTriggerEvent{
+			Event: &callback.CardActionTriggerRequest{
+				Action: &callback.CallBackAction{
+					Option: option,
+					Value: map[string]interface{}{
+						"request_id": reqID,
+						"service":    serviceName,
+						"action":     "select_branch",
+					},
+				},
+			},
+		}
+	}
+
+	resp, _ := handleCardAction(context.Background(), selectEvent("release/1.2"))
+	if resp.Toast.Type != "success" || resp.Card == nil {
+		t.Fatalf("Expected success toast with card, got %+v", resp.Toast)
+	}
+
+	storedReq, _ := GlobalStore.Get(reqID)
+	if got := storedReq.OriginalRequest.Services[0].CurrentBranch(); got != "release/1.2" {
+		t.Errorf("Expected selected branch release/1.2, got %s", got)
+	}
+	if GlobalStore.IsActionDisabled(reqID, serviceName, "select_branch") {
+		t.Error("Branch select should never be disabled")
+	}
+
+	// 不在候选列表中的分支应被拒绝
+	resp, _ = handleCardAction(context.Background(), selectEvent("feature/unknown"))
+	if resp.Toast.Type != "info" || resp.Toast.Content != "无效的分支选择" {
+		t.Errorf("Expected invalid branch toast, got %+v", resp.Toast)
+	}
+}
@@ -1,9 +1,13 @@
 package handler
 
 import (
+	"devops/feishu/config"
+	"devops/feishu/pkg/action"
 	log "devops/tools/logger"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // BuildGrayCard 构建灰度发布卡片
@@ -38,6 +42,11 @@ func BuildCard(req GrayCardRequest, requestID string, disabledActions map[string
 	req.ObjectID = req.Services[0].ObjectID
 
 	req.Title = fmt.Sprintf("🚀%s-服务发布通知", req.ObjectID)
+	template := "blue"
+	if isDryRun(req) {
+		req.Title = DryRunLabel + req.Title
+		template = "orange"
+	}
 
 	elements := []interface{}{
 		map[string]interface{}{
@@ -77,8 +86,8 @@ func BuildCard(req GrayCardRequest, requestID string, disabledActions map[string
 			branchDisplay = "无分支"
 			Logger.Error(fmt.Sprintf("Service %s has no branches", service.Name))
 		} else {
-			// 显示第一个分支（如果有多个分支，可以按需调整）
-			branchDisplay = service.Branches[0]
+			// 显示当前选中的分支（未选择时为第一个分支）
+			branchDisplay = service.CurrentBranch()
 		}
 
 		// 添加分支显示（在action外部）
@@ -90,61 +99,75 @@ func BuildCard(req GrayCardRequest, requestID string, disabledActions map[string
 			},
 		})
 
-		// 构建操作区（只包含按钮）
+		// 已计划自动发布时展示发布时间
+		if service.PromoteAt > 0 {
+			elements = append(elements, map[string]interface{}{
+				"tag": "div",
+				"text": map[string]interface{}{
+					"tag":     "lark_md",
+					"content": fmt.Sprintf("⏰ **自动发布：** %s（发布前会在群内提醒，可取消）", time.Unix(service.PromoteAt, 0).Format("01-02 15:04")),
+				},
+			})
+		}
+
+		// 分阶段灰度时展示当前阶段
+		if len(service.GrayPhases) > 0 {
+			elements = append(elements, map[string]interface{}{
+				"tag": "div",
+				"text": map[string]interface{}{
+					"tag":     "lark_md",
+					"content": fmt.Sprintf("🌗 **灰度阶段：** %s", grayPhaseDisplay(service)),
+				},
+			})
+		}
+
+		// 构建操作区（分支下拉框 + 按钮）
 		actionsList := []interface{}{}
 
+		// 多个候选分支时提供下拉框，选中值通过回调的 option 字段带回
+		if len(service.Branches) > 1 {
+			actionsList = append(actionsList, buildBranchSelect(service, requestID, branchDisplay))
+		}
+
 		// 根据 Actions 列表生成按钮
 		// 创建一个新的切片，避免修改原始数据
-		// 过滤掉验收功能 (check/验收)
+		// 过滤掉注册表中标记为隐藏的动作（验收在下方单独展示），并补充总是展示的动作（回滚、重启）
 		var currentActions []string
-		hasRollback := false
-		hasRestart := false
+		present := make(map[string]bool)
 
 		for _, a := range service.Actions {
-			if strings.EqualFold(a, "check") || strings.EqualFold(a, "验收") {
+			def, ok := action.Default.Lookup(a)
+			if ok && def.Hidden {
 				continue
 			}
-			if strings.EqualFold(a, "rollback") || strings.EqualFold(a, "回滚") {
-				hasRollback = true
-			}
-			if strings.EqualFold(a, "restart") || strings.EqualFold(a, "重启") {
-				hasRestart = true
+			if ok {
+				present[def.Name] = true
 			}
 			currentActions = append(currentActions, a)
 		}
 
-		if !hasRollback {
-			currentActions = append(currentActions, "rollback")
-		}
-		if !hasRestart {
-			currentActions = append(currentActions, "restart")
+		for _, def := range action.Default.All() {
+			if def.Always && !def.Hidden && !present[def.Name] {
+				currentActions = append(currentActions, def.Name)
+			}
 		}
 
-		for _, action := range currentActions {
-			var text string
-			var valueAction string
-			var btnType string = "primary"
-
-			switch strings.ToLower(action) {
-			case "gray", "灰度":
-				text = "🚀 灰度"
-				valueAction = "do_gray_release"
-			case "official", "release", "正式":
-				text = "🎉 正式"
-				valueAction = "do_official_release"
-				btnType = "danger" // 正式发布可能需要警示色
-			case "rollback", "回滚":
-				text = "🔙 回滚"
-				valueAction = "do_rollback"
-				btnType = "danger"
-			case "restart", "重启":
-				text = "🔄 重启"
-				valueAction = "do_restart"
-				btnType = "primary"
-
-			default:
-				text = action
-				valueAction = "do_" + action
+		for _, name := range currentActions {
+			// 配置了灰度阶段时，每个阶段一个按钮
+			if action.Default.Is(name, action.Gray) && len(service.GrayPhases) > 0 {
+				actionsList = append(actionsList, buildGrayPhaseButtons(service, requestID, branchDisplay)...)
+				continue
+			}
+
+			text := name
+			valueAction := "do_" + name
+			btnType := "primary"
+			confirmTitle := "是否确认？"
+			if def, ok := action.Default.Lookup(name); ok {
+				text = def.Label(cardLocale())
+				valueAction = def.Value
+				btnType = def.Style
+				confirmTitle = def.ConfirmText(cardLocale())
 			}
 
 			// 检查是否禁用
@@ -169,6 +192,13 @@ func BuildCard(req GrayCardRequest, requestID string, disabledActions map[string
 				text = fmt.Sprintf("%s (%d)", text, count)
 			}
 
+			// 需要验收的服务验收通过前不能正式发布
+			if action.Default.Is(name, action.Official) && acceptanceBlocks(service) {
+				isDisabled = true
+				btnType = "default"
+				text += " (待验收)"
+			}
+
 			// 构建按钮（包含确认对话框和防重复点击）
 			button := map[string]interface{}{
 				"tag": "button",
@@ -187,7 +217,7 @@ func BuildCard(req GrayCardRequest, requestID string, disabledActions map[string
 				"confirm": map[string]interface{}{
 					"title": map[string]interface{}{
 						"tag":     "plain_text",
-						"content": "是否确认？",
+						"content": confirmTitle,
 					},
 					"ok_text": map[string]interface{}{
 						"tag":     "plain_text",
@@ -209,6 +239,21 @@ func BuildCard(req GrayCardRequest, requestID string, disabledActions map[string
 		}
 		elements = append(elements, actionElement)
 
+		// 配置了验收动作时展示验收状态和验收表单
+		if requiresAcceptance(service) {
+			elements = append(elements, buildAcceptanceSection(service, requestID)...)
+		}
+
+		// 点击回滚后展示历史版本选择
+		if len(service.RollbackOptions) > 0 {
+			elements = append(elements, buildRollbackPicker(service, requestID)...)
+		}
+
+		// 点击需要填写原因的动作后展示原因表单
+		if service.ReasonAction != "" {
+			elements = append(elements, buildReasonForm(service, requestID)...)
+		}
+
 		// 3. 分割线（除了最后一个）
 		if i < len(req.Services)-1 {
 			elements = append(elements, map[string]interface{}{
@@ -233,7 +278,7 @@ func BuildCard(req GrayCardRequest, requestID string, disabledActions map[string
 	allBranches := make(map[string]string)
 	for _, svc := range req.Services {
 		if len(svc.Branches) > 0 {
-			allBranches[svc.Name] = svc.Branches[0]
+			allBranches[svc.Name] = svc.CurrentBranch()
 		}
 	}
 
@@ -307,8 +352,207 @@ func BuildCard(req GrayCardRequest, requestID string, disabledActions map[string
 				"content": req.Title,
 				"tag":     "plain_text",
 			},
-			"template": "blue",
+			"template": template,
 		},
 		"elements": elements,
 	}
 }
+
+// cardLocale 返回卡片按钮文案使用的语言
+func cardLocale() string {
+	if cfg, err := config.LoadConfig(); err == nil && cfg != nil && cfg.CardLocale != "" {
+		return cfg.CardLocale
+	}
+	return action.DefaultLocale
+}
+
+// buildBranchSelect 构建服务的分支下拉框 (select_static)
+func buildBranchSelect(service Service, requestID, current string) map[string]interface{} {
+	options := make([]interface{}, 0, len(service.Branches))
+	for _, b := range service.Branches {
+		options = append(options, map[string]interface{}{
+			"text": map[string]interface{}{
+				"tag":     "plain_text",
+				"content": b,
+			},
+			"value": b,
+		})
+	}
+
+	return map[string]interface{}{
+		"tag": "select_static",
+		"placeholder": map[string]interface{}{
+			"tag":     "plain_text",
+			"content": "选择发布分支",
+		},
+		"initial_option": current,
+		"options":        options,
+		"value": map[string]interface{}{
+			"action":     "select_branch",
+			"service":    service.Name,
+			"request_id": requestID,
+		},
+	}
+}
+
+// buildRollbackPicker 构建回滚版本选择区：版本下拉框、回滚原因和确认按钮组成的表单 + 取消按钮
+func buildRollbackPicker(service Service, requestID string) []interface{} {
+	options := make([]interface{}, 0, len(service.RollbackOptions))
+	for _, opt := range service.RollbackOptions {
+		builtAt := time.Unix(opt.BuiltAt, 0).Format("01-02 15:04")
+		options = append(options, map[string]interface{}{
+			"text": map[string]interface{}{
+				"tag":     "plain_text",
+				"content": fmt.Sprintf("#%d %s (%s, %s)", opt.BuildNumber, opt.ImageVersion, opt.Branch, builtAt),
+			},
+			"value": strconv.FormatInt(opt.BuildNumber, 10),
+		})
+	}
+
+	formElements := []interface{}{
+		map[string]interface{}{
+			"tag":      "select_static",
+			"name":     "version",
+			"required": true,
+			"placeholder": map[string]interface{}{
+				"tag":     "plain_text",
+				"content": "选择历史版本",
+			},
+			"options": options,
+		},
+	}
+	if def, ok := action.Default.Lookup(action.Rollback); ok && def.RequireReason {
+		formElements = append(formElements, reasonInputs()...)
+	}
+	formElements = append(formElements, map[string]interface{}{
+		"tag": "button",
+		"text": map[string]interface{}{
+			"tag":     "plain_text",
+			"content": "确认回滚",
+		},
+		"type":        "danger",
+		"action_type": "form_submit",
+		"name":        "rollback_version",
+		"value": map[string]interface{}{
+			"action":     "rollback_version",
+			"service":    service.Name,
+			"request_id": requestID,
+		},
+		"confirm": map[string]interface{}{
+			"title": map[string]interface{}{
+				"tag":     "plain_text",
+				"content": "确认回滚到所选版本？",
+			},
+			"ok_text": map[string]interface{}{
+				"tag":     "plain_text",
+				"content": "确认",
+			},
+			"cancel_text": map[string]interface{}{
+				"tag":     "plain_text",
+				"content": "取消",
+			},
+		},
+	})
+
+	return []interface{}{
+		map[string]interface{}{
+			"tag": "div",
+			"text": map[string]interface{}{
+				"tag":     "lark_md",
+				"content": "🔙 **选择回滚版本：**",
+			},
+		},
+		map[string]interface{}{
+			"tag":      "form",
+			"name":     "rollback_" + service.Name,
+			"elements": formElements,
+		},
+		map[string]interface{}{
+			"tag": "action",
+			"actions": []interface{}{
+				map[string]interface{}{
+					"tag": "button",
+					"text": map[string]interface{}{
+						"tag":     "plain_text",
+						"content": "取消回滚",
+					},
+					"type": "default",
+					"value": map[string]interface{}{
+						"action":     "cancel_rollback",
+						"service":    service.Name,
+						"request_id": requestID,
+					},
+				},
+			},
+		},
+	}
+}
+
+// grayPhaseDisplay 返回服务当前灰度阶段的展示文本
+func grayPhaseDisplay(service Service) string {
+	if service.GrayPhase <= 0 {
+		return fmt.Sprintf("未开始 (0/%d)", len(service.GrayPhases))
+	}
+	current := service.GrayPhase
+	if current > len(service.GrayPhases) {
+		current = len(service.GrayPhases)
+	}
+	return fmt.Sprintf("%d%% (%d/%d)", service.GrayPhases[current-1], current, len(service.GrayPhases))
+}
+
+// buildGrayPhaseButtons 为每个灰度阶段构建按钮
+// 已完成的阶段置灰，当前阶段可重试，跳过阶段时确认框会提示跳过的数量
+func buildGrayPhaseButtons(service Service, requestID, branch string) []interface{} {
+	buttons := make([]interface{}, 0, len(service.GrayPhases))
+	for idx, percent := range service.GrayPhases {
+		text := fmt.Sprintf("🚀 灰度 %d%%", percent)
+		btnType := "default"
+		disabled := false
+		confirmTitle := fmt.Sprintf("是否确认灰度到 %d%%？", percent)
+
+		switch {
+		case idx < service.GrayPhase-1:
+			text += " (已完成)"
+			disabled = true
+		case idx == service.GrayPhase-1:
+			text += " (当前)"
+		case idx == service.GrayPhase:
+			btnType = "primary"
+		default:
+			btnType = "danger"
+			confirmTitle = fmt.Sprintf("将跳过 %d 个灰度阶段，直接灰度到 %d%%，是否确认？", idx-service.GrayPhase, percent)
+		}
+
+		buttons = append(buttons, map[string]interface{}{
+			"tag": "button",
+			"text": map[string]interface{}{
+				"tag":     "plain_text",
+				"content": text,
+			},
+			"type":     btnType,
+			"disabled": disabled,
+			"value": map[string]interface{}{
+				"action":     action.Default.ValueOf(action.Gray),
+				"service":    service.Name,
+				"request_id": requestID,
+				"branch":     branch,
+				"phase":      strconv.Itoa(idx),
+			},
+			"confirm": map[string]interface{}{
+				"title": map[string]interface{}{
+					"tag":     "plain_text",
+					"content": confirmTitle,
+				},
+				"ok_text": map[string]interface{}{
+					"tag":     "plain_text",
+					"content": "确认",
+				},
+				"cancel_text": map[string]interface{}{
+					"tag":     "plain_text",
+					"content": "取消",
+				},
+			},
+		})
+	}
+	return buttons
+}
@@ -47,10 +47,11 @@ func TestBuildGrayCard(t *testing.T) {
 	// 验证元素数量：
 	// 初始: div(服务发布通知) + hr + div(服务列表) = 3
 	// 每个服务: div(名称) + div(分支显示) + action(操作按钮) = 3
+	// 配置了验收的服务: div(验收状态) = 1
 	// 分割线: n-1 个
 	// 批量操作: hr + div(批量操作) + action(批量按钮) = 3
-	// 总数 = 3 + 3*3 + 2 + 3 = 17
-	expectedCount := 3 + len(services)*3 + (len(services) - 1) + 3
+	// 总数 = 3 + 3*3 + 1 + 2 + 3 = 18
+	expectedCount := 3 + len(services)*3 + 1 + (len(services) - 1) + 3
 	if len(elements) != expectedCount {
 		t.Errorf("expected %d elements, got %d", expectedCount, len(elements))
 	}
@@ -88,19 +89,91 @@ func TestCheckButtonFiltered(t *testing.T) {
 	}
 }
 
-// Helper to find a button by action value in the card
+// Helper to find a button by action value in the card (action rows and forms)
 func findButton(card map[string]interface{}, actionValue string) map[string]interface{} {
 	elements, _ := card["elements"].([]interface{})
 	for _, el := range elements {
 		eMap, _ := el.(map[string]interface{})
-		if eMap["tag"] == "action" {
-			actions, _ := eMap["actions"].([]interface{})
-			for _, a := range actions {
-				aMap, _ := a.(map[string]interface{})
-				valMap, _ := aMap["value"].(map[string]interface{})
-				if valMap["action"] == actionValue {
-					return aMap
-				}
+		var items []interface{}
+		switch eMap["tag"] {
+		case "action":
+			items, _ = eMap["actions"].([]interface{})
+		case "form":
+			items, _ = eMap["elements"].([]interface{})
+		}
+		for _, a := range items {
+			aMap, _ := a.(map[string]interface{})
+			valMap, _ := aMap["value"].(map[string]interface{})
+			if valMap["action"] == actionValue {
+				return aMap
+			}
+		}
+	}
+	return nil
+}
+
+func TestBranchSelect(t *testing.T) {
+	req := GrayCardRequest{
+		Services: []Service{
+			{
+				Name:           "service-multi",
+				ObjectID:       "service-multi",
+				Branches:       []string{"master", "feature/a", "fix/b"},
+				Actions:        []string{"gray"},
+				SelectedBranch: "feature/a",
+			},
+			{
+				Name:     "service-single",
+				ObjectID: "service-single",
+				Branches: []string{"master"},
+				Actions:  []string{"gray"},
+			},
+		},
+	}
+
+	card := BuildCard(req, "test-branch-select", nil, nil)
+
+	sel := findSelect(card, "service-multi")
+	if sel == nil {
+		t.Fatal("Branch select should be present for service with multiple branches")
+	}
+	if opts, _ := sel["options"].([]interface{}); len(opts) != 3 {
+		t.Errorf("expected 3 branch options, got %d", len(opts))
+	}
+	if sel["initial_option"] != "feature/a" {
+		t.Errorf("expected initial option feature/a, got %v", sel["initial_option"])
+	}
+	if findSelect(card, "service-single") != nil {
+		t.Error("Branch select should be omitted for service with a single branch")
+	}
+
+	// 按钮和批量按钮都应携带选中的分支
+	grayBtn := findButton(card, "do_gray_release")
+	if val, _ := grayBtn["value"].(map[string]interface{}); val["branch"] != "feature/a" {
+		t.Errorf("expected gray button branch feature/a, got %v", val["branch"])
+	}
+	batchBtn := findButton(card, "batch_release_all")
+	val, _ := batchBtn["value"].(map[string]interface{})
+	all, _ := val["all_branches"].(map[string]string)
+	if all["service-multi"] != "feature/a" || all["service-single"] != "master" {
+		t.Errorf("unexpected all_branches: %v", all)
+	}
+}
+
+// Helper to find the branch select of a service in the card
+func findSelect(card map[string]interface{}, serviceName string) map[string]interface{} {
+	elements, _ := card["elements"].([]interface{})
+	for _, el := range elements {
+		eMap, _ := el.(map[string]interface{})
+		if eMap["tag"] != "action" {
+			continue
+		}
+		actions, _ := eMap["actions"].([]interface{})
+		for _, a := range actions {
+			aMap, _ := a.(map[string]interface{})
+			valMap, _ := aMap["value"].(map[string]interface{})
+			if aMap["tag"] == "select_static" && valMap["service"] == serviceName {
+				return aMap
 			}
 		}
 	}
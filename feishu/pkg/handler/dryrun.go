@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"devops/feishu/config"
+	"devops/jenkins"
+
+	"github.com/bndr/gojenkins"
+)
+
+// DryRunLabel 演练模式下卡片标题和通知的前缀
+const DryRunLabel = "【演练】"
+
+// buildClient 触发并监控构建所需的 Jenkins 操作，演练模式下由 simulatedBuild 实现
+type buildClient interface {
+	Build(ctx context.Context, req jenkins.BuildRequest) (int64, error)
+	WaitForBuildToStart(ctx context.Context, queueID int64) (int64, error)
+	MonitorBuildUntilCompletion(ctx context.Context, jobName string, buildNumber int64) (*gojenkins.Build, error)
+}
+
+// isDryRun 请求是否以演练模式执行：请求单独开启或全局开启 DRY_RUN
+func isDryRun(req GrayCardRequest) bool {
+	if req.DryRun {
+		return true
+	}
+	cfg, _ := config.LoadConfig()
+	return cfg != nil && cfg.DryRun
+}
+
+// dryRunPrefix 演练模式下返回标注前缀，否则返回空串
+func dryRunPrefix(req GrayCardRequest) string {
+	if isDryRun(req) {
+		return DryRunLabel
+	}
+	return ""
+}
+
+// simulatedBuild 演练模式的模拟构建：不访问 Jenkins，等待指定时间后返回指定结果
+type simulatedBuild struct {
+	delay  time.Duration
+	result string
+}
+
+// simulatedSeq 模拟构建的队列号和构建号
+var simulatedSeq int64
+
+// newSimulatedBuild 按请求配置创建模拟构建，未配置时使用 DRY_RUN_DURATION / DRY_RUN_RESULT
+func newSimulatedBuild(req GrayCardRequest) *simulatedBuild {
+	b := &simulatedBuild{delay: 10 * time.Second, result: "SUCCESS"}
+	if cfg, _ := config.LoadConfig(); cfg != nil {
+		b.delay = cfg.DryRunDelay
+		if cfg.DryRunResult != "" {
+			b.result = cfg.DryRunResult
+		}
+	}
+	if req.DryRunSeconds > 0 {
+		b.delay = time.Duration(req.DryRunSeconds) * time.Second
+	}
+	if req.DryRunResult != "" {
+		b.result = req.DryRunResult
+	}
+	return b
+}
+
+func (b *simulatedBuild) Build(ctx context.Context, req jenkins.BuildRequest) (int64, error) {
+	return atomic.AddInt64(&simulatedSeq, 1), nil
+}
+
+func (b *simulatedBuild) WaitForBuildToStart(ctx context.Context, queueID int64) (int64, error) {
+	return queueID, nil
+}
+
+func (b *simulatedBuild) MonitorBuildUntilCompletion(ctx context.Context, jobName string, buildNumber int64) (*gojenkins.Build, error) {
+	select {
+	case <-time.After(b.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return &gojenkins.Build{Raw: &gojenkins.BuildResponse{
+		Number:   buildNumber,
+		Result:   b.result,
+		Duration: float64(b.delay.Milliseconds()),
+	}}, nil
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDryRun(t *testing.T) {
+	InitCallbackHandler(nil)
+
+	reqID := fmt.Sprintf("test-req-dryrun-%d", time.Now().UnixNano())
+	req := GrayCardRequest{
+		DryRun:        true,
+		DryRunResult:  "FAILURE",
+		DryRunSeconds: 1,
+		Services: []Service{
+			{Name: "svc", ObjectID: "proj", Branches: []string{"master"}, Actions: []string{"gray", "official"}},
+		},
+	}
+	GlobalStore.Save(reqID, req)
+
+	t.Run("card labelled", func(t *testing.T) {
+		card := BuildCard(req, reqID, nil, nil)
+		header, _ := card["header"].(map[string]interface{})
+		title, _ := header["title"].(map[string]interface{})
+		if content, _ := title["content"].(string); !strings.HasPrefix(content, DryRunLabel) {
+			t.Errorf("Expected dry-run title, got %q", content)
+		}
+	})
+
+	t.Run("simulated build", func(t *testing.T) {
+		task := withAction("gray", buildTask{RequestID: reqID, Service: "svc", Branch: "master", Operator: "ou_ops"})
+		if result := triggerAndMonitorBuild(context.Background(), task); result != "FAILURE" {
+			t.Fatalf("Expected simulated result FAILURE, got %s", result)
+		}
+		storedReq, _ := GlobalStore.Get(reqID)
+		record, ok := storedReq.LatestBuild("svc")
+		if !ok || record.Result != "FAILURE" || record.BuildNumber == 0 || record.DurationMs != 1000 {
+			t.Errorf("Unexpected build record: %+v", record)
+		}
+	})
+
+	t.Run("notices labelled", func(t *testing.T) {
+		storedReq, _ := GlobalStore.Get(reqID)
+		text, urgent := resultNotice(nil, storedReq, buildTask{Service: "svc"}, "❌ 构建失败", true)
+		if text != DryRunLabel+"❌ 构建失败" || len(urgent) != 0 {
+			t.Errorf("Unexpected notice: %q %v", text, urgent)
+		}
+	})
+}
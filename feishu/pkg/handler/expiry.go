@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"devops/feishu/config"
+	"devops/feishu/pkg/action"
+
+	"github.com/gin-gonic/gin"
+	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher/callback"
+)
+
+// requestTTL 返回请求的有效期：优先使用请求自带的 ttl_seconds，否则使用 REQUEST_TTL
+func requestTTL(req GrayCardRequest) time.Duration {
+	if req.TTLSeconds > 0 {
+		return time.Duration(req.TTLSeconds) * time.Second
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil || cfg == nil {
+		return 0
+	}
+	return cfg.RequestTTL
+}
+
+// actionTTL 返回某个按钮动作单独配置的有效期，未配置时返回 0
+func actionTTL(action string) time.Duration {
+	cfg, err := config.LoadConfig()
+	if err != nil || cfg == nil {
+		return 0
+	}
+	return cfg.ActionTTLs[action]
+}
+
+// Deadline 返回请求的过期时间，零值表示永不过期
+// 旧数据没有 ExpiresAt 时按创建时间 + 默认有效期计算，避免数月前的卡片仍能触发构建
+func (r *StoredRequest) Deadline() time.Time {
+	if !r.ExpiresAt.IsZero() {
+		return r.ExpiresAt
+	}
+	if ttl := requestTTL(r.OriginalRequest); ttl > 0 && !r.CreatedAt.IsZero() {
+		return r.CreatedAt.Add(ttl)
+	}
+	return time.Time{}
+}
+
+// IsExpired 判断整个请求是否已过期
+func (r *StoredRequest) IsExpired(now time.Time) bool {
+	deadline := r.Deadline()
+	return !deadline.IsZero() && now.After(deadline)
+}
+
+// parentAction 返回回调值所属的按钮动作：回滚版本的选择和取消属于回滚，批量发布的暂停和继续属于批量发布
+// 这些回调按所属动作的有效期判断，避免有效期内展开的选择在过期后仍能确认
+func parentAction(value string) string {
+	switch value {
+	case "rollback_version", "cancel_rollback":
+		return action.Default.ValueOf(action.Rollback)
+	case "pause_batch", "resume_batch":
+		return "batch_release_all"
+	}
+	return value
+}
+
+// IsActionExpired 判断某个动作是否已过期（请求过期或超过该动作单独配置的有效期）
+func (r *StoredRequest) IsActionExpired(value string, now time.Time) bool {
+	if r.IsExpired(now) {
+		return true
+	}
+	ttl := actionTTL(parentAction(value))
+	if ttl <= 0 {
+		return false
+	}
+	start := r.RenewedAt
+	if start.IsZero() {
+		start = r.CreatedAt
+	}
+	return !start.IsZero() && now.After(start.Add(ttl))
+}
+
+// expiredResponse 拒绝过期卡片上的点击，并把卡片刷新为过期状态
+func expiredResponse(requestID string, storedReq *StoredRequest, msg string) *callback.CardActionTriggerResponse {
+	resp := cardResponse(msg, renderStoredCard(requestID, storedReq))
+	resp.Toast.Type = "warning"
+	return resp
+}
+
+// formExpired 表单中任一提交按钮的动作已过期时返回 true
+func formExpired(form map[string]interface{}, expired func(action string) bool) bool {
+	items, _ := form["elements"].([]interface{})
+	for _, it := range items {
+		item, _ := it.(map[string]interface{})
+		value, _ := item["value"].(map[string]interface{})
+		if name, ok := value["action"].(string); ok && expired(name) {
+			return true
+		}
+		// 原因表单按目标动作判断
+		if target, ok := value["target"].(string); ok && expired(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// markExpired 将卡片中已过期动作的按钮置灰，expired 为 nil 时表示整张卡片过期
+// 整张卡片过期时标题追加"已过期"并移除下拉框和表单
+func markExpired(card map[string]interface{}, expired func(action string) bool) {
+	if card == nil {
+		return
+	}
+	whole := expired == nil
+
+	if whole {
+		if header, ok := card["header"].(map[string]interface{}); ok {
+			header["template"] = "grey"
+			if title, ok := header["title"].(map[string]interface{}); ok {
+				title["content"] = fmt.Sprintf("%v (已过期)", title["content"])
+			}
+		}
+	}
+
+	elements, _ := card["elements"].([]interface{})
+	kept := make([]interface{}, 0, len(elements))
+	for _, el := range elements {
+		elem, ok := el.(map[string]interface{})
+		if ok && elem["tag"] == "form" {
+			// 表单（验收、原因、回滚版本）无法置灰，提交动作过期后整体移除
+			if !whole && !formExpired(elem, expired) {
+				kept = append(kept, el)
+			}
+			continue
+		}
+		if !ok || elem["tag"] != "action" {
+			kept = append(kept, el)
+			continue
+		}
+		actions, _ := elem["actions"].([]interface{})
+		newActions := make([]interface{}, 0, len(actions))
+		for _, a := range actions {
+			item, ok := a.(map[string]interface{})
+			if !ok {
+				newActions = append(newActions, a)
+				continue
+			}
+			value, _ := item["value"].(map[string]interface{})
+			name, _ := value["action"].(string)
+			if !whole && !expired(name) {
+				newActions = append(newActions, a)
+				continue
+			}
+			if item["tag"] != "button" {
+				// 下拉框无法置灰，过期后直接移除
+				continue
+			}
+			item["disabled"] = true
+			item["type"] = "default"
+			delete(item, "confirm")
+			if text, ok := item["text"].(map[string]interface{}); ok {
+				if content, ok := text["content"].(string); ok && !strings.HasSuffix(content, " (已执行)") {
+					text["content"] = content + " (已过期)"
+				}
+			}
+			newActions = append(newActions, item)
+		}
+		if len(newActions) == 0 {
+			continue
+		}
+		elem["actions"] = newActions
+		kept = append(kept, elem)
+	}
+	card["elements"] = kept
+
+	if whole {
+		card["elements"] = append(kept, map[string]interface{}{
+			"tag": "note",
+			"elements": []interface{}{
+				map[string]interface{}{
+					"tag":     "plain_text",
+					"content": "该发布卡片已过期，如需继续操作请联系管理员续期",
+				},
+			},
+		})
+	}
+}
+
+// ExtendRequestBody 续期请求
+type ExtendRequestBody struct {
+	TTLSeconds int `json:"ttl_seconds"` // 从当前时间起算的有效期，为空时使用默认有效期
+}
+
+// ExtendRequest 延长或恢复发布卡片的有效期
+// 已过期的卡片按钮已置灰无法点击，恢复时会重新发送一张新卡片
+func (h *Handler) ExtendRequest(c *gin.Context) {
+	requestID := c.Param("id")
+
+	var body ExtendRequestBody
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			h.writeError(c, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+			return
+		}
+	}
+	if body.TTLSeconds < 0 {
+		h.writeError(c, http.StatusBadRequest, "ttl_seconds must not be negative")
+		return
+	}
+
+	storedReq, ok := GlobalStore.Get(requestID)
+	if !ok {
+		h.writeError(c, http.StatusNotFound, fmt.Sprintf("request %s not found", requestID))
+		return
+	}
+
+	ttl := time.Duration(body.TTLSeconds) * time.Second
+	if ttl == 0 {
+		ttl = requestTTL(storedReq.OriginalRequest)
+	}
+	if ttl <= 0 {
+		h.writeError(c, http.StatusBadRequest, "ttl_seconds is required when REQUEST_TTL is disabled")
+		return
+	}
+
+	wasExpired, _ := GlobalStore.Extend(requestID, ttl)
+	GlobalAudit.Record(AuditLogModel{
+		RequestID: requestID,
+		Action:    "extend",
+		Operator:  c.ClientIP(),
+		Source:    AuditSourceAPI,
+		Outcome:   AuditAccepted,
+		Detail:    fmt.Sprintf("ttl=%s expired=%t", ttl, wasExpired),
+	})
+	storedReq, _ = GlobalStore.Get(requestID)
+
+	resent := false
+	req := storedReq.OriginalRequest
+	if wasExpired && req.ReceiveID != "" && req.ReceiveIDType != "" {
+		cardBytes, err := json.Marshal(renderStoredCard(requestID, storedReq))
+		if err != nil {
+			h.writeError(c, http.StatusInternalServerError, "Failed to build card content")
+			return
+		}
+		if err := h.senderFor(req.Project).Send(c.Request.Context(), req.ReceiveID, req.ReceiveIDType, "interactive", string(cardBytes)); err != nil {
+			h.logger.Error("Failed to resend revived card: %v", err)
+			h.writeError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to resend card: %v", err))
+			return
+		}
+		resent = true
+	}
+
+	h.writeSuccess(c, map[string]interface{}{
+		"request_id": requestID,
+		"expires_at": storedReq.ExpiresAt,
+		"revived":    wasExpired,
+		"resent":     resent,
+	})
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"devops/feishu/config"
+	"devops/feishu/pkg/feishu"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher/callback"
+)
+
+func TestRequestExpiry(t *testing.T) {
+	client := &feishu.Client{}
+	InitCallbackHandler(client)
+
+	reqID := "test-req-expiry-001"
+	serviceName := "service-expiry"
+	GlobalStore.Save(reqID, GrayCardRequest{
+		Services: []Service{
+			{Name: serviceName, ObjectID: serviceName, Branches: []string{"master", "dev"}, Actions: []string{"gray"}},
+		},
+	})
+
+	newEvent := func(actionName, option string) *callback.CardActionTriggerEvent {
+		return &callback.CardActionTriggerEvent{
+			Event: &callback.CardActionTriggerRequest{
+				Action: &callback.CallBackAction{
+					Option: option,
+					Value: map[string]interface{}{
+						"request_id": reqID,
+						"service":    serviceName,
+						"action":     actionName,
+					},
+				},
+			},
+		}
+	}
+
+	// 模拟卡片已过期
+	storedReq, _ := GlobalStore.Get(reqID)
+	storedReq.ExpiresAt = time.Now().Add(-time.Minute)
+
+	t.Run("expired card refuses clicks", func(t *testing.T) {
+		resp, _ := handleCardAction(context.Background(), newEvent("do_gray_release", ""))
+		if resp.Toast.Type != "warning" || resp.Card == nil {
+			t.Fatalf("Expected warning toast with expired card, got %+v", resp.Toast)
+		}
+		if GlobalStore.GetActionCount(reqID, serviceName, "do_gray_release") != 0 {
+			t.Error("Expired card should not trigger a release")
+		}
+
+		card, _ := resp.Card.Data.(map[string]interface{})
+		header, _ := card["header"].(map[string]interface{})
+		title, _ := header["title"].(map[string]interface{})
+		if content, _ := title["content"].(string); !strings.HasSuffix(content, "(已过期)") {
+			t.Errorf("Expected expired title, got %q", content)
+		}
+		grayBtn := findButton(card, "do_gray_release")
+		if grayBtn == nil || grayBtn["disabled"] != true {
+			t.Error("Gray button should be disabled on an expired card")
+		}
+		if findSelect(card, "select_branch") != nil {
+			t.Error("Branch select should be removed on an expired card")
+		}
+	})
+
+	t.Run("extend revives the card", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		h := &Handler{}
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "id", Value: reqID}}
+		c.Request = httptest.NewRequest(http.MethodPost, "/requests/"+reqID+"/extend", bytes.NewBufferString(`{"ttl_seconds":3600}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+
+		h.ExtendRequest(c)
+		if w.Code != http.StatusOK {
+			t.Fatalf("unexpected status: %d, body: %s", w.Code, w.Body.String())
+		}
+
+		resp, _ := handleCardAction(context.Background(), newEvent("select_branch", "dev"))
+		if resp.Toast.Content != "已选择分支: dev" {
+			t.Errorf("Expected revived card to accept clicks, got %+v", resp.Toast)
+		}
+	})
+
+	t.Run("callback values follow parent action ttl", func(t *testing.T) {
+		cfg, _ := config.LoadConfig()
+		origTTLs := cfg.ActionTTLs
+		defer func() { cfg.ActionTTLs = origTTLs }()
+		cfg.ActionTTLs = map[string]time.Duration{"do_rollback": time.Minute}
+
+		now := time.Now()
+		req := &StoredRequest{CreatedAt: now.Add(-2 * time.Minute), RenewedAt: now.Add(-2 * time.Minute)}
+		for _, value := range []string{"do_rollback", "rollback_version", "cancel_rollback"} {
+			if !req.IsActionExpired(value, now) {
+				t.Errorf("%s should expire with do_rollback", value)
+			}
+		}
+		if req.IsActionExpired("do_gray_release", now) {
+			t.Error("Actions without ttl should not expire")
+		}
+	})
+}
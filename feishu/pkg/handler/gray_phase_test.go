@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"devops/jenkins"
+
+	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher/callback"
+)
+
+func TestGrayPhases(t *testing.T) {
+	InitCallbackHandler(nil)
+
+	reqID := "test-req-gray-phase-001"
+	serviceName := "service-phase"
+	GlobalStore.Save(reqID, GrayCardRequest{
+		Services: []Service{
+			{Name: serviceName, ObjectID: serviceName, Branches: []string{"master"}, Actions: []string{"gray"}, GrayPhases: []int{5, 25, 50, 100}},
+		},
+	})
+
+	phaseButtons := func() []map[string]interface{} {
+		storedReq, _ := GlobalStore.Get(reqID)
+		card := renderStoredCard(reqID, storedReq)
+		var buttons []map[string]interface{}
+		for _, el := range card["elements"].([]interface{}) {
+			elem, _ := el.(map[string]interface{})
+			actions, _ := elem["actions"].([]interface{})
+			for _, a := range actions {
+				btn, _ := a.(map[string]interface{})
+				if value, _ := btn["value"].(map[string]interface{}); value["phase"] != nil {
+					buttons = append(buttons, btn)
+				}
+			}
+		}
+		return buttons
+	}
+
+	buttons := phaseButtons()
+	if len(buttons) != 4 {
+		t.Fatalf("Expected 4 phase buttons, got %d", len(buttons))
+	}
+	if buttons[0]["type"] != "primary" || buttons[1]["type"] != "danger" {
+		t.Errorf("First phase should be next, later phases should require skip confirmation")
+	}
+
+	// 跳到 50%
+	if percent, ok := GlobalStore.AdvanceGrayPhase(reqID, serviceName, 2); !ok || percent != 50 {
+		t.Fatalf("Expected to advance to 50%%, got %d %v", percent, ok)
+	}
+	buttons = phaseButtons()
+	if buttons[0]["disabled"] != true || buttons[1]["disabled"] != true {
+		t.Error("Earlier phases should be disabled")
+	}
+	if buttons[3]["type"] != "primary" {
+		t.Error("100% should be the next phase")
+	}
+
+	// 点击已完成的阶段被拒绝，不计数
+	resp, _ := handleCardAction(context.Background(), &callback.CardActionTriggerEvent{
+		Event: &callback.CardActionTriggerRequest{
+			Action: &callback.CallBackAction{
+				Value: map[string]interface{}{
+					"request_id": reqID,
+					"service":    serviceName,
+					"action":     "do_gray_release",
+					"phase":      "0",
+				},
+			},
+		},
+	})
+	if resp.Toast.Content != "该灰度阶段已完成或无效" {
+		t.Errorf("Expected refusal for completed phase, got %+v", resp.Toast)
+	}
+	if GlobalStore.GetActionCount(reqID, serviceName, "do_gray_release") != 0 {
+		t.Error("Refused phase should not be counted")
+	}
+
+	// 触发前被拒绝（如参数不匹配）的点击不记录阶段，下次仍可触发该阶段
+	origRun, origCheck := runBuild, checkBuildParams
+	defer func() { runBuild, checkBuildParams = origRun, origCheck }()
+	runBuild = func(ctx context.Context, task buildTask) string { return "SUCCESS" }
+	checkBuildParams = func(ctx context.Context, project string, req jenkins.BuildRequest) error {
+		return &jenkins.ParamMismatchError{JobName: req.JobName, Problems: []string{"GRAY_PERCENT is not defined"}}
+	}
+	handleCardAction(context.Background(), &callback.CardActionTriggerEvent{
+		Event: &callback.CardActionTriggerRequest{
+			Action: &callback.CallBackAction{
+				Value: map[string]interface{}{
+					"request_id": reqID,
+					"service":    serviceName,
+					"action":     "do_gray_release",
+					"phase":      "3",
+				},
+			},
+		},
+	})
+	if storedReq, _ := GlobalStore.Get(reqID); findService(storedReq, serviceName).GrayPhase != 3 {
+		t.Errorf("Refused click should not advance the phase, got %d", findService(storedReq, serviceName).GrayPhase)
+	}
+}
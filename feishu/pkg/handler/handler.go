@@ -11,6 +11,7 @@ import (
 
 	"devops/feishu/config"
 	"devops/feishu/pkg/feishu"
+	"devops/jenkins"
 	"devops/tools/ioc"
 	"devops/tools/logger"
 
@@ -33,9 +34,16 @@ func (h *ApiHandler) Init() error {
 
 	client := feishu.NewClient(c)
 	h.handler = NewHandler(client)
+	// 后台淘汰内存中的闲置请求并归档旧请求
+	GlobalStore.StartRetention(context.Background())
+	// 恢复重启前或其他副本计划的自动发布
+	StartPromoteSweep(context.Background())
+	// 定期清理过期的卡片回调幂等记录
+	GlobalDeduper.StartPrune(context.Background())
 
 	root := c.Application.GinRootRouter().Group("feishu")
 	h.Register(root)
+	h.RegisterRoot(c.Application.GinRootRouter())
 
 	return nil
 }
@@ -43,6 +51,24 @@ func (h *ApiHandler) Init() error {
 func (h *ApiHandler) Register(appRouter gin.IRouter) {
 	appRouter.POST("/api/send-card", h.handler.SendCard)
 	appRouter.GET("/version", h.handler.Version)
+
+	// 卡片请求查询和管理
+	appRouter.GET("/requests", h.handler.ListRequests)
+	appRouter.GET("/requests/:id", h.handler.GetRequest)
+	appRouter.GET("/requests/:id/history", h.handler.RequestHistory)
+	appRouter.POST("/requests/:id/extend", h.handler.ExtendRequest)
+	appRouter.POST("/requests/:id/actions/enable", h.handler.EnableRequestAction)
+	appRouter.POST("/requests/:id/counts/reset", h.handler.ResetRequestCounts)
+	appRouter.POST("/requests/:id/resend", h.handler.ResendRequest)
+	appRouter.POST("/requests/:id/close", h.handler.CloseRequest)
+}
+
+// RegisterRoot 注册不在 feishu 分组下的接口
+func (h *ApiHandler) RegisterRoot(appRouter gin.IRouter) {
+	appRouter.GET("/audit", h.handler.AuditLogs)
+	appRouter.GET("/releases", h.handler.ListReleases)
+	appRouter.GET("/releases/:service/latest", h.handler.LatestRelease)
+	appRouter.GET("/jenkins/instances", h.handler.JenkinsInstances)
 }
 
 func mapErrorCode(status int) int {
@@ -139,55 +165,24 @@ func (h *Handler) SendCard(c *gin.Context) {
 	// 填充接收者信息到 GrayCardRequest
 	req.CardData.ReceiveID = req.ReceiveID
 	req.CardData.ReceiveIDType = req.ReceiveIDType
+	if req.Project != "" {
+		req.CardData.Project = req.Project
+	}
 
 	// 保存请求数据以便回调使用
 	GlobalStore.Save(requestID, req.CardData)
+	GlobalAudit.Record(AuditLogModel{
+		RequestID: requestID,
+		Action:    "send_card",
+		Operator:  c.ClientIP(),
+		Source:    AuditSourceAPI,
+		Outcome:   AuditAccepted,
+		Detail:    req.CardData.Title,
+	})
 
 	// 1. 动态构建卡片内容 (V1 Message Card)
 	// 检查是否包含灰度服务，如果包含，则过滤显示
-	displayCardData := req.CardData
-	hasGray := false
-	for _, s := range req.CardData.Services {
-		for _, a := range s.Actions {
-			if strings.EqualFold(a, "gray") || a == "灰度" {
-				hasGray = true
-				break
-			}
-		}
-		if hasGray {
-			break
-		}
-	}
-
-	if hasGray {
-		// 灰度模式：只显示灰度服务，且只显示灰度按钮（或非正式按钮）
-		var filteredServices []Service
-		for _, s := range req.CardData.Services {
-			hasGrayAction := false
-			for _, a := range s.Actions {
-				if strings.EqualFold(a, "gray") || a == "灰度" {
-					hasGrayAction = true
-					break
-				}
-			}
-
-			if hasGrayAction {
-				// 复制服务并过滤动作
-				newService := s
-				newActions := []string{}
-				for _, a := range s.Actions {
-					// 过滤掉正式发布按钮
-					if strings.EqualFold(a, "official") || strings.EqualFold(a, "release") || a == "正式" {
-						continue
-					}
-					newActions = append(newActions, a)
-				}
-				newService.Actions = newActions
-				filteredServices = append(filteredServices, newService)
-			}
-		}
-		displayCardData.Services = filteredServices
-	}
+	displayCardData := GrayView(req.CardData)
 
 	cardContent := BuildCard(displayCardData, requestID, nil, nil)
 
@@ -201,7 +196,7 @@ func (h *Handler) SendCard(c *gin.Context) {
 
 	// 3. 发送消息 (MsgType=interactive)
 	ctx := c.Request.Context()
-	err = h.sender.Send(ctx, req.ReceiveID, req.ReceiveIDType, "interactive", string(cardBytes))
+	err = h.senderFor(req.CardData.Project).Send(ctx, req.ReceiveID, req.ReceiveIDType, "interactive", string(cardBytes))
 	if err != nil {
 		h.logger.Error("Failed to send gray card: %v", err)
 		h.writeError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to send gray card: %v", err))
@@ -213,6 +208,14 @@ func (h *Handler) SendCard(c *gin.Context) {
 	})
 }
 
+// senderFor 返回项目对应飞书应用的发送器，未配置项目应用时使用默认发送器
+func (h *Handler) senderFor(project string) feishu.Sender {
+	if client := feishu.Apps.Client(project); client != nil {
+		return feishu.NewAPISender(client)
+	}
+	return h.sender
+}
+
 // validateSendRequest 验证发送请求
 func (h *Handler) validateSendRequest(req *SendRequest) error {
 	if req.ReceiveID == "" {
@@ -354,6 +357,15 @@ func (h *Handler) Health(c *gin.Context) {
 	})
 }
 
+// JenkinsInstances 返回各 Jenkins 实例的路由配置和最近一次健康检查结果，check=true 时立即检查
+func (h *Handler) JenkinsInstances(c *gin.Context) {
+	if c.Query("check") == "true" {
+		h.writeSuccess(c, jenkins.Instances.CheckHealth(c.Request.Context()))
+		return
+	}
+	h.writeSuccess(c, jenkins.Instances.List())
+}
+
 // Version 版本信息接口
 func (h *Handler) Version(c *gin.Context) {
 	h.writeSuccess(c, map[string]string{
@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"devops/feishu/config"
+	"devops/feishu/pkg/action"
+
+	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher/callback"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CallbackEventModel 卡片回调幂等记录，Key 唯一
+// Key 有两种：event:<事件ID>（飞书重复投递）和 op:<请求>:<服务>:<动作>:<操作人>（连击，CreatedAt 为最近一次受理的时间）
+type CallbackEventModel struct {
+	Key       string    `gorm:"primaryKey;size:191"`
+	RequestID string    `gorm:"size:191;index"`
+	Service   string    `gorm:"size:191"`
+	Action    string    `gorm:"size:64"`
+	Operator  string    `gorm:"size:191"`
+	CreatedAt time.Time `gorm:"index"`
+}
+
+func (CallbackEventModel) TableName() string {
+	return "feishu_callback_events"
+}
+
+// dedupAction 是否为需要按操作人+时间窗口去重的触发类动作
+func dedupAction(value string) bool {
+	switch value {
+	case "batch_release_all", "rollback_version", "submit_reason":
+		return true
+	}
+	for _, name := range []string{action.Gray, action.Official, action.Restart} {
+		if value == action.Default.ValueOf(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// CallbackDeduper 卡片回调去重器，记录持久化到数据库，多副本共享
+// 并发点击只依赖数据库唯一键和条件更新判定，不依赖进程内的锁
+type CallbackDeduper struct{}
+
+var GlobalDeduper = &CallbackDeduper{}
+
+func (d *CallbackDeduper) getDB() *gorm.DB {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Printf("Failed to load config: %v\n", err)
+		return nil
+	}
+	db := cfg.GetDB()
+	if db != nil && !db.Migrator().HasTable(&CallbackEventModel{}) {
+		db.AutoMigrate(&CallbackEventModel{})
+	}
+	return db
+}
+
+func (d *CallbackDeduper) window() time.Duration {
+	if cfg, _ := config.LoadConfig(); cfg != nil && cfg.CallbackDedupWindow > 0 {
+		return cfg.CallbackDedupWindow
+	}
+	return 5 * time.Second
+}
+
+// ttl 幂等记录的保留时间，不短于去重窗口；飞书重复投递通常在数分钟内，默认保留 1 天
+func (d *CallbackDeduper) ttl() time.Duration {
+	ttl := 24 * time.Hour
+	if cfg, _ := config.LoadConfig(); cfg != nil && cfg.CallbackEventTTL > 0 {
+		ttl = cfg.CallbackEventTTL
+	}
+	if window := d.window(); ttl < window {
+		ttl = window
+	}
+	return ttl
+}
+
+// Prune 删除超过保留时间的幂等记录，返回删除的行数
+func (d *CallbackDeduper) Prune(now time.Time) (int64, error) {
+	db := d.getDB()
+	if db == nil {
+		return 0, fmt.Errorf("database is not available")
+	}
+	result := db.Where("created_at < ?", now.Add(-d.ttl())).Delete(&CallbackEventModel{})
+	return result.RowsAffected, result.Error
+}
+
+var pruneOnce sync.Once
+
+// StartPrune 启动后台任务，每小时清理超过 CALLBACK_EVENT_TTL 的幂等记录
+func (d *CallbackDeduper) StartPrune(ctx context.Context) {
+	pruneOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(time.Hour)
+			defer ticker.Stop()
+			for {
+				if n, err := d.Prune(time.Now()); err != nil {
+					fmt.Printf("Callback event pruning failed: %v\n", err)
+				} else if n > 0 {
+					fmt.Printf("Pruned %d callback events\n", n)
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	})
+}
+
+// IsDuplicate 记录本次回调的事件 ID，返回是否为飞书重复投递
+// 数据库不可用时放行，避免影响正常发布
+func (d *CallbackDeduper) IsDuplicate(event *callback.CardActionTriggerEvent, requestID, serviceName, actionName string) bool {
+	eventID := eventIDOf(event)
+	if eventID == "" {
+		return false
+	}
+	db := d.getDB()
+	if db == nil {
+		return false
+	}
+
+	model := CallbackEventModel{
+		Key:       "event:" + eventID,
+		RequestID: requestID,
+		Service:   serviceName,
+		Action:    actionName,
+		Operator:  operatorOf(event),
+		CreatedAt: time.Now(),
+	}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&model)
+	if result.Error != nil {
+		fmt.Printf("Failed to record callback event %s: %v\n", model.Key, result.Error)
+		return false
+	}
+	return result.RowsAffected == 0
+}
+
+// Claim 在触发类动作通过全部检查、即将执行时调用，返回 false 表示同一操作人在去重窗口内已触发过该动作（连击）
+// 被拒绝的点击不调用 Claim，修正后的重试不受影响
+// 每个「请求 + 服务 + 动作 + 操作人」一行：不存在时插入，存在且超过窗口时按时间条件更新，多副本并发时只有一个成功
+// 数据库不可用时放行
+func (d *CallbackDeduper) Claim(requestID, serviceName, actionName, operator string) bool {
+	if operator == "" || !dedupAction(actionName) {
+		return true
+	}
+	db := d.getDB()
+	if db == nil {
+		return true
+	}
+
+	now := time.Now()
+	model := CallbackEventModel{
+		Key:       fmt.Sprintf("op:%s:%s:%s:%s", requestID, serviceName, actionName, operator),
+		RequestID: requestID,
+		Service:   serviceName,
+		Action:    actionName,
+		Operator:  operator,
+		CreatedAt: now,
+	}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&model)
+	if result.Error != nil {
+		fmt.Printf("Failed to record callback event %s: %v\n", model.Key, result.Error)
+		return true
+	}
+	if result.RowsAffected > 0 {
+		return true
+	}
+
+	result = db.Model(&CallbackEventModel{}).
+		Where("`key` = ? AND created_at <= ?", model.Key, now.Add(-d.window())).
+		Update("created_at", now)
+	if result.Error != nil {
+		fmt.Printf("Failed to record callback event %s: %v\n", model.Key, result.Error)
+		return true
+	}
+	return result.RowsAffected > 0
+}
+
+// duplicateResponse 连击时返回当前卡片，不触发任何操作
+func duplicateResponse(requestID string) *callback.CardActionTriggerResponse {
+	resp := refreshCard(requestID, "操作已受理，请勿重复点击")
+	if resp.Toast != nil {
+		resp.Toast.Type = "info"
+	}
+	return resp
+}
+
+// eventIDOf 返回回调事件 ID，缺失时使用卡片回调 token
+func eventIDOf(event *callback.CardActionTriggerEvent) string {
+	if event.EventV2Base != nil && event.EventV2Base.Header != nil && event.EventV2Base.Header.EventID != "" {
+		return event.EventV2Base.Header.EventID
+	}
+	if event.Event != nil {
+		return event.Event.Token
+	}
+	return ""
+}
+
+// operatorOf 返回点击卡片的操作人 open_id
+func operatorOf(event *callback.CardActionTriggerEvent) string {
+	if event.Event != nil && event.Event.Operator != nil {
+		return event.Event.Operator.OpenID
+	}
+	return ""
+}
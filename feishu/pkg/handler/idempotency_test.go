@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"devops/jenkins"
+
+	larkevent "github.com/larksuite/oapi-sdk-go/v3/event"
+	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher/callback"
+)
+
+func TestCallbackDedup(t *testing.T) {
+	// 不发送真实消息
+	InitCallbackHandler(nil)
+
+	reqID := fmt.Sprintf("test-req-dedup-%d", time.Now().UnixNano())
+	serviceName := "service-dedup"
+	GlobalStore.Save(reqID, GrayCardRequest{
+		Services: []Service{
+			{Name: serviceName, ObjectID: serviceName, Branches: []string{"master"}, Actions: []string{"official"}},
+		},
+	})
+
+	newEvent := func(eventID, operator string) *callback.CardActionTriggerEvent {
+		return &callback.CardActionTriggerEvent{
+			EventV2Base: &larkevent.EventV2Base{Header: &larkevent.EventHeader{EventID: eventID}},
+			Event: &callback.CardActionTriggerRequest{
+				Operator: &callback.Operator{OpenID: operator},
+				Action: &callback.CallBackAction{
+					Value: map[string]interface{}{
+						"request_id": reqID,
+						"service":    serviceName,
+						"action":     "do_official_release",
+					},
+				},
+			},
+		}
+	}
+
+	t.Run("Redelivered Event", func(t *testing.T) {
+		event := newEvent(reqID+"-evt-1", "")
+		resp1, _ := handleCardAction(context.Background(), event)
+		if resp1.Toast.Type != "success" {
+			t.Fatalf("Expected success toast, got %+v", resp1.Toast)
+		}
+		resp2, _ := handleCardAction(context.Background(), event)
+		if resp2.Toast.Type != "info" || resp2.Card == nil {
+			t.Errorf("Expected duplicate toast with current card, got %+v", resp2.Toast)
+		}
+		if count := GlobalStore.GetActionCount(reqID, serviceName, "do_official_release"); count != 1 {
+			t.Errorf("Expected action count 1 after redelivery, got %d", count)
+		}
+	})
+
+	t.Run("Double Tap Same Operator", func(t *testing.T) {
+		handleCardAction(context.Background(), newEvent(reqID+"-evt-2", "ou_alice"))
+		resp, _ := handleCardAction(context.Background(), newEvent(reqID+"-evt-3", "ou_alice"))
+		if resp.Toast.Type != "info" {
+			t.Errorf("Expected double tap to be ignored, got %+v", resp.Toast)
+		}
+		// 另一个操作人不受影响
+		resp, _ = handleCardAction(context.Background(), newEvent(reqID+"-evt-4", "ou_bob"))
+		if resp.Toast.Type != "success" {
+			t.Errorf("Expected other operator to pass, got %+v", resp.Toast)
+		}
+		if count := GlobalStore.GetActionCount(reqID, serviceName, "do_official_release"); count != 3 {
+			t.Errorf("Expected action count 3, got %d", count)
+		}
+	})
+
+	t.Run("Refused Click Does Not Block Retry", func(t *testing.T) {
+		origCheck := checkBuildParams
+		defer func() { checkBuildParams = origCheck }()
+		checkBuildParams = func(ctx context.Context, project string, req jenkins.BuildRequest) error {
+			return &jenkins.ParamMismatchError{JobName: req.JobName, Problems: []string{"DEPLOY_TYPE is not defined"}}
+		}
+		resp, _ := handleCardAction(context.Background(), newEvent(reqID+"-evt-5", "ou_carol"))
+		if resp.Toast.Type == "success" {
+			t.Fatalf("Expected mismatch to be refused, got %+v", resp.Toast)
+		}
+		// Job 参数修正后立即重试
+		checkBuildParams = func(ctx context.Context, project string, req jenkins.BuildRequest) error { return nil }
+		resp, _ = handleCardAction(context.Background(), newEvent(reqID+"-evt-6", "ou_carol"))
+		if resp.Toast.Type != "success" {
+			t.Errorf("Expected retry after refusal to pass, got %+v", resp.Toast)
+		}
+	})
+
+	t.Run("Claim After Window", func(t *testing.T) {
+		db := GlobalDeduper.getDB()
+		if db == nil {
+			t.Skip("database is not available")
+		}
+		claim := func() bool { return GlobalDeduper.Claim(reqID, serviceName, "do_restart", "ou_dave") }
+		if !claim() || claim() {
+			t.Fatal("Expected only the first claim within the window to pass")
+		}
+		db.Model(&CallbackEventModel{}).Where("`key` LIKE ?", "op:"+reqID+":%:ou_dave").
+			Update("created_at", time.Now().Add(-time.Minute))
+		if !claim() {
+			t.Error("Expected claim to pass after the window")
+		}
+		if claim() {
+			t.Error("Expected the renewed claim to block a double tap")
+		}
+	})
+
+	t.Run("Prune Old Events", func(t *testing.T) {
+		db := GlobalDeduper.getDB()
+		if db == nil {
+			t.Skip("database is not available")
+		}
+		old := CallbackEventModel{Key: "event:" + reqID + "-old", RequestID: reqID, CreatedAt: time.Now().Add(-48 * time.Hour)}
+		if err := db.Create(&old).Error; err != nil {
+			t.Fatalf("Failed to create event: %v", err)
+		}
+		if _, err := GlobalDeduper.Prune(time.Now()); err != nil {
+			t.Fatalf("Prune failed: %v", err)
+		}
+		var keys []string
+		db.Model(&CallbackEventModel{}).Where("request_id = ?", reqID).Pluck("key", &keys)
+		for _, key := range keys {
+			if key == old.Key {
+				t.Error("Old event should be pruned")
+			}
+		}
+		// 保留时间内的记录不受影响
+		if len(keys) == 0 {
+			t.Error("Recent events should be kept")
+		}
+	})
+}
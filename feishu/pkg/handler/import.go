@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ImportReport 导入旧版文件数据的结果，dry-run 时 Created / Updated 为将要写入的请求
+type ImportReport struct {
+	Created []string          // 新建的请求 ID
+	Updated []string          // 覆盖已存在的请求 ID
+	Skipped map[string]string // 文件名 -> 跳过原因
+	Invalid map[string]string // 文件名 -> 校验失败原因
+}
+
+// ImportRequests 将旧版文件存储（data/requests/req_*.json，每个文件一个 StoredRequest）导入当前存储
+// 文件名去掉 .json 即为请求 ID；已存在的请求会被覆盖。dryRun 时只校验并报告，不写入
+func (s *RequestStore) ImportRequests(dir string, dryRun bool) (*ImportReport, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	db := s.getDB()
+	if db == nil {
+		return nil, fmt.Errorf("database is not available")
+	}
+	s.ensureTable(db)
+
+	report := &ImportReport{Skipped: make(map[string]string), Invalid: make(map[string]string)}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, "req_") || filepath.Ext(name) != ".json" {
+			report.Skipped[name] = "not a request file"
+			continue
+		}
+
+		id := strings.TrimSuffix(name, ".json")
+		req, err := readLegacyFile(filepath.Join(dir, name))
+		if err != nil {
+			report.Invalid[name] = err.Error()
+			continue
+		}
+
+		exists, err := requestExists(db, id)
+		if err != nil {
+			return report, err
+		}
+		if !dryRun {
+			if err := s.importOne(id, req); err != nil {
+				report.Invalid[name] = err.Error()
+				continue
+			}
+		}
+		if exists {
+			report.Updated = append(report.Updated, id)
+		} else {
+			report.Created = append(report.Created, id)
+		}
+	}
+	return report, nil
+}
+
+// readLegacyFile 读取并校验一个旧版请求文件，补齐旧数据缺少的时间字段
+func readLegacyFile(path string) (*StoredRequest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	req, err := decodeLegacyRequest(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	if err := validateStoredRequest(&req); err != nil {
+		return nil, err
+	}
+
+	if req.DisabledActions == nil {
+		req.DisabledActions = make(map[string]bool)
+	}
+	if req.ActionCounts == nil {
+		req.ActionCounts = make(map[string]int)
+	}
+	// 旧文件没有时间字段，以文件修改时间作为创建时间，过期时间按默认有效期计算
+	if req.CreatedAt.IsZero() {
+		if info, err := os.Stat(path); err == nil {
+			req.CreatedAt = info.ModTime()
+		}
+	}
+	if req.RenewedAt.IsZero() {
+		req.RenewedAt = req.CreatedAt
+	}
+	if req.ExpiresAt.IsZero() {
+		req.ExpiresAt = req.Deadline()
+	}
+	return &req, nil
+}
+
+// validateStoredRequest 校验请求至少包含一个服务，服务名不重复，动作状态只引用请求中的服务
+func validateStoredRequest(req *StoredRequest) error {
+	if len(req.OriginalRequest.Services) == 0 {
+		return fmt.Errorf("no services")
+	}
+	names := make(map[string]bool)
+	for i, svc := range req.OriginalRequest.Services {
+		if svc.Name == "" {
+			return fmt.Errorf("service %d has no name", i)
+		}
+		if names[svc.Name] {
+			return fmt.Errorf("duplicate service %s", svc.Name)
+		}
+		names[svc.Name] = true
+	}
+
+	keys := make([]string, 0, len(req.ActionCounts)+len(req.DisabledActions))
+	for key := range req.ActionCounts {
+		keys = append(keys, key)
+	}
+	for key := range req.DisabledActions {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		service, action := splitActionKey(key)
+		if action == "" || !names[service] {
+			return fmt.Errorf("invalid action key %q", key)
+		}
+	}
+	return nil
+}
+
+// requestExists 判断请求是否已在数据库中
+func requestExists(db *gorm.DB, id string) (bool, error) {
+	err := db.Select("id").First(&FeishuRequestModel{}, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// importOne 写入一个导入的请求并刷新本进程缓存
+func (s *RequestStore) importOne(id string, req *StoredRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.saveToDB(id, req); err != nil {
+		return err
+	}
+	s.data.Store(id, req)
+	s.touchLocked(id)
+	return nil
+}
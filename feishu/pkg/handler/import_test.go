@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"devops/feishu/config"
+)
+
+func TestImportRequests(t *testing.T) {
+	cfg, _ := config.LoadConfig()
+	if cfg == nil || cfg.GetDB() == nil {
+		t.Skip("database is not available")
+	}
+	// 配置了默认有效期时，旧文件按文件时间计算过期时间
+	origTTL := cfg.RequestTTL
+	defer func() { cfg.RequestTTL = origTTL }()
+	cfg.RequestTTL = 7 * 24 * time.Hour
+
+	dir := t.TempDir()
+	id := fmt.Sprintf("req_import_%d", time.Now().UnixNano())
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(id+".json", `{"OriginalRequest":{"title":"old","services":[{"name":"svc","object_id":"proj","branches":["master"],"actions":["official"]}]},"DisabledActions":{"svc:do_official_release":true},"ActionCounts":{"svc:do_official_release":1}}`)
+	write("req_empty.json", `{"OriginalRequest":{"services":null},"DisabledActions":{},"ActionCounts":{}}`)
+	write("req_broken.json", `{"OriginalRequest":`)
+	write("req_bad_key.json", `{"OriginalRequest":{"services":[{"name":"svc"}]},"ActionCounts":{"other:do_restart":1}}`)
+	write("notes.txt", "not a request")
+	defer GlobalStore.Delete(id)
+
+	t.Run("dry run", func(t *testing.T) {
+		report, err := GlobalStore.ImportRequests(dir, true)
+		if err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		if len(report.Created) != 1 || len(report.Invalid) != 3 || len(report.Skipped) != 1 {
+			t.Errorf("Unexpected report: %+v", report)
+		}
+		if _, ok := (&RequestStore{}).Get(id); ok {
+			t.Error("Dry run should not write")
+		}
+	})
+
+	t.Run("import", func(t *testing.T) {
+		report, err := GlobalStore.ImportRequests(dir, false)
+		if err != nil || len(report.Created) != 1 || report.Created[0] != id {
+			t.Fatalf("Expected %s to be created, got %+v (%v)", id, report, err)
+		}
+		req, ok := (&RequestStore{}).Get(id)
+		if !ok || req.OriginalRequest.Title != "old" || !req.DisabledActions["svc:do_official_release"] || req.ActionCounts["svc:do_official_release"] != 1 {
+			t.Fatalf("Imported request mismatch: %+v", req)
+		}
+		if req.CreatedAt.IsZero() || req.ExpiresAt.IsZero() {
+			t.Errorf("Imported request should get timestamps, got created=%v expires=%v", req.CreatedAt, req.ExpiresAt)
+		}
+
+		// 重复导入覆盖已存在的请求
+		report, err = GlobalStore.ImportRequests(dir, false)
+		if err != nil || len(report.Updated) != 1 || len(report.Created) != 0 {
+			t.Errorf("Expected %s to be updated, got %+v (%v)", id, report, err)
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"devops/feishu/config"
+)
+
+// mentionTags 生成文本消息中的 @ 标签，忽略空值和重复的 ID
+// 飞书文本消息的 user_id 属性同时支持 open_id 和 user_id
+func mentionTags(ids ...string) string {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, id := range ids {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		tags = append(tags, fmt.Sprintf(`<at user_id="%s"></at>`, id))
+	}
+	return strings.Join(tags, " ")
+}
+
+// isProduction 发布环境是否为生产环境（PROD_ENVIRONMENTS）
+func isProduction(cfg *config.Config, environment string) bool {
+	if cfg == nil || environment == "" {
+		return false
+	}
+	for _, env := range cfg.ProdEnvironments {
+		if strings.EqualFold(env, environment) {
+			return true
+		}
+	}
+	return false
+}
+
+// resultNotice 构建结果通知的文本和需要加急的用户
+// 通知 @ 点击按钮的操作人和发布申请发起人；生产环境构建失败时按配置 @所有人，并返回需要加急的服务负责人
+// 演练的失败不升级通知
+func resultNotice(cfg *config.Config, reqData *StoredRequest, task buildTask, content string, failed bool) (string, []string) {
+	req := reqData.OriginalRequest
+	label := dryRunPrefix(req)
+	mentions := mentionTags(task.Operator, req.Initiator)
+
+	var urgent []string
+	if failed && label == "" && isProduction(cfg, req.Environment) {
+		if cfg.FailureMentionAll {
+			mentions = strings.TrimSpace(`<at user_id="all"></at> ` + mentions)
+		}
+		if svc := findService(reqData, task.Service); cfg.FailureUrgent && svc != nil && svc.Owner != "" {
+			urgent = []string{svc.Owner}
+		}
+	}
+
+	if mentions == "" {
+		return label + content, urgent
+	}
+	return label + content + "\n" + mentions, urgent
+}
+
+// notifyResult 发送构建结果通知，需要时对服务负责人发送应用内加急
+func notifyResult(ctx context.Context, requestID string, task buildTask, content string, failed bool) {
+	reqData, ok := GlobalStore.Get(requestID)
+	if !ok {
+		fmt.Printf("Error: RequestID %s not found in store, cannot send notifications\n", requestID)
+		return
+	}
+	cfg, _ := config.LoadConfig()
+	text, urgent := resultNotice(cfg, reqData, task, content, failed)
+
+	req := reqData.OriginalRequest
+	client := clientFor(req.Project)
+	if client == nil {
+		fmt.Println("Feishu client is nil, cannot send message:", text)
+		return
+	}
+	msgBytes, _ := json.Marshal(map[string]interface{}{"text": text})
+	messageID, err := client.SendMessageWithID(ctx, req.ReceiveID, req.ReceiveIDType, "text", string(msgBytes))
+	if err != nil {
+		fmt.Printf("Failed to send Feishu message: %v\n", err)
+		return
+	}
+	if len(urgent) > 0 {
+		if err := client.UrgentApp(ctx, messageID, "open_id", urgent); err != nil {
+			fmt.Printf("Failed to send urgent notification for %s: %v\n", task.Service, err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"devops/feishu/config"
+)
+
+func TestResultNotice(t *testing.T) {
+	cfg := &config.Config{
+		ProdEnvironments:  []string{"prod", "production"},
+		FailureMentionAll: true,
+		FailureUrgent:     true,
+	}
+	reqData := func(env string) *StoredRequest {
+		return &StoredRequest{OriginalRequest: GrayCardRequest{
+			Environment: env,
+			Initiator:   "u_initiator",
+			Services:    []Service{{Name: "svc", Owner: "ou_owner"}},
+		}}
+	}
+	task := buildTask{Service: "svc", Operator: "ou_ops"}
+
+	t.Run("mention operator and initiator", func(t *testing.T) {
+		text, urgent := resultNotice(cfg, reqData("prod"), task, "✅ 构建成功", false)
+		if text != "✅ 构建成功\n<at user_id=\"ou_ops\"></at> <at user_id=\"u_initiator\"></at>" {
+			t.Errorf("Unexpected text: %q", text)
+		}
+		if len(urgent) != 0 {
+			t.Errorf("Success should not be urgent, got %v", urgent)
+		}
+	})
+
+	t.Run("production failure escalates", func(t *testing.T) {
+		text, urgent := resultNotice(cfg, reqData("PROD"), task, "❌ 构建失败", true)
+		if !strings.Contains(text, `<at user_id="all"></at>`) {
+			t.Errorf("Expected @all, got %q", text)
+		}
+		if !reflect.DeepEqual(urgent, []string{"ou_owner"}) {
+			t.Errorf("Expected owner to be buzzed, got %v", urgent)
+		}
+	})
+
+	t.Run("non production failure", func(t *testing.T) {
+		text, urgent := resultNotice(cfg, reqData("staging"), task, "❌ 构建失败", true)
+		if strings.Contains(text, `user_id="all"`) || len(urgent) != 0 {
+			t.Errorf("Staging failure should not escalate: %q %v", text, urgent)
+		}
+	})
+
+	t.Run("dedupe mentions", func(t *testing.T) {
+		if got := mentionTags("ou_a", "", "ou_a"); got != `<at user_id="ou_a"></at>` {
+			t.Errorf("Unexpected mentions: %q", got)
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+
+	"devops/feishu/pkg/action"
+
+	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher/callback"
+)
+
+// reasonFromForm 读取卡片表单中填写的操作原因和事故单号
+func reasonFromForm(cardAction *callback.CallBackAction) (reason, incidentID string) {
+	if cardAction == nil || cardAction.FormValue == nil {
+		return "", ""
+	}
+	reason, _ = cardAction.FormValue["reason"].(string)
+	incidentID, _ = cardAction.FormValue["incident_id"].(string)
+	return strings.TrimSpace(reason), strings.TrimSpace(incidentID)
+}
+
+// reasonText 返回通知和审计中展示的原因
+func reasonText(reason, incidentID string) string {
+	if reason == "" {
+		return ""
+	}
+	if incidentID != "" {
+		return fmt.Sprintf("%s（事故单：%s）", reason, incidentID)
+	}
+	return reason
+}
+
+// openReasonForm 在卡片上展开动作的原因表单，提交后才触发构建
+func openReasonForm(requestID, serviceName string, def *action.Definition) *callback.CardActionTriggerResponse {
+	if !GlobalStore.SetReasonAction(requestID, serviceName, def.Value) {
+		return toast("请求数据已过期或不存在")
+	}
+	return refreshCard(requestID, fmt.Sprintf("请填写%s原因", plainLabel(def.Label(cardLocale()))))
+}
+
+// plainLabel 去掉按钮文字前的图标，如 "🔄 重启" -> "重启"
+func plainLabel(label string) string {
+	if idx := strings.LastIndex(label, " "); idx >= 0 {
+		return label[idx+1:]
+	}
+	return label
+}
+
+// reasonInputs 原因表单的输入框：原因（必填）和事故单号（选填）
+func reasonInputs() []interface{} {
+	return []interface{}{
+		map[string]interface{}{
+			"tag":      "input",
+			"name":     "reason",
+			"required": true,
+			"placeholder": map[string]interface{}{
+				"tag":     "plain_text",
+				"content": "操作原因（必填）",
+			},
+		},
+		map[string]interface{}{
+			"tag":  "input",
+			"name": "incident_id",
+			"placeholder": map[string]interface{}{
+				"tag":     "plain_text",
+				"content": "事故单号（选填）",
+			},
+		},
+	}
+}
+
+// buildReasonForm 构建等待填写原因的动作表单：原因输入框 + 确认/取消按钮
+func buildReasonForm(service Service, requestID string) []interface{} {
+	label := service.ReasonAction
+	if def, ok := action.Default.ByValue(service.ReasonAction); ok {
+		label = plainLabel(def.Label(cardLocale()))
+	}
+
+	formElements := append(reasonInputs(), map[string]interface{}{
+		"tag": "button",
+		"text": map[string]interface{}{
+			"tag":     "plain_text",
+			"content": "确认" + label,
+		},
+		"type":        "danger",
+		"action_type": "form_submit",
+		"name":        "submit_reason",
+		"value": map[string]interface{}{
+			"action":     "submit_reason",
+			"target":     service.ReasonAction,
+			"service":    service.Name,
+			"request_id": requestID,
+			"branch":     service.CurrentBranch(),
+		},
+	})
+
+	return []interface{}{
+		map[string]interface{}{
+			"tag": "div",
+			"text": map[string]interface{}{
+				"tag":     "lark_md",
+				"content": fmt.Sprintf("📝 **请填写%s原因：**", label),
+			},
+		},
+		map[string]interface{}{
+			"tag":      "form",
+			"name":     "reason_" + service.Name,
+			"elements": formElements,
+		},
+		// 表单内只能放提交按钮，取消按钮单独一行
+		map[string]interface{}{
+			"tag": "action",
+			"actions": []interface{}{
+				map[string]interface{}{
+					"tag": "button",
+					"text": map[string]interface{}{
+						"tag":     "plain_text",
+						"content": "取消",
+					},
+					"type": "default",
+					"value": map[string]interface{}{
+						"action":     "cancel_reason",
+						"service":    service.Name,
+						"request_id": requestID,
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"devops/jenkins"
+
+	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher/callback"
+)
+
+func TestActionReason(t *testing.T) {
+	InitCallbackHandler(nil)
+
+	origRun, origFetch := runBuild, fetchRollbackCandidates
+	defer func() { runBuild, fetchRollbackCandidates = origRun, origFetch }()
+	got := make(chan buildTask, 1)
+	runBuild = func(ctx context.Context, task buildTask) string {
+		got <- task
+		return "SUCCESS"
+	}
+	fetchRollbackCandidates = func(ctx context.Context, project, jobName string, limit int) ([]jenkins.BuildSummary, error) {
+		return []jenkins.BuildSummary{{Number: 7, Branch: "master", ImageVersion: "v7", Timestamp: time.Now()}}, nil
+	}
+
+	reqID := fmt.Sprintf("test-req-reason-%d", time.Now().UnixNano())
+	GlobalStore.Save(reqID, GrayCardRequest{Services: []Service{
+		{Name: "svc", ObjectID: "proj", Branches: []string{"master"}, Actions: []string{"gray"}},
+	}})
+
+	click := func(value map[string]interface{}, form map[string]interface{}) *callback.CardActionTriggerResponse {
+		value["request_id"], value["service"] = reqID, "svc"
+		resp, _ := handleCardAction(context.Background(), &callback.CardActionTriggerEvent{
+			Event: &callback.CardActionTriggerRequest{
+				Operator: &callback.Operator{OpenID: "ou_ops"},
+				Action:   &callback.CallBackAction{Value: value, FormValue: form},
+			},
+		})
+		return resp
+	}
+	expectTask := func(t *testing.T) buildTask {
+		select {
+		case task := <-got:
+			return task
+		case <-time.After(time.Second):
+			t.Fatal("Expected a build to be triggered")
+		}
+		return buildTask{}
+	}
+
+	t.Run("restart opens reason form", func(t *testing.T) {
+		resp := click(map[string]interface{}{"action": "do_restart", "branch": "master"}, nil)
+		card, _ := resp.Card.Data.(map[string]interface{})
+		if findButton(card, "submit_reason") == nil {
+			t.Fatalf("Expected reason form, got %+v", resp.Toast)
+		}
+		select {
+		case task := <-got:
+			t.Fatalf("Restart should wait for a reason, got %+v", task)
+		default:
+		}
+
+		resp = click(map[string]interface{}{"action": "submit_reason", "target": "do_restart"}, map[string]interface{}{"reason": " "})
+		if resp.Toast.Content != "请填写操作原因" {
+			t.Errorf("Expected reason to be required, got %+v", resp.Toast)
+		}
+
+		resp = click(map[string]interface{}{"action": "submit_reason", "target": "do_restart"},
+			map[string]interface{}{"reason": "内存泄漏", "incident_id": "INC-42"})
+		task := expectTask(t)
+		if task.DeployType != "Restart" || task.Reason != "内存泄漏" || task.IncidentID != "INC-42" {
+			t.Errorf("Unexpected task: %+v", task)
+		}
+		card, _ = resp.Card.Data.(map[string]interface{})
+		if findButton(card, "submit_reason") != nil {
+			t.Error("Reason form should be closed after submit")
+		}
+	})
+
+	t.Run("rollback requires reason", func(t *testing.T) {
+		resp := click(map[string]interface{}{"action": "do_rollback"}, nil)
+		card, _ := resp.Card.Data.(map[string]interface{})
+		if findButton(card, "rollback_version") == nil {
+			t.Fatalf("Expected rollback form, got %+v", resp.Toast)
+		}
+
+		resp = click(map[string]interface{}{"action": "rollback_version"}, map[string]interface{}{"version": "7"})
+		if resp.Toast.Content != "请填写回滚原因" {
+			t.Errorf("Expected rollback reason to be required, got %+v", resp.Toast)
+		}
+
+		click(map[string]interface{}{"action": "rollback_version"}, map[string]interface{}{"version": "7", "reason": "支付失败率升高"})
+		task := expectTask(t)
+		if task.DeployType != "Rollback" || task.ImageVersion != "v7" || task.Reason != "支付失败率升高" {
+			t.Errorf("Unexpected task: %+v", task)
+		}
+	})
+}
@@ -0,0 +1,224 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"devops/feishu/config"
+	"devops/tools/middleware"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ReleaseModel 已完成的一次发布构建，供发布历史查询和周报统计
+type ReleaseModel struct {
+	ID           uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	RequestID    string    `gorm:"size:191;index" json:"request_id"`
+	Service      string    `gorm:"size:191;index:idx_release_service_finished" json:"service"`
+	Environment  string    `gorm:"size:64" json:"environment"`
+	Branch       string    `gorm:"size:191" json:"branch"`
+	DeployType   string    `gorm:"size:64" json:"deploy_type"`
+	GrayPercent  int       `json:"gray_percent,omitempty"`
+	ImageVersion string    `gorm:"size:191" json:"image_version"`
+	BuildNumber  int64     `json:"build_number"`
+	Result       string    `gorm:"size:32;index" json:"result"`
+	DurationMs   int64     `json:"duration_ms"`
+	Operator     string    `gorm:"size:191" json:"operator"`
+	Reason       string    `gorm:"size:512" json:"reason,omitempty"`
+	IncidentID   string    `gorm:"size:64" json:"incident_id,omitempty"`
+	StartedAt    time.Time `json:"started_at"`
+	FinishedAt   time.Time `gorm:"index:idx_release_service_finished" json:"finished_at"`
+}
+
+func (ReleaseModel) TableName() string {
+	return "feishu_releases"
+}
+
+// ReleaseHistory 发布历史，写入失败只打印日志，不影响发布流程
+type ReleaseHistory struct {
+	mu       sync.Mutex
+	migrated bool
+}
+
+var GlobalReleases = &ReleaseHistory{}
+
+func (r *ReleaseHistory) getDB() *gorm.DB {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Printf("Failed to load config: %v\n", err)
+		return nil
+	}
+	db := cfg.GetDB()
+	if db == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// 每个进程迁移一次，补齐新增的列
+	if !r.migrated {
+		if err := db.AutoMigrate(&ReleaseModel{}); err != nil {
+			fmt.Printf("Failed to migrate release table: %v\n", err)
+			return nil
+		}
+		r.migrated = true
+	}
+	return db
+}
+
+// Record 保存一次已完成的构建
+func (r *ReleaseHistory) Record(release ReleaseModel) {
+	release.ID = 0
+	db := r.getDB()
+	if db == nil {
+		return
+	}
+	if err := db.Create(&release).Error; err != nil {
+		fmt.Printf("Failed to save release history: %v\n", err)
+	}
+}
+
+// ReleaseFilter 发布历史查询条件，空字段不过滤
+type ReleaseFilter struct {
+	Service     string
+	Environment string
+	DeployType  string
+	Result      string
+	Since       time.Time
+	Until       time.Time
+}
+
+func (f ReleaseFilter) apply(q *gorm.DB) *gorm.DB {
+	if f.Service != "" {
+		q = q.Where("service = ?", f.Service)
+	}
+	if f.Environment != "" {
+		q = q.Where("environment = ?", f.Environment)
+	}
+	if f.DeployType != "" {
+		q = q.Where("deploy_type = ?", f.DeployType)
+	}
+	if f.Result != "" {
+		q = q.Where("result = ?", f.Result)
+	}
+	if !f.Since.IsZero() {
+		q = q.Where("finished_at >= ?", f.Since)
+	}
+	if !f.Until.IsZero() {
+		q = q.Where("finished_at < ?", f.Until)
+	}
+	return q
+}
+
+// Query 按条件分页查询发布历史，按完成时间倒序
+func (r *ReleaseHistory) Query(f ReleaseFilter, page *middleware.PageRequest) ([]ReleaseModel, int64, error) {
+	db := r.getDB()
+	if db == nil {
+		return nil, 0, fmt.Errorf("database is not available")
+	}
+
+	q := f.apply(db.Model(&ReleaseModel{}))
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var releases []ReleaseModel
+	if err := q.Order("finished_at DESC, id DESC").Offset(page.Offset()).Limit(page.PageSize).Find(&releases).Error; err != nil {
+		return nil, 0, err
+	}
+	return releases, total, nil
+}
+
+// Latest 返回服务最近一次完成的发布，不存在时返回 nil
+func (r *ReleaseHistory) Latest(f ReleaseFilter) (*ReleaseModel, error) {
+	db := r.getDB()
+	if db == nil {
+		return nil, fmt.Errorf("database is not available")
+	}
+
+	var release ReleaseModel
+	err := f.apply(db.Model(&ReleaseModel{})).Order("finished_at DESC, id DESC").First(&release).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &release, nil
+}
+
+// releaseFilterFrom 从查询参数构建过滤条件
+func releaseFilterFrom(c *gin.Context) (ReleaseFilter, error) {
+	f := ReleaseFilter{
+		Service:     c.Query("service"),
+		Environment: c.Query("environment"),
+		DeployType:  c.Query("deploy_type"),
+		Result:      c.Query("result"),
+	}
+
+	var err error
+	if f.Since, err = parseQueryTime(c.Query("since")); err != nil {
+		return f, fmt.Errorf("invalid since: %v", err)
+	}
+	if f.Until, err = parseQueryTime(c.Query("until")); err != nil {
+		return f, fmt.Errorf("invalid until: %v", err)
+	}
+	return f, nil
+}
+
+// ListReleases 分页查询发布历史
+func (h *Handler) ListReleases(c *gin.Context) {
+	filter, err := releaseFilterFrom(c)
+	if err != nil {
+		h.writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	page := middleware.NewPageRequestFromContext(c)
+	if page.PageNum <= 0 || page.PageSize <= 0 {
+		h.writeError(c, http.StatusBadRequest, "invalid pagination")
+		return
+	}
+	if page.PageSize > 100 {
+		page.PageSize = 100
+	}
+
+	releases, total, err := GlobalReleases.Query(filter, page)
+	if err != nil {
+		h.writeError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to query releases: %v", err))
+		return
+	}
+	if releases == nil {
+		releases = []ReleaseModel{}
+	}
+	h.writeSuccess(c, map[string]interface{}{
+		"total":    total,
+		"pageNum":  page.PageNum,
+		"pageSize": page.PageSize,
+		"items":    releases,
+	})
+}
+
+// LatestRelease 返回服务最近一次完成的发布
+func (h *Handler) LatestRelease(c *gin.Context) {
+	filter, err := releaseFilterFrom(c)
+	if err != nil {
+		h.writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter.Service = c.Param("service")
+
+	release, err := GlobalReleases.Latest(filter)
+	if err != nil {
+		h.writeError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to query releases: %v", err))
+		return
+	}
+	if release == nil {
+		h.writeError(c, http.StatusNotFound, fmt.Sprintf("no release found for %s", filter.Service))
+		return
+	}
+	h.writeSuccess(c, release)
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReleaseHistory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	service := fmt.Sprintf("svc-release-%d", time.Now().UnixNano())
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for i, result := range []string{"SUCCESS", "FAILURE", "SUCCESS"} {
+		GlobalReleases.Record(ReleaseModel{
+			RequestID:    "test-req-release",
+			Service:      service,
+			Environment:  "prod",
+			Branch:       "master",
+			DeployType:   "Deploy",
+			ImageVersion: fmt.Sprintf("v%d", i+1),
+			BuildNumber:  int64(i + 1),
+			Result:       result,
+			StartedAt:    base.Add(time.Duration(i) * time.Minute),
+			FinishedAt:   base.Add(time.Duration(i)*time.Minute + 30*time.Second),
+		})
+	}
+
+	call := func(handle gin.HandlerFunc, url string, params gin.Params) (int, json.RawMessage) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = params
+		c.Request = httptest.NewRequest(http.MethodGet, url, nil)
+		handle(c)
+		var resp struct {
+			Data json.RawMessage `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Data
+	}
+	h := &Handler{}
+
+	t.Run("list with filters and pagination", func(t *testing.T) {
+		code, data := call(h.ListReleases, "/releases?service="+service+"&result=SUCCESS&page_size=1&page=1", nil)
+		var page struct {
+			Total int64          `json:"total"`
+			Items []ReleaseModel `json:"items"`
+		}
+		json.Unmarshal(data, &page)
+		if code != http.StatusOK || page.Total != 2 || len(page.Items) != 1 {
+			t.Fatalf("Unexpected response %d: %s", code, data)
+		}
+		if page.Items[0].BuildNumber != 3 {
+			t.Errorf("Expected newest release first, got #%d", page.Items[0].BuildNumber)
+		}
+	})
+
+	t.Run("latest", func(t *testing.T) {
+		params := gin.Params{{Key: "service", Value: service}}
+		code, data := call(h.LatestRelease, "/releases/"+service+"/latest?result=FAILURE", params)
+		var release ReleaseModel
+		json.Unmarshal(data, &release)
+		if code != http.StatusOK || release.ImageVersion != "v2" {
+			t.Errorf("Unexpected latest release %d: %s", code, data)
+		}
+
+		if code, _ := call(h.LatestRelease, "/releases/unknown/latest", gin.Params{{Key: "service", Value: "unknown-" + service}}); code != http.StatusNotFound {
+			t.Errorf("Expected 404 for unknown service, got %d", code)
+		}
+	})
+}
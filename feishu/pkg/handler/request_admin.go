@@ -0,0 +1,451 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"devops/feishu/pkg/action"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 请求状态
+const (
+	RequestStateActive  = "active"  // 未过期，按钮可点击
+	RequestStateExpired = "expired" // 已过期
+	RequestStateClosed  = "closed"  // 已被管理员关闭
+)
+
+// State 返回请求当前的状态
+func (r *StoredRequest) State(now time.Time) string {
+	if !r.ClosedAt.IsZero() {
+		return RequestStateClosed
+	}
+	if r.IsExpired(now) {
+		return RequestStateExpired
+	}
+	return RequestStateActive
+}
+
+// RequestFilter 查询请求的条件，零值条件不生效
+type RequestFilter struct {
+	ReceiveID string
+	Service   string
+	Project   string
+	State     string
+	Since     time.Time // 创建时间下界（含）
+	Until     time.Time // 创建时间上界（不含）
+	Limit     int
+	Offset    int
+}
+
+// RequestSummary 请求列表中的一项
+type RequestSummary struct {
+	ID            string     `json:"id"`
+	Title         string     `json:"title"`
+	Project       string     `json:"project,omitempty"`
+	Environment   string     `json:"environment,omitempty"`
+	Initiator     string     `json:"initiator,omitempty"`
+	ReceiveID     string     `json:"receive_id"`
+	ReceiveIDType string     `json:"receive_id_type"`
+	Services      []string   `json:"services"`
+	State         string     `json:"state"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	ClosedAt      *time.Time `json:"closed_at,omitempty"`
+}
+
+// Query 按条件查询请求，最新创建的在前，返回当前页和总数
+// 未设置过期时间的旧数据按永不过期处理，迁移和导入时会补齐过期时间
+func (s *RequestStore) Query(f RequestFilter) ([]RequestSummary, int64, error) {
+	db := s.getDB()
+	if db == nil {
+		return nil, 0, fmt.Errorf("database is not available")
+	}
+	s.ensureTable(db)
+
+	now := time.Now()
+	q := db.Model(&FeishuRequestModel{})
+	if f.ReceiveID != "" {
+		q = q.Where("receive_id = ?", f.ReceiveID)
+	}
+	if f.Project != "" {
+		q = q.Where("project = ?", f.Project)
+	}
+	if f.Service != "" {
+		q = q.Where("id IN (?)", db.Model(&RequestServiceModel{}).Select("request_id").Where("name = ?", f.Service))
+	}
+	switch f.State {
+	case "":
+	case RequestStateClosed:
+		q = q.Where("closed_at IS NOT NULL")
+	case RequestStateExpired:
+		q = q.Where("closed_at IS NULL AND expires_at IS NOT NULL AND expires_at < ?", now)
+	case RequestStateActive:
+		q = q.Where("closed_at IS NULL AND (expires_at IS NULL OR expires_at >= ?)", now)
+	default:
+		return nil, 0, fmt.Errorf("unknown state: %s", f.State)
+	}
+	if !f.Since.IsZero() {
+		q = q.Where("created_at >= ?", f.Since)
+	}
+	if !f.Until.IsZero() {
+		q = q.Where("created_at < ?", f.Until)
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var headers []FeishuRequestModel
+	if err := q.Order("created_at DESC, id DESC").Limit(f.Limit).Offset(f.Offset).Find(&headers).Error; err != nil {
+		return nil, 0, err
+	}
+
+	ids := make([]string, 0, len(headers))
+	for _, h := range headers {
+		ids = append(ids, h.ID)
+	}
+	services := make(map[string][]string)
+	if len(ids) > 0 {
+		var rows []RequestServiceModel
+		if err := db.Select("request_id", "name").Where("request_id IN ?", ids).Order("request_id, ordinal").Find(&rows).Error; err != nil {
+			return nil, 0, err
+		}
+		for _, r := range rows {
+			services[r.RequestID] = append(services[r.RequestID], r.Name)
+		}
+	}
+
+	items := make([]RequestSummary, 0, len(headers))
+	for _, h := range headers {
+		state := RequestStateActive
+		if h.ClosedAt != nil {
+			state = RequestStateClosed
+		} else if h.ExpiresAt != nil && now.After(*h.ExpiresAt) {
+			state = RequestStateExpired
+		}
+		items = append(items, RequestSummary{
+			ID:            h.ID,
+			Title:         h.Title,
+			Project:       h.Project,
+			Environment:   h.Environment,
+			Initiator:     h.Initiator,
+			ReceiveID:     h.ReceiveID,
+			ReceiveIDType: h.ReceiveIDType,
+			Services:      services[h.ID],
+			State:         state,
+			CreatedAt:     h.CreatedAt,
+			UpdatedAt:     h.UpdatedAt,
+			ExpiresAt:     h.ExpiresAt,
+			ClosedAt:      h.ClosedAt,
+		})
+	}
+	return items, total, nil
+}
+
+// EnableAction 重新启用被禁用的动作，动作此前未被禁用时返回 false
+func (s *RequestStore) EnableAction(id, serviceName, action string) bool {
+	return s.mutate(id, func(req *StoredRequest) bool {
+		key := serviceName + ":" + action
+		if !req.DisabledActions[key] {
+			return false
+		}
+		delete(req.DisabledActions, key)
+		return true
+	})
+}
+
+// ResetActionCounts 清零动作执行次数，serviceName / action 为空时匹配全部，返回清零的条目数
+func (s *RequestStore) ResetActionCounts(id, serviceName, action string) (int, bool) {
+	reset := 0
+	ok := s.mutate(id, func(req *StoredRequest) bool {
+		reset = 0
+		for key := range req.ActionCounts {
+			svc, act := splitActionKey(key)
+			if (serviceName == "" || svc == serviceName) && (action == "" || act == action) {
+				delete(req.ActionCounts, key)
+				reset++
+			}
+		}
+		return true
+	})
+	return reset, ok
+}
+
+// SetReceiver 修改卡片和构建通知的接收者
+func (s *RequestStore) SetReceiver(id, receiveID, receiveIDType string) bool {
+	return s.mutate(id, func(req *StoredRequest) bool {
+		req.OriginalRequest.ReceiveID = receiveID
+		req.OriginalRequest.ReceiveIDType = receiveIDType
+		return true
+	})
+}
+
+// Close 关闭请求：立即过期，卡片上的按钮不再可用，并取消计划中的自动发布；续期会重新打开
+func (s *RequestStore) Close(id string) (alreadyClosed bool, ok bool) {
+	ok = s.mutate(id, func(req *StoredRequest) bool {
+		alreadyClosed = !req.ClosedAt.IsZero()
+		if alreadyClosed {
+			return false
+		}
+		now := time.Now()
+		req.ClosedAt = now
+		req.ExpiresAt = now
+		// 关闭后不再自动发布
+		for i := range req.OriginalRequest.Services {
+			req.OriginalRequest.Services[i].PromoteAt = 0
+			req.OriginalRequest.Services[i].PromoteNoticeSent = false
+		}
+		return true
+	})
+	if alreadyClosed {
+		return true, true
+	}
+	return false, ok
+}
+
+// requestFilterFrom 解析列表接口的查询参数
+func requestFilterFrom(c *gin.Context) (RequestFilter, error) {
+	f := RequestFilter{
+		ReceiveID: c.Query("receive_id"),
+		Service:   c.Query("service"),
+		Project:   c.Query("project"),
+		State:     c.Query("state"),
+		Limit:     100,
+	}
+	switch f.State {
+	case "", RequestStateActive, RequestStateExpired, RequestStateClosed:
+	default:
+		return f, fmt.Errorf("invalid state: %s", f.State)
+	}
+
+	var err error
+	if f.Since, err = parseQueryTime(c.Query("since")); err != nil {
+		return f, fmt.Errorf("invalid since: %v", err)
+	}
+	if f.Until, err = parseQueryTime(c.Query("until")); err != nil {
+		return f, fmt.Errorf("invalid until: %v", err)
+	}
+	if v := c.Query("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit <= 0 {
+			return f, fmt.Errorf("invalid limit: %s", v)
+		}
+	}
+	if f.Limit > 1000 {
+		f.Limit = 1000
+	}
+	if v := c.Query("offset"); v != "" {
+		if f.Offset, err = strconv.Atoi(v); err != nil || f.Offset < 0 {
+			return f, fmt.Errorf("invalid offset: %s", v)
+		}
+	}
+	return f, nil
+}
+
+// ListRequests 按接收者、服务、项目、创建时间和状态查询卡片请求
+func (h *Handler) ListRequests(c *gin.Context) {
+	filter, err := requestFilterFrom(c)
+	if err != nil {
+		h.writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	items, total, err := GlobalStore.Query(filter)
+	if err != nil {
+		h.writeError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to query requests: %v", err))
+		return
+	}
+	h.writeSuccess(c, map[string]interface{}{
+		"total": total,
+		"items": items,
+	})
+}
+
+// GetRequest 返回请求的完整数据，包括每个动作的执行次数和禁用状态
+func (h *Handler) GetRequest(c *gin.Context) {
+	requestID := c.Param("id")
+	storedReq, ok := GlobalStore.Get(requestID)
+	if !ok {
+		h.writeError(c, http.StatusNotFound, fmt.Sprintf("request %s not found", requestID))
+		return
+	}
+	h.writeSuccess(c, requestDetailView(requestID, storedReq))
+}
+
+func requestDetailView(requestID string, storedReq *StoredRequest) map[string]interface{} {
+	view := map[string]interface{}{
+		"request_id":       requestID,
+		"state":            storedReq.State(time.Now()),
+		"request":          storedReq.OriginalRequest,
+		"action_counts":    storedReq.ActionCounts,
+		"disabled_actions": storedReq.DisabledActions,
+		"builds":           storedReq.Builds,
+		"batch":            storedReq.Batch,
+		"created_at":       storedReq.CreatedAt,
+		"renewed_at":       storedReq.RenewedAt,
+		"service_state":    serviceStateView(storedReq.OriginalRequest.Services),
+	}
+	if deadline := storedReq.Deadline(); !deadline.IsZero() {
+		view["expires_at"] = deadline
+	}
+	if !storedReq.ClosedAt.IsZero() {
+		view["closed_at"] = storedReq.ClosedAt
+	}
+	return view
+}
+
+// serviceStateView 服务端维护的服务状态（不随 request 输出），key 为服务名
+func serviceStateView(services []Service) map[string]interface{} {
+	view := make(map[string]interface{}, len(services))
+	for _, svc := range services {
+		view[svc.Name] = map[string]interface{}{
+			"gray_phase":    svc.GrayPhase,
+			"promote_at":    svc.PromoteAt,
+			"reason_action": svc.ReasonAction,
+			"acceptance":    svc.Acceptance,
+		}
+	}
+	return view
+}
+
+// RequestActionBody 管理接口中指定服务和动作的请求体
+type RequestActionBody struct {
+	Service string `json:"service"`
+	Action  string `json:"action"` // 动作名、别名或按钮回调值，如 gray / do_gray_release
+}
+
+// actionValue 将动作名或别名转换为按钮回调值，已是回调值或未注册时原样返回
+func actionValue(name string) string {
+	if _, ok := action.Default.ByValue(name); ok {
+		return name
+	}
+	if def, ok := action.Default.Lookup(name); ok {
+		return def.Value
+	}
+	return name
+}
+
+// EnableRequestAction 重新启用请求中被禁用的动作
+func (h *Handler) EnableRequestAction(c *gin.Context) {
+	requestID := c.Param("id")
+	var body RequestActionBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		h.writeError(c, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+		return
+	}
+	if body.Service == "" || body.Action == "" {
+		h.writeError(c, http.StatusBadRequest, "service and action are required")
+		return
+	}
+	if _, ok := GlobalStore.Get(requestID); !ok {
+		h.writeError(c, http.StatusNotFound, fmt.Sprintf("request %s not found", requestID))
+		return
+	}
+
+	value := actionValue(body.Action)
+	if !GlobalStore.EnableAction(requestID, body.Service, value) {
+		h.writeError(c, http.StatusConflict, fmt.Sprintf("action %s of %s is not disabled", value, body.Service))
+		return
+	}
+	h.auditAdmin(c, requestID, body.Service, "enable_action", value)
+	h.writeRequestDetail(c, requestID)
+}
+
+// ResetRequestCounts 清零动作执行次数，service / action 为空时清零全部
+func (h *Handler) ResetRequestCounts(c *gin.Context) {
+	requestID := c.Param("id")
+	var body RequestActionBody
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			h.writeError(c, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+			return
+		}
+	}
+
+	value := body.Action
+	if value != "" {
+		value = actionValue(value)
+	}
+	reset, ok := GlobalStore.ResetActionCounts(requestID, body.Service, value)
+	if !ok {
+		h.writeError(c, http.StatusNotFound, fmt.Sprintf("request %s not found", requestID))
+		return
+	}
+	h.auditAdmin(c, requestID, body.Service, "reset_counts", fmt.Sprintf("action=%s reset=%d", value, reset))
+	h.writeRequestDetail(c, requestID)
+}
+
+// ResendRequestBody 重新发送卡片的请求体
+type ResendRequestBody struct {
+	ReceiveID     string `json:"receive_id" binding:"required"`
+	ReceiveIDType string `json:"receive_id_type" binding:"required"`
+}
+
+// ResendRequest 将卡片发送给新的接收者，之后的构建通知也发给新接收者
+func (h *Handler) ResendRequest(c *gin.Context) {
+	requestID := c.Param("id")
+	var body ResendRequestBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		h.writeError(c, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+		return
+	}
+	if !GlobalStore.SetReceiver(requestID, body.ReceiveID, body.ReceiveIDType) {
+		h.writeError(c, http.StatusNotFound, fmt.Sprintf("request %s not found", requestID))
+		return
+	}
+	storedReq, _ := GlobalStore.Get(requestID)
+
+	cardBytes, err := json.Marshal(renderStoredCard(requestID, storedReq))
+	if err != nil {
+		h.writeError(c, http.StatusInternalServerError, "Failed to build card content")
+		return
+	}
+	if err := h.senderFor(storedReq.OriginalRequest.Project).Send(c.Request.Context(), body.ReceiveID, body.ReceiveIDType, "interactive", string(cardBytes)); err != nil {
+		h.logger.Error("Failed to resend card: %v", err)
+		h.writeError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to resend card: %v", err))
+		return
+	}
+	h.auditAdmin(c, requestID, "", "resend", fmt.Sprintf("%s:%s", body.ReceiveIDType, body.ReceiveID))
+	h.writeSuccess(c, requestDetailView(requestID, storedReq))
+}
+
+// CloseRequest 关闭请求，卡片上的按钮不再可用
+func (h *Handler) CloseRequest(c *gin.Context) {
+	requestID := c.Param("id")
+	alreadyClosed, ok := GlobalStore.Close(requestID)
+	if !ok {
+		h.writeError(c, http.StatusNotFound, fmt.Sprintf("request %s not found", requestID))
+		return
+	}
+	if !alreadyClosed {
+		h.auditAdmin(c, requestID, "", "close", "")
+	}
+	h.writeRequestDetail(c, requestID)
+}
+
+func (h *Handler) writeRequestDetail(c *gin.Context, requestID string) {
+	storedReq, ok := GlobalStore.Get(requestID)
+	if !ok {
+		h.writeError(c, http.StatusNotFound, fmt.Sprintf("request %s not found", requestID))
+		return
+	}
+	h.writeSuccess(c, requestDetailView(requestID, storedReq))
+}
+
+// auditAdmin 记录管理接口的操作
+func (h *Handler) auditAdmin(c *gin.Context, requestID, service, act, detail string) {
+	GlobalAudit.Record(AuditLogModel{
+		RequestID: requestID,
+		Service:   service,
+		Action:    act,
+		Operator:  c.ClientIP(),
+		Source:    AuditSourceAPI,
+		Outcome:   AuditAccepted,
+		Detail:    detail,
+	})
+}
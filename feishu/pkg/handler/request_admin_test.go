@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"devops/feishu/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordingSender 记录发送的消息
+type recordingSender struct {
+	receivers []string
+}
+
+func (s *recordingSender) Send(ctx context.Context, receiveID, receiveIDType, msgType, content string) error {
+	s.receivers = append(s.receivers, receiveIDType+":"+receiveID)
+	return nil
+}
+
+func TestRequestAdminAPI(t *testing.T) {
+	if cfg, _ := config.LoadConfig(); cfg == nil || cfg.GetDB() == nil {
+		t.Skip("database is not available")
+	}
+
+	gin.SetMode(gin.TestMode)
+	sender := &recordingSender{}
+	h := &Handler{sender: sender}
+	router := gin.New()
+	(&ApiHandler{handler: h}).Register(router)
+
+	call := func(method, path, body string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		router.ServeHTTP(w, req)
+		var resp struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Data
+	}
+
+	receiver := fmt.Sprintf("oc_admin_%d", time.Now().UnixNano())
+	service := fmt.Sprintf("svc-admin-%d", time.Now().UnixNano())
+	id := fmt.Sprintf("test-req-admin-%d", time.Now().UnixNano())
+	GlobalStore.Save(id, GrayCardRequest{ReceiveID: receiver, ReceiveIDType: "chat_id", TTLSeconds: 3600, Services: []Service{
+		{Name: service, ObjectID: "proj", Branches: []string{"master"}, Actions: []string{"gray", "official"}},
+	}})
+	defer GlobalStore.Delete(id)
+	GlobalStore.MarkActionDisabled(id, service, "do_gray_release")
+	GlobalStore.IncrementActionCount(id, service, "do_gray_release")
+
+	t.Run("list and get", func(t *testing.T) {
+		code, data := call(http.MethodGet, "/requests?service="+service+"&state=active", "")
+		items, _ := data["items"].([]interface{})
+		if code != http.StatusOK || len(items) != 1 {
+			t.Fatalf("Expected one active request, got %d %v", code, data)
+		}
+		if code, data = call(http.MethodGet, "/requests?receive_id="+receiver+"&state=closed", ""); data["total"] != float64(0) {
+			t.Errorf("Expected no closed requests, got %d %v", code, data)
+		}
+		if code, _ = call(http.MethodGet, "/requests?state=unknown", ""); code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for unknown state, got %d", code)
+		}
+
+		code, data = call(http.MethodGet, "/requests/"+id, "")
+		counts, _ := data["action_counts"].(map[string]interface{})
+		disabled, _ := data["disabled_actions"].(map[string]interface{})
+		if code != http.StatusOK || counts[service+":do_gray_release"] != float64(1) || disabled[service+":do_gray_release"] != true {
+			t.Errorf("Unexpected request detail: %d %v", code, data)
+		}
+		if code, _ = call(http.MethodGet, "/requests/missing-request", ""); code != http.StatusNotFound {
+			t.Errorf("Expected 404, got %d", code)
+		}
+	})
+
+	t.Run("enable action and reset counts", func(t *testing.T) {
+		body := fmt.Sprintf(`{"service":%q,"action":"gray"}`, service)
+		if code, _ := call(http.MethodPost, "/requests/"+id+"/actions/enable", body); code != http.StatusOK {
+			t.Fatalf("Enable failed: %d", code)
+		}
+		if GlobalStore.IsActionDisabled(id, service, "do_gray_release") {
+			t.Error("Action should be enabled")
+		}
+		if code, _ := call(http.MethodPost, "/requests/"+id+"/actions/enable", body); code != http.StatusConflict {
+			t.Errorf("Enabling an enabled action should conflict, got %d", code)
+		}
+
+		if code, _ := call(http.MethodPost, "/requests/"+id+"/counts/reset", ""); code != http.StatusOK {
+			t.Fatalf("Reset failed: %d", code)
+		}
+		if GlobalStore.GetActionCount(id, service, "do_gray_release") != 0 {
+			t.Error("Counts should be reset")
+		}
+	})
+
+	t.Run("resend to another receiver", func(t *testing.T) {
+		code, _ := call(http.MethodPost, "/requests/"+id+"/resend", `{"receive_id":"ou_other","receive_id_type":"open_id"}`)
+		if code != http.StatusOK || len(sender.receivers) != 1 || sender.receivers[0] != "open_id:ou_other" {
+			t.Fatalf("Expected card to be resent, got %d %v", code, sender.receivers)
+		}
+		if req, _ := GlobalStore.Get(id); req.OriginalRequest.ReceiveID != "ou_other" {
+			t.Errorf("Receiver should be updated, got %s", req.OriginalRequest.ReceiveID)
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		code, data := call(http.MethodPost, "/requests/"+id+"/close", "")
+		if code != http.StatusOK || data["state"] != RequestStateClosed {
+			t.Fatalf("Expected closed request, got %d %v", code, data)
+		}
+		if req, _ := GlobalStore.Get(id); !req.IsExpired(time.Now().Add(time.Second)) {
+			t.Error("Closed request should be expired")
+		}
+		if _, data = call(http.MethodGet, "/requests?service="+service+"&state=closed", ""); data["total"] != float64(1) {
+			t.Errorf("Expected closed request in list, got %v", data)
+		}
+	})
+}
@@ -0,0 +1,530 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"devops/feishu/pkg/action"
+
+	"gorm.io/gorm"
+)
+
+// 发布请求按关系表存储：
+//   feishu_requests          请求头（接收者、有效期、版本号等），构建记录等嵌套数据存于 detail
+//   feishu_request_services  请求中的服务及其状态（选中分支、灰度阶段、验收状态等）
+//   feishu_service_actions   服务上每个动作的点击次数和禁用状态
+// 旧版本把整个 StoredRequest 序列化到 feishu_requests.data，启动时由 migrateLegacyRequests 转换
+
+// RequestServiceModel 请求中的一个服务
+type RequestServiceModel struct {
+	ID               uint64 `gorm:"primaryKey;autoIncrement"`
+	RequestID        string `gorm:"size:191;index:idx_request_service"`
+	Name             string `gorm:"size:191;index:idx_request_service;index"`
+	Ordinal          int    // 服务在卡片上的顺序
+	ObjectID         string `gorm:"size:191"`
+	SelectedBranch   string `gorm:"size:191"`
+	GrayPhase        int
+	PromoteAt        int64
+	ReasonAction     string `gorm:"size:64"`
+	Owner            string `gorm:"size:191"`
+	AcceptanceStatus string `gorm:"size:32;index"`
+	Official         bool   `gorm:"index"`     // 服务是否配置了正式发布动作
+	Detail           string `gorm:"type:text"` // serviceDetail 的 JSON
+}
+
+func (RequestServiceModel) TableName() string {
+	return "feishu_request_services"
+}
+
+// ServiceActionModel 服务上一个动作的点击次数和禁用状态
+type ServiceActionModel struct {
+	ID        uint64 `gorm:"primaryKey;autoIncrement"`
+	RequestID string `gorm:"size:191;uniqueIndex:idx_service_action"`
+	Service   string `gorm:"size:191;uniqueIndex:idx_service_action"`
+	Action    string `gorm:"size:64;uniqueIndex:idx_service_action;index"`
+	Count     int
+	Disabled  bool
+}
+
+func (ServiceActionModel) TableName() string {
+	return "feishu_service_actions"
+}
+
+// requestDetail 请求头中不需要按列查询的嵌套数据
+type requestDetail struct {
+	Testers       []string      `json:"testers,omitempty"`
+	Plan          *ReleasePlan  `json:"plan,omitempty"`
+	DryRunResult  string        `json:"dry_run_result,omitempty"`
+	DryRunSeconds int           `json:"dry_run_seconds,omitempty"`
+	Builds        []BuildRecord `json:"builds,omitempty"`
+	Batch         *BatchState   `json:"batch,omitempty"`
+}
+
+// serviceDetail 服务中不需要按列查询的配置和嵌套数据
+type serviceDetail struct {
+	Branches        []string           `json:"branches,omitempty"`
+	Actions         []string           `json:"actions,omitempty"`
+	DependsOn       []string           `json:"depends_on,omitempty"`
+	GrayPhases      []int              `json:"gray_phases,omitempty"`
+	AutoPromote     *AutoPromotePolicy `json:"auto_promote,omitempty"`
+	NoticeSent      bool               `json:"promote_notice_sent,omitempty"`
+	Testers         []string           `json:"testers,omitempty"`
+	RollbackOptions []RollbackOption   `json:"rollback_options,omitempty"`
+	Acceptance      *Acceptance        `json:"acceptance,omitempty"`
+}
+
+// requestRows 一个请求对应的全部行
+type requestRows struct {
+	header   FeishuRequestModel
+	services []RequestServiceModel
+	actions  []ServiceActionModel
+}
+
+// toRows 将请求拆分为请求头、服务和动作行，请求头的版本号和时间戳由调用方填写
+func toRows(id string, req *StoredRequest) (requestRows, error) {
+	orig := req.OriginalRequest
+	detail, err := json.Marshal(requestDetail{
+		Testers:       orig.Testers,
+		Plan:          orig.Plan,
+		DryRunResult:  orig.DryRunResult,
+		DryRunSeconds: orig.DryRunSeconds,
+		Builds:        req.Builds,
+		Batch:         req.Batch,
+	})
+	if err != nil {
+		return requestRows{}, err
+	}
+
+	rows := requestRows{header: FeishuRequestModel{
+		ID:            id,
+		Title:         orig.Title,
+		ObjectID:      orig.ObjectID,
+		Project:       orig.Project,
+		Environment:   orig.Environment,
+		Initiator:     orig.Initiator,
+		ReceiveID:     orig.ReceiveID,
+		ReceiveIDType: orig.ReceiveIDType,
+		DryRun:        orig.DryRun,
+		TTLSeconds:    orig.TTLSeconds,
+		RenewedAt:     timePtr(req.RenewedAt),
+		ExpiresAt:     timePtr(req.ExpiresAt),
+		ClosedAt:      timePtr(req.ClosedAt),
+		SummarySent:   req.SummarySent,
+		Detail:        string(detail),
+		CreatedAt:     req.CreatedAt,
+	}}
+
+	for i, svc := range orig.Services {
+		svcDetail, err := json.Marshal(serviceDetail{
+			Branches:        svc.Branches,
+			Actions:         svc.Actions,
+			DependsOn:       svc.DependsOn,
+			GrayPhases:      svc.GrayPhases,
+			AutoPromote:     svc.AutoPromote,
+			NoticeSent:      svc.PromoteNoticeSent,
+			Testers:         svc.Testers,
+			RollbackOptions: svc.RollbackOptions,
+			Acceptance:      svc.Acceptance,
+		})
+		if err != nil {
+			return requestRows{}, err
+		}
+		model := RequestServiceModel{
+			RequestID:      id,
+			Name:           svc.Name,
+			Ordinal:        i,
+			ObjectID:       svc.ObjectID,
+			SelectedBranch: svc.SelectedBranch,
+			GrayPhase:      svc.GrayPhase,
+			PromoteAt:      svc.PromoteAt,
+			ReasonAction:   svc.ReasonAction,
+			Owner:          svc.Owner,
+			Detail:         string(svcDetail),
+		}
+		if svc.Acceptance != nil {
+			model.AcceptanceStatus = svc.Acceptance.Status
+		}
+		for _, a := range svc.Actions {
+			if action.Default.Is(a, action.Official) {
+				model.Official = true
+			}
+		}
+		rows.services = append(rows.services, model)
+	}
+
+	// 点击次数和禁用状态合并为一行
+	index := make(map[string]int)
+	action := func(key string) *ServiceActionModel {
+		if i, ok := index[key]; ok {
+			return &rows.actions[i]
+		}
+		service, name := splitActionKey(key)
+		index[key] = len(rows.actions)
+		rows.actions = append(rows.actions, ServiceActionModel{RequestID: id, Service: service, Action: name})
+		return &rows.actions[len(rows.actions)-1]
+	}
+	for key, count := range req.ActionCounts {
+		action(key).Count = count
+	}
+	for key, disabled := range req.DisabledActions {
+		if disabled {
+			action(key).Disabled = true
+		}
+	}
+	return rows, nil
+}
+
+// clone 深拷贝请求，经由关系表的行结构转换，不访问数据库
+func (r *StoredRequest) clone(id string) (*StoredRequest, error) {
+	rows, err := toRows(id, r)
+	if err != nil {
+		return nil, err
+	}
+	rows.header.Version = r.version
+	return fromRows(rows)
+}
+
+// splitActionKey 拆分 "serviceName:action" 形式的键
+func splitActionKey(key string) (service, action string) {
+	if i := strings.LastIndex(key, ":"); i >= 0 {
+		return key[:i], key[i+1:]
+	}
+	return key, ""
+}
+
+// fromRows 由请求头、服务和动作行还原请求
+func fromRows(rows requestRows) (*StoredRequest, error) {
+	h := rows.header
+	var detail requestDetail
+	if h.Detail != "" {
+		if err := json.Unmarshal([]byte(h.Detail), &detail); err != nil {
+			return nil, fmt.Errorf("invalid request detail: %v", err)
+		}
+	}
+
+	req := &StoredRequest{
+		OriginalRequest: GrayCardRequest{
+			Title:         h.Title,
+			ObjectID:      h.ObjectID,
+			Project:       h.Project,
+			Environment:   h.Environment,
+			Testers:       detail.Testers,
+			Initiator:     h.Initiator,
+			DryRun:        h.DryRun,
+			DryRunResult:  detail.DryRunResult,
+			DryRunSeconds: detail.DryRunSeconds,
+			TTLSeconds:    h.TTLSeconds,
+			Plan:          detail.Plan,
+			ReceiveID:     h.ReceiveID,
+			ReceiveIDType: h.ReceiveIDType,
+		},
+		DisabledActions: make(map[string]bool),
+		ActionCounts:    make(map[string]int),
+		CreatedAt:       h.CreatedAt,
+		RenewedAt:       timeOf(h.RenewedAt),
+		ExpiresAt:       timeOf(h.ExpiresAt),
+		ClosedAt:        timeOf(h.ClosedAt),
+		Builds:          detail.Builds,
+		SummarySent:     h.SummarySent,
+		Batch:           detail.Batch,
+		version:         h.Version,
+	}
+
+	for _, m := range rows.services {
+		var sd serviceDetail
+		if m.Detail != "" {
+			if err := json.Unmarshal([]byte(m.Detail), &sd); err != nil {
+				return nil, fmt.Errorf("invalid service detail %s: %v", m.Name, err)
+			}
+		}
+		req.OriginalRequest.Services = append(req.OriginalRequest.Services, Service{
+			Name:              m.Name,
+			ObjectID:          m.ObjectID,
+			Branches:          sd.Branches,
+			Actions:           sd.Actions,
+			SelectedBranch:    m.SelectedBranch,
+			RollbackOptions:   sd.RollbackOptions,
+			DependsOn:         sd.DependsOn,
+			GrayPhases:        sd.GrayPhases,
+			GrayPhase:         m.GrayPhase,
+			AutoPromote:       sd.AutoPromote,
+			PromoteAt:         m.PromoteAt,
+			PromoteNoticeSent: sd.NoticeSent,
+			ReasonAction:      m.ReasonAction,
+			Owner:             m.Owner,
+			Testers:           sd.Testers,
+			Acceptance:        sd.Acceptance,
+		})
+	}
+
+	for _, a := range rows.actions {
+		key := a.Service + ":" + a.Action
+		if a.Count != 0 {
+			req.ActionCounts[key] = a.Count
+		}
+		if a.Disabled {
+			req.DisabledActions[key] = true
+		}
+	}
+	return req, nil
+}
+
+// readRows 读取请求的全部行，请求不存在时返回 gorm.ErrRecordNotFound
+func readRows(db *gorm.DB, id string) (requestRows, error) {
+	var rows requestRows
+	if err := db.First(&rows.header, "id = ?", id).Error; err != nil {
+		return rows, err
+	}
+	if err := db.Where("request_id = ?", id).Order("ordinal").Find(&rows.services).Error; err != nil {
+		return rows, err
+	}
+	if err := db.Where("request_id = ?", id).Order("id").Find(&rows.actions).Error; err != nil {
+		return rows, err
+	}
+	return rows, nil
+}
+
+// replaceChildren 用 rows 中的服务和动作行替换请求原有的行
+func replaceChildren(tx *gorm.DB, id string, rows requestRows) error {
+	if err := deleteChildren(tx, id); err != nil {
+		return err
+	}
+	if len(rows.services) > 0 {
+		if err := tx.Create(&rows.services).Error; err != nil {
+			return err
+		}
+	}
+	if len(rows.actions) > 0 {
+		if err := tx.Create(&rows.actions).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteChildren 删除请求的服务和动作行
+func deleteChildren(tx *gorm.DB, id string) error {
+	if err := tx.Where("request_id = ?", id).Delete(&ServiceActionModel{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("request_id = ?", id).Delete(&RequestServiceModel{}).Error
+}
+
+// legacyServiceState 旧版本 JSON 中随服务保存的服务端状态，Service 中这些字段不参与 JSON 解析
+type legacyServiceState struct {
+	RollbackOptions   []RollbackOption `json:"rollback_options"`
+	GrayPhase         int              `json:"gray_phase"`
+	PromoteAt         int64            `json:"promote_at"`
+	PromoteNoticeSent bool             `json:"promote_notice_sent"`
+	ReasonAction      string           `json:"reason_action"`
+	Acceptance        *Acceptance      `json:"acceptance"`
+}
+
+// decodeLegacyRequest 解析旧版本的请求 JSON（data 列或请求文件），并恢复服务端状态
+func decodeLegacyRequest(data []byte) (StoredRequest, error) {
+	var req StoredRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return req, err
+	}
+	var state struct {
+		OriginalRequest struct {
+			Services []legacyServiceState `json:"services"`
+		}
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return req, err
+	}
+	for i, st := range state.OriginalRequest.Services {
+		if i >= len(req.OriginalRequest.Services) {
+			break
+		}
+		svc := &req.OriginalRequest.Services[i]
+		svc.RollbackOptions = st.RollbackOptions
+		svc.GrayPhase = st.GrayPhase
+		svc.PromoteAt = st.PromoteAt
+		svc.PromoteNoticeSent = st.PromoteNoticeSent
+		svc.ReasonAction = st.ReasonAction
+		svc.Acceptance = st.Acceptance
+	}
+	return req, nil
+}
+
+// legacyRequest 解析旧版本存储在 data 列中的 JSON
+func legacyRequest(model FeishuRequestModel) (*StoredRequest, error) {
+	req, err := decodeLegacyRequest([]byte(model.Data))
+	if err != nil {
+		return nil, err
+	}
+	if req.CreatedAt.IsZero() {
+		req.CreatedAt = model.CreatedAt
+	}
+	req.version = model.Version
+	return &req, nil
+}
+
+// migrateLegacyRequests 将 data 列中的 JSON 请求转换为关系表，转换后清空 data 列
+// 每行在一个事务中转换，版本号递增，单行失败不影响其他行
+func migrateLegacyRequests(db *gorm.DB) (int, error) {
+	var ids []string
+	if err := db.Model(&FeishuRequestModel{}).Where("data IS NOT NULL AND data <> ''").Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+
+	migrated := 0
+	for _, id := range ids {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var model FeishuRequestModel
+			if err := tx.First(&model, "id = ?", id).Error; err != nil {
+				return err
+			}
+			if model.Data == "" {
+				return nil
+			}
+			req, err := legacyRequest(model)
+			if err != nil {
+				return err
+			}
+			rows, err := toRows(id, req)
+			if err != nil {
+				return err
+			}
+			if err := writeHeader(tx, rows.header, model.Version, model.UpdatedAt); err != nil {
+				return err
+			}
+			return replaceChildren(tx, id, rows)
+		})
+		if err != nil {
+			fmt.Printf("Failed to migrate legacy request %s: %v\n", id, err)
+			continue
+		}
+		migrated++
+	}
+	if migrated > 0 {
+		fmt.Printf("Migrated %d legacy requests to relational tables\n", migrated)
+	}
+	return migrated, nil
+}
+
+// writeHeader 按版本号写回请求头并递增版本，同时清空旧版本的 data 列
+// 版本号不一致时返回 errVersionConflict
+func writeHeader(tx *gorm.DB, header FeishuRequestModel, version int64, updatedAt time.Time) error {
+	result := tx.Model(&FeishuRequestModel{}).
+		Where("id = ? AND version = ?", header.ID, version).
+		Updates(map[string]interface{}{
+			"data":            "",
+			"title":           header.Title,
+			"object_id":       header.ObjectID,
+			"project":         header.Project,
+			"environment":     header.Environment,
+			"initiator":       header.Initiator,
+			"receive_id":      header.ReceiveID,
+			"receive_id_type": header.ReceiveIDType,
+			"dry_run":         header.DryRun,
+			"ttl_seconds":     header.TTLSeconds,
+			"renewed_at":      header.RenewedAt,
+			"expires_at":      header.ExpiresAt,
+			"closed_at":       header.ClosedAt,
+			"summary_sent":    header.SummarySent,
+			"detail":          header.Detail,
+			"version":         gorm.Expr("version + 1"),
+			"updated_at":      updatedAt,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errVersionConflict
+	}
+	return nil
+}
+
+// FindRequestsByService 返回包含指定服务的请求 ID，最新创建的在前
+func (s *RequestStore) FindRequestsByService(name string) ([]string, error) {
+	db := s.getDB()
+	if db == nil {
+		return nil, fmt.Errorf("database is not available")
+	}
+	s.ensureTable(db)
+
+	var ids []string
+	err := db.Model(&FeishuRequestModel{}).
+		Where("id IN (?)", db.Model(&RequestServiceModel{}).Select("request_id").Where("name = ?", name)).
+		Order("created_at DESC").
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+// PendingRelease 等待正式发布的服务
+type PendingRelease struct {
+	RequestID string
+	Service   string
+}
+
+// PendingOfficialReleases 返回配置了正式发布、尚未点击或禁用正式发布且卡片未过期的服务，按请求创建时间排序
+func (s *RequestStore) PendingOfficialReleases(now time.Time) ([]PendingRelease, error) {
+	db := s.getDB()
+	if db == nil {
+		return nil, fmt.Errorf("database is not available")
+	}
+	s.ensureTable(db)
+
+	var pending []PendingRelease
+	err := db.Table("feishu_request_services AS s").
+		Select("s.request_id AS request_id, s.name AS service").
+		Joins("JOIN feishu_requests AS r ON r.id = s.request_id").
+		Joins("LEFT JOIN feishu_service_actions AS a ON a.request_id = s.request_id AND a.service = s.name AND a.action = ?", action.Default.ValueOf(action.Official)).
+		Where("s.official = ?", true).
+		Where("r.expires_at IS NULL OR r.expires_at > ?", now).
+		Where("a.id IS NULL OR (a.count = 0 AND a.disabled = ?)", false).
+		Order("r.created_at, s.ordinal").
+		Scan(&pending).Error
+	return pending, err
+}
+
+// PendingPromotion 计划自动发布的服务
+type PendingPromotion struct {
+	RequestID string
+	Service   string
+	PromoteAt int64
+}
+
+// PendingPromotions 返回计划了自动发布且卡片未过期（未关闭）的服务
+func (s *RequestStore) PendingPromotions(now time.Time) ([]PendingPromotion, error) {
+	db := s.getDB()
+	if db == nil {
+		return nil, fmt.Errorf("database is not available")
+	}
+	s.ensureTable(db)
+
+	var pending []PendingPromotion
+	err := db.Table("feishu_request_services AS s").
+		Select("s.request_id AS request_id, s.name AS service, s.promote_at AS promote_at").
+		Joins("JOIN feishu_requests AS r ON r.id = s.request_id").
+		Where("s.promote_at > ?", 0).
+		Where("r.expires_at IS NULL OR r.expires_at > ?", now).
+		Order("s.promote_at").
+		Scan(&pending).Error
+	return pending, err
+}
+
+// errVersionConflict 请求已被其他副本修改
+var errVersionConflict = errors.New("request version conflict")
+
+// timePtr 零值时间存为 NULL
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// timeOf 将可为 NULL 的时间还原为零值
+func timeOf(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
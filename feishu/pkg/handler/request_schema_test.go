@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"devops/feishu/config"
+)
+
+func TestRequestSchema(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	stored := &StoredRequest{
+		OriginalRequest: GrayCardRequest{
+			Title:       "发布",
+			ObjectID:    "proj",
+			Environment: "prod",
+			Testers:     []string{"ou_tester"},
+			ReceiveID:   "oc_chat",
+			TTLSeconds:  3600,
+			Services: []Service{
+				{Name: "api", ObjectID: "proj", Branches: []string{"master"}, Actions: []string{"gray", "official"}, SelectedBranch: "master", GrayPhases: []int{10, 100}, GrayPhase: 1},
+				{Name: "web", ObjectID: "proj", Branches: []string{"main"}, Actions: []string{"official"}},
+			},
+		},
+		DisabledActions: map[string]bool{"api:do_gray_release": true},
+		ActionCounts:    map[string]int{"api:do_gray_release": 2, "web:do_restart": 1},
+		CreatedAt:       now,
+		RenewedAt:       now,
+		ExpiresAt:       now.Add(time.Hour),
+		Builds:          []BuildRecord{{Service: "api", BuildNumber: 7, StartedAt: now}},
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		rows, err := toRows("req", stored)
+		if err != nil {
+			t.Fatalf("toRows failed: %v", err)
+		}
+		if len(rows.services) != 2 || len(rows.actions) != 2 {
+			t.Fatalf("Expected 2 service rows and 2 action rows, got %d and %d", len(rows.services), len(rows.actions))
+		}
+		if !rows.services[0].Official || !rows.services[1].Official {
+			t.Error("Services with official action should be flagged")
+		}
+
+		got, err := fromRows(rows)
+		if err != nil {
+			t.Fatalf("fromRows failed: %v", err)
+		}
+		if !reflect.DeepEqual(got.OriginalRequest, stored.OriginalRequest) {
+			t.Errorf("Request mismatch:\n got %+v\nwant %+v", got.OriginalRequest, stored.OriginalRequest)
+		}
+		if !reflect.DeepEqual(got.DisabledActions, stored.DisabledActions) || !reflect.DeepEqual(got.ActionCounts, stored.ActionCounts) {
+			t.Errorf("Action state mismatch: disabled=%v counts=%v", got.DisabledActions, got.ActionCounts)
+		}
+		if len(got.Builds) != 1 || got.Builds[0].BuildNumber != 7 || !got.ExpiresAt.Equal(stored.ExpiresAt) {
+			t.Errorf("Detail mismatch: builds=%v expires=%v", got.Builds, got.ExpiresAt)
+		}
+	})
+
+	cfg, _ := config.LoadConfig()
+	if cfg == nil || cfg.GetDB() == nil {
+		t.Skip("database is not available")
+	}
+	db := cfg.GetDB()
+	GlobalStore.ensureTable(db)
+
+	t.Run("migrate legacy row", func(t *testing.T) {
+		id := fmt.Sprintf("test-req-legacy-%d", time.Now().UnixNano())
+		// 旧版本的 JSON 中服务端状态随服务保存
+		data, _ := json.Marshal(stored)
+		var raw map[string]interface{}
+		json.Unmarshal(data, &raw)
+		services := raw["OriginalRequest"].(map[string]interface{})["services"].([]interface{})
+		services[0].(map[string]interface{})["gray_phase"] = 1
+		services[0].(map[string]interface{})["acceptance"] = map[string]interface{}{"status": AcceptancePassed}
+		data, _ = json.Marshal(raw)
+		if err := db.Create(&FeishuRequestModel{ID: id, Data: string(data)}).Error; err != nil {
+			t.Fatalf("Failed to insert legacy row: %v", err)
+		}
+
+		// 未迁移时仍可读取
+		store := &RequestStore{}
+		if req, ok := store.Get(id); !ok || req.ActionCounts["api:do_gray_release"] != 2 {
+			t.Fatalf("Legacy request should be readable, got %v", req)
+		}
+
+		if _, err := migrateLegacyRequests(db); err != nil {
+			t.Fatalf("Migration failed: %v", err)
+		}
+		var header FeishuRequestModel
+		db.First(&header, "id = ?", id)
+		if header.Data != "" || header.Environment != "prod" {
+			t.Errorf("Legacy data should be converted, got data=%q env=%q", header.Data, header.Environment)
+		}
+		var rows []RequestServiceModel
+		db.Where("request_id = ?", id).Find(&rows)
+		if len(rows) != 2 {
+			t.Errorf("Expected 2 service rows, got %d", len(rows))
+		}
+
+		// 缓存版本已过期，需重新加载
+		store.IncrementActionCount(id, "web", "do_restart")
+		req, _ := (&RequestStore{}).Get(id)
+		if req.ActionCounts["web:do_restart"] != 2 || req.OriginalRequest.Services[0].GrayPhase != 1 {
+			t.Errorf("Migrated request should keep its state, got counts=%v", req.ActionCounts)
+		}
+		if a := req.OriginalRequest.Services[0].Acceptance; a == nil || a.Status != AcceptancePassed {
+			t.Errorf("Migrated request should keep acceptance, got %+v", a)
+		}
+		GlobalStore.Delete(id)
+	})
+
+	t.Run("query", func(t *testing.T) {
+		svc := fmt.Sprintf("svc-query-%d", time.Now().UnixNano())
+		id := fmt.Sprintf("test-req-query-%d", time.Now().UnixNano())
+		GlobalStore.Save(id, GrayCardRequest{TTLSeconds: 3600, Services: []Service{
+			{Name: svc, ObjectID: "proj", Branches: []string{"master"}, Actions: []string{"official"}},
+			{Name: svc + "-gray", ObjectID: "proj", Branches: []string{"master"}, Actions: []string{"gray"}},
+		}})
+		defer GlobalStore.Delete(id)
+
+		ids, err := GlobalStore.FindRequestsByService(svc)
+		if err != nil || len(ids) != 1 || ids[0] != id {
+			t.Errorf("Expected [%s], got %v (%v)", id, ids, err)
+		}
+
+		pending := func() []PendingRelease {
+			all, err := GlobalStore.PendingOfficialReleases(time.Now())
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			var mine []PendingRelease
+			for _, p := range all {
+				if p.RequestID == id {
+					mine = append(mine, p)
+				}
+			}
+			return mine
+		}
+		if got := pending(); len(got) != 1 || got[0].Service != svc {
+			t.Errorf("Expected %s to be pending, got %v", svc, got)
+		}
+		GlobalStore.IncrementActionCount(id, svc, "do_official_release")
+		if got := pending(); len(got) != 0 {
+			t.Errorf("Released service should not be pending, got %v", got)
+		}
+	})
+}
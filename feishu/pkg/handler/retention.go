@@ -0,0 +1,322 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"devops/feishu/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+// 请求归档策略
+const (
+	ArchivePolicyArchive = "archive" // 移入归档表
+	ArchivePolicyDelete  = "delete"  // 直接删除
+)
+
+var (
+	requestCacheEntries = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "feishu_request_cache_entries",
+			Help: "内存中缓存的发布请求数",
+		},
+	)
+
+	requestCacheEvictions = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "feishu_request_cache_evictions_total",
+			Help: "从内存中淘汰的发布请求数",
+		},
+	)
+
+	requestTableRows = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "feishu_request_table_rows",
+			Help: "发布请求表的行数",
+		},
+		[]string{"table"},
+	)
+
+	requestsArchived = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "feishu_requests_archived_total",
+			Help: "归档任务处理的发布请求数",
+		},
+		[]string{"policy"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(requestCacheEntries)
+	prometheus.MustRegister(requestCacheEvictions)
+	prometheus.MustRegister(requestTableRows)
+	prometheus.MustRegister(requestsArchived)
+}
+
+// FeishuRequestArchiveModel 已归档的发布请求，结构与 feishu_requests 相同
+type FeishuRequestArchiveModel struct {
+	ID         string `gorm:"primaryKey;size:191"`
+	Data       string `gorm:"type:longtext"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	ArchivedAt time.Time `gorm:"index"`
+}
+
+func (FeishuRequestArchiveModel) TableName() string {
+	return "feishu_requests_archive"
+}
+
+// touchLocked 记录请求最近一次被访问的时间
+// 注意：调用此方法前必须持有锁 s.mu
+func (s *RequestStore) touchLocked(id string) {
+	if s.lastUsed == nil {
+		s.lastUsed = make(map[string]time.Time)
+	}
+	s.lastUsed[id] = time.Now()
+}
+
+// evictLocked 从内存中淘汰闲置超过 REQUEST_CACHE_TTL 的请求，数量仍超过 REQUEST_CACHE_SIZE 时淘汰最久未访问的
+// 淘汰只影响内存，下次访问时从数据库重新加载；数据库不可用时内存是唯一副本，不淘汰
+// 注意：调用此方法前必须持有锁 s.mu
+func (s *RequestStore) evictLocked(now time.Time) int {
+	defer func() { requestCacheEntries.Set(float64(len(s.lastUsed))) }()
+
+	cfg, err := config.LoadConfig()
+	if err != nil || cfg == nil || s.getDB() == nil {
+		return 0
+	}
+
+	evicted := 0
+	evict := func(id string) {
+		s.data.Delete(id)
+		delete(s.lastUsed, id)
+		evicted++
+	}
+
+	if cfg.RequestCacheTTL > 0 {
+		for id, at := range s.lastUsed {
+			if now.Sub(at) > cfg.RequestCacheTTL {
+				evict(id)
+			}
+		}
+	}
+
+	if cfg.RequestCacheSize > 0 && len(s.lastUsed) > cfg.RequestCacheSize {
+		ids := make([]string, 0, len(s.lastUsed))
+		for id := range s.lastUsed {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return s.lastUsed[ids[i]].Before(s.lastUsed[ids[j]]) })
+		for _, id := range ids[:len(ids)-cfg.RequestCacheSize] {
+			evict(id)
+		}
+	}
+
+	if evicted > 0 {
+		requestCacheEvictions.Add(float64(evicted))
+	}
+	return evicted
+}
+
+// Evict 执行一次内存淘汰，返回淘汰的请求数
+func (s *RequestStore) Evict() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.evictLocked(time.Now())
+}
+
+// archivable 请求可以归档：没有进行中的构建或批量发布，且所有服务都已构建结束或卡片已过期
+func (r *StoredRequest) archivable(now time.Time) bool {
+	for _, b := range r.Builds {
+		if !b.Finished() {
+			return false
+		}
+	}
+	if r.Batch != nil && r.Batch.Status == BatchRunning {
+		return false
+	}
+	return r.IsExpired(now) || (len(r.Builds) > 0 && r.allServicesFinished())
+}
+
+// Archive 将超过 REQUEST_ARCHIVE_DAYS 未更新、已结束或已过期的请求按策略归档或删除，返回处理的请求数
+func (s *RequestStore) Archive(now time.Time) (int, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil || cfg == nil {
+		return 0, fmt.Errorf("failed to load config: %v", err)
+	}
+	if cfg.RequestArchiveDays <= 0 {
+		return 0, nil
+	}
+	policy := cfg.RequestArchivePolicy
+	if policy != ArchivePolicyDelete {
+		policy = ArchivePolicyArchive
+	}
+
+	db := s.getDB()
+	if db == nil {
+		return 0, fmt.Errorf("database is not available")
+	}
+	s.ensureTable(db)
+	if policy == ArchivePolicyArchive && !db.Migrator().HasTable(&FeishuRequestArchiveModel{}) {
+		if err := db.AutoMigrate(&FeishuRequestArchiveModel{}); err != nil {
+			return 0, err
+		}
+	}
+
+	cutoff := now.AddDate(0, 0, -cfg.RequestArchiveDays)
+	var ids []string
+	if err := db.Model(&FeishuRequestModel{}).Where("updated_at < ?", cutoff).Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+
+	archived := 0
+	for _, id := range ids {
+		ok, err := s.archiveOne(db, id, policy, cutoff, now)
+		if err != nil {
+			fmt.Printf("Failed to archive request %s: %v\n", id, err)
+			continue
+		}
+		if ok {
+			archived++
+		}
+	}
+	if archived > 0 {
+		requestsArchived.WithLabelValues(policy).Add(float64(archived))
+		fmt.Printf("Archived %d requests older than %s (policy=%s)\n", archived, cutoff.Format(time.RFC3339), policy)
+	}
+	return archived, nil
+}
+
+// archiveOne 在持有锁的情况下重新读取请求并归档，避免与卡片回调并发修改
+func (s *RequestStore) archiveOne(db *gorm.DB, id, policy string, cutoff, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rows, err := readRows(db, id)
+	if err != nil {
+		return false, err
+	}
+	model := rows.header
+	if !model.UpdatedAt.Before(cutoff) {
+		return false, nil
+	}
+
+	var req *StoredRequest
+	if model.Data != "" {
+		req, err = legacyRequest(model)
+	} else {
+		req, err = fromRows(rows)
+	}
+	if err != nil {
+		return false, err
+	}
+	if req.CreatedAt.IsZero() {
+		req.CreatedAt = model.CreatedAt
+	}
+	if !req.archivable(now) {
+		return false, nil
+	}
+	// 归档表保存完整的 JSON 快照，查询归档数据不依赖关系表结构
+	data, err := json.Marshal(req)
+	if err != nil {
+		return false, err
+	}
+
+	// 按版本号删除请求头：读取后被其他副本修改过时不删除，整个事务回滚，留到下一轮重新判断
+	err = db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND version = ?", id, model.Version).Delete(&FeishuRequestModel{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errVersionConflict
+		}
+		if policy == ArchivePolicyArchive {
+			archive := FeishuRequestArchiveModel{
+				ID:         model.ID,
+				Data:       string(data),
+				CreatedAt:  model.CreatedAt,
+				UpdatedAt:  model.UpdatedAt,
+				ArchivedAt: now,
+			}
+			if err := tx.Create(&archive).Error; err != nil {
+				return err
+			}
+		}
+		return deleteChildren(tx, id)
+	})
+	if errors.Is(err, errVersionConflict) {
+		fmt.Printf("Skip archiving request %s: modified since it was read\n", id)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	s.data.Delete(id)
+	delete(s.lastUsed, id)
+	return true, nil
+}
+
+// updateTableMetrics 统计请求表和归档表的行数
+func (s *RequestStore) updateTableMetrics() {
+	db := s.getDB()
+	if db == nil {
+		return
+	}
+	for _, model := range []interface {
+		TableName() string
+	}{FeishuRequestModel{}, FeishuRequestArchiveModel{}} {
+		if !db.Migrator().HasTable(model) {
+			continue
+		}
+		var count int64
+		if err := db.Model(model).Count(&count).Error; err == nil {
+			requestTableRows.WithLabelValues(model.TableName()).Set(float64(count))
+		}
+	}
+}
+
+var retentionOnce sync.Once
+
+// StartRetention 启动后台任务：定期淘汰内存中的请求、归档旧请求并更新指标
+func (s *RequestStore) StartRetention(ctx context.Context) {
+	retentionOnce.Do(func() {
+		interval := time.Hour
+		if cfg, err := config.LoadConfig(); err == nil && cfg != nil && cfg.RequestArchiveInterval > 0 {
+			interval = cfg.RequestArchiveInterval
+		}
+
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				s.runRetention()
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	})
+}
+
+// runRetention 执行一轮淘汰、归档和指标统计
+func (s *RequestStore) runRetention() {
+	now := time.Now()
+	if n := s.Evict(); n > 0 {
+		fmt.Printf("Evicted %d idle requests from memory\n", n)
+	}
+	if _, err := s.Archive(now); err != nil {
+		fmt.Printf("Request archival failed: %v\n", err)
+	}
+	s.updateTableMetrics()
+}
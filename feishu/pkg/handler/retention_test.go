@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"devops/feishu/config"
+)
+
+func TestRequestRetention(t *testing.T) {
+	cfg, _ := config.LoadConfig()
+	if cfg == nil || cfg.GetDB() == nil {
+		t.Skip("database is not available")
+	}
+	origTTL, origSize, origDays, origPolicy := cfg.RequestCacheTTL, cfg.RequestCacheSize, cfg.RequestArchiveDays, cfg.RequestArchivePolicy
+	defer func() {
+		cfg.RequestCacheTTL, cfg.RequestCacheSize, cfg.RequestArchiveDays, cfg.RequestArchivePolicy = origTTL, origSize, origDays, origPolicy
+	}()
+
+	// 每个子测试使用独立的 RequestStore，缓存大小和淘汰结果只与本测试写入的请求有关
+	newRequest := func(store *RequestStore, name string) string {
+		id := fmt.Sprintf("test-req-retention-%s-%d", name, time.Now().UnixNano())
+		store.Save(id, GrayCardRequest{TTLSeconds: 1, Services: []Service{
+			{Name: "svc", ObjectID: "proj", Branches: []string{"master"}, Actions: []string{"gray"}},
+		}})
+		return id
+	}
+	cached := func(store *RequestStore, id string) bool {
+		_, ok := store.data.Load(id)
+		return ok
+	}
+
+	t.Run("evict least recently used", func(t *testing.T) {
+		store := &RequestStore{}
+		cfg.RequestCacheTTL, cfg.RequestCacheSize = time.Hour, 1
+		first := newRequest(store, "first")
+		second := newRequest(store, "second")
+		defer store.Delete(first)
+		defer store.Delete(second)
+
+		store.mu.Lock()
+		store.evictLocked(time.Now())
+		size := len(store.lastUsed)
+		store.mu.Unlock()
+
+		if cached(store, first) || !cached(store, second) || size != 1 {
+			t.Errorf("Expected only the oldest request to be evicted: first=%v second=%v size=%d", cached(store, first), cached(store, second), size)
+		}
+		// 淘汰后仍可从数据库加载
+		if _, ok := store.Get(first); !ok || !cached(store, first) {
+			t.Error("Evicted request should be reloaded from database")
+		}
+	})
+
+	t.Run("evict idle", func(t *testing.T) {
+		store := &RequestStore{}
+		cfg.RequestCacheTTL, cfg.RequestCacheSize = time.Minute, 0
+		id := newRequest(store, "idle")
+		defer store.Delete(id)
+		store.mu.Lock()
+		store.evictLocked(time.Now().Add(2 * time.Minute))
+		store.mu.Unlock()
+		if cached(store, id) {
+			t.Error("Idle request should be evicted")
+		}
+	})
+
+	t.Run("archive disabled", func(t *testing.T) {
+		store := &RequestStore{}
+		cfg.RequestArchiveDays = 0
+		id := newRequest(store, "disabled")
+		defer store.Delete(id)
+		if n, err := store.Archive(time.Now().AddDate(0, 0, 2)); n != 0 || err != nil {
+			t.Errorf("Archive should be a no-op when disabled, got %d %v", n, err)
+		}
+		if _, ok := (&RequestStore{}).Get(id); !ok {
+			t.Error("Request should be kept when archiving is disabled")
+		}
+	})
+
+	t.Run("archive expired", func(t *testing.T) {
+		store := &RequestStore{}
+		cfg.RequestArchiveDays, cfg.RequestArchivePolicy = 1, ArchivePolicyArchive
+		id := newRequest(store, "archive")
+		running := newRequest(store, "running")
+		defer store.Delete(running)
+		store.StartBuild(running, BuildRecord{Service: "svc", StartedAt: time.Now()})
+
+		// 两天后两个请求都已过期，但进行中的构建不能归档
+		if _, err := store.Archive(time.Now().AddDate(0, 0, 2)); err != nil {
+			t.Fatalf("Archive failed: %v", err)
+		}
+		if cached(store, id) {
+			t.Error("Archived request should be removed from memory")
+		}
+		if _, ok := store.Get(id); ok {
+			t.Error("Expired request should be archived")
+		}
+		if _, ok := store.Get(running); !ok {
+			t.Error("Request with a running build should not be archived")
+		}
+
+		var archive FeishuRequestArchiveModel
+		if err := cfg.GetDB().First(&archive, "id = ?", id).Error; err != nil {
+			t.Errorf("Expected archive row: %v", err)
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"devops/feishu/config"
+	"devops/feishu/pkg/action"
+	"devops/jenkins"
+
+	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher/callback"
+)
+
+// 飞书要求卡片回调在 3 秒内响应，拉取 Jenkins 历史需留出余量
+const rollbackFetchTimeout = 2500 * time.Millisecond
+
+// fetchRollbackCandidates 从项目或 Job 对应的 Jenkins 实例获取可回滚的历史构建（测试中可替换）
+var fetchRollbackCandidates = func(ctx context.Context, project, jobName string, limit int) ([]jenkins.BuildSummary, error) {
+	client := jenkins.Instances.Resolve(project, jobName)
+	if client == nil {
+		return nil, fmt.Errorf("jenkins client init failed")
+	}
+	return client.GetRecentSuccessfulBuilds(ctx, jobName, limit)
+}
+
+// rollbackCandidateLimit 回滚可选版本数量，默认 5
+func rollbackCandidateLimit() int {
+	if cfg, _ := config.LoadConfig(); cfg != nil && cfg.RollbackCandidates > 0 {
+		return cfg.RollbackCandidates
+	}
+	return 5
+}
+
+// openRollbackPicker 拉取服务最近的成功构建并在卡片中展示版本选择
+// 拒绝时第二个返回值为写入审计记录的拒绝原因
+func openRollbackPicker(ctx context.Context, requestID, serviceName string) (*callback.CardActionTriggerResponse, string) {
+	ctx, cancel := context.WithTimeout(ctx, rollbackFetchTimeout)
+	defer cancel()
+
+	var project string
+	if reqData, ok := GlobalStore.Get(requestID); ok {
+		project = reqData.OriginalRequest.Project
+	}
+	builds, err := fetchRollbackCandidates(ctx, project, serviceName, rollbackCandidateLimit())
+	if err != nil {
+		fmt.Printf("Failed to fetch rollback candidates for %s: %v\n", serviceName, err)
+		return toast("获取历史版本失败，请稍后重试"), fmt.Sprintf("fetch rollback candidates failed: %v", err)
+	}
+	if len(builds) == 0 {
+		return toast("未找到可回滚的历史版本"), "no rollback candidates"
+	}
+
+	options := make([]RollbackOption, 0, len(builds))
+	for _, b := range builds {
+		options = append(options, RollbackOption{
+			BuildNumber:  b.Number,
+			Branch:       b.Branch,
+			ImageVersion: b.ImageVersion,
+			BuiltAt:      b.Timestamp.Unix(),
+		})
+	}
+
+	if !GlobalStore.SetRollbackOptions(requestID, serviceName, options) {
+		return toast("请求数据已过期或不存在"), "request not found"
+	}
+	return refreshCard(requestID, "请选择回滚版本"), ""
+}
+
+// rollbackVersionOf 返回回滚表单中选中的构建号，兼容旧卡片下拉框直接回调的 option
+func rollbackVersionOf(cardAction *callback.CallBackAction) string {
+	if version, ok := cardAction.FormValue["version"].(string); ok && version != "" {
+		return version
+	}
+	return cardAction.Option
+}
+
+// confirmRollback 按选中的历史构建触发回滚，传递该构建的 IMAGE_VERSION，回滚原因必填
+// 拒绝时第二个返回值为写入审计记录的拒绝原因
+func confirmRollback(requestID, serviceName, option, reason, incidentID, operator string) (*callback.CardActionTriggerResponse, string) {
+	if GlobalStore.IsActionDisabled(requestID, serviceName, action.Default.ValueOf(action.Rollback)) {
+		return toast("该操作已执行，请勿重复点击"), "action disabled"
+	}
+
+	storedReq, ok := GlobalStore.Get(requestID)
+	if !ok {
+		return toast("请求数据已过期或不存在"), "request not found"
+	}
+
+	buildNumber, _ := strconv.ParseInt(option, 10, 64)
+	var target *RollbackOption
+	for _, svc := range storedReq.OriginalRequest.Services {
+		if svc.Name != serviceName {
+			continue
+		}
+		for i := range svc.RollbackOptions {
+			if svc.RollbackOptions[i].BuildNumber == buildNumber {
+				target = &svc.RollbackOptions[i]
+				break
+			}
+		}
+	}
+	if target == nil {
+		return toast("所选版本已失效，请重新点击回滚"), "invalid rollback version"
+	}
+	if def, ok := action.Default.Lookup(action.Rollback); ok && def.RequireReason && reason == "" {
+		return toast("请填写回滚原因"), "reason required"
+	}
+	task := withAction(action.Rollback, buildTask{
+		RequestID:    requestID,
+		Service:      serviceName,
+		Branch:       target.Branch,
+		ImageVersion: target.ImageVersion,
+		Operator:     operator,
+		Reason:       reason,
+		IncidentID:   incidentID,
+	})
+
+	if problems := paramMismatch(context.Background(), requestID, task); len(problems) > 0 {
+		return paramMismatchToast(problems), paramMismatchReason(problems)
+	}
+
+	if !GlobalDeduper.Claim(requestID, serviceName, "rollback_version", operator) {
+		return duplicateResponse(requestID), "duplicate click"
+	}
+	GlobalStore.MarkActionDisabled(requestID, serviceName, action.Default.ValueOf(action.Rollback))
+	GlobalStore.SetRollbackOptions(requestID, serviceName, nil)
+
+	fmt.Printf("Triggering Rollback: %s -> #%d (%s)\n", serviceName, target.BuildNumber, target.ImageVersion)
+	go runBuild(context.Background(), task)
+
+	return refreshCard(requestID, fmt.Sprintf("正在回滚到 #%d (%s)", buildNumber, task.ImageVersion)), ""
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"devops/feishu/pkg/feishu"
+	"devops/jenkins"
+	"testing"
+	"time"
+
+	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher/callback"
+)
+
+func TestRollbackPicker(t *testing.T) {
+	client := &feishu.Client{}
+	InitCallbackHandler(client)
+
+	origFetch := fetchRollbackCandidates
+	defer func() { fetchRollbackCandidates = origFetch }()
+	fetchRollbackCandidates = func(ctx context.Context, project, jobName string, limit int) ([]jenkins.BuildSummary, error) {
+		return []jenkins.BuildSummary{
+			{Number: 10, Branch: "master", ImageVersion: "v10", Timestamp: time.Unix(1700000200, 0)},
+			{Number: 9, Branch: "release/1.0", ImageVersion: "v9", Timestamp: time.Unix(1700000100, 0)},
+		}, nil
+	}
+
+	reqID := "test-req-rollback-001"
+	serviceName := "service-rollback"
+	GlobalStore.Save(reqID, GrayCardRequest{
+		Services: []Service{
+			{Name: serviceName, ObjectID: serviceName, Branches: []string{"master"}, Actions: []string{"gray"}},
+		},
+	})
+
+	newEvent := func(actionName, option string) *callback.CardActionTriggerEvent {
+		return &callback.CardActionTriggerEvent{
+			Event: &callback.CardActionTriggerRequest{
+				Action: &callback.CallBackAction{
+					Option: option,
+					Value: map[string]interface{}{
+						"request_id": reqID,
+						"service":    serviceName,
+						"action":     actionName,
+					},
+				},
+			},
+		}
+	}
+
+	// 点击回滚只展开版本选择，不禁用按钮
+	resp, _ := handleCardAction(context.Background(), newEvent("do_rollback", ""))
+	if resp.Toast.Content != "请选择回滚版本" || resp.Card == nil {
+		t.Fatalf("Expected rollback picker, got %+v", resp.Toast)
+	}
+	if GlobalStore.IsActionDisabled(reqID, serviceName, "do_rollback") {
+		t.Error("Rollback should not be disabled before a version is chosen")
+	}
+	card, _ := resp.Card.Data.(map[string]interface{})
+	if findButton(card, "rollback_version") == nil {
+		t.Error("Rollback version select should be present on the card")
+	}
+
+	// 选择不存在的版本
+	resp, _ = handleCardAction(context.Background(), newEvent("rollback_version", "42"))
+	if resp.Toast.Content != "所选版本已失效，请重新点击回滚" {
+		t.Errorf("Expected stale version toast, got %+v", resp.Toast)
+	}
+
+	// 取消回滚清空版本列表
+	handleCardAction(context.Background(), newEvent("cancel_rollback", ""))
+	storedReq, _ := GlobalStore.Get(reqID)
+	if len(storedReq.OriginalRequest.Services[0].RollbackOptions) != 0 {
+		t.Error("Rollback options should be cleared after cancel")
+	}
+}
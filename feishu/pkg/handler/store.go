@@ -2,7 +2,7 @@ package handler
 
 import (
 	"devops/feishu/config"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -11,18 +11,45 @@ import (
 )
 
 // RequestStore 用于在内存中存储发送的卡片请求数据，以便在回调中重建卡片
+// 数据库是唯一可信来源：多副本部署时，修改按版本号乐观锁写回，读取时校验缓存版本，
+// 数据库不可用时退化为仅使用本进程内存
 type RequestStore struct {
-	data sync.Map
-	mu   sync.Mutex // 保护 DB 操作和复杂对象的更新
+	data        sync.Map
+	mu          sync.Mutex           // 保护 DB 操作和复杂对象的更新
+	lastUsed    map[string]time.Time // 内存中每个请求最近一次访问的时间，用于淘汰
+	migrateOnce sync.Once
 }
 
 var GlobalStore = &RequestStore{}
 
+// maxUpdateRetries 版本冲突时重新读取并重试修改的次数
+const maxUpdateRetries = 5
+
+// versionCheckInterval 缓存与数据库核对版本的最短间隔，一次卡片回调内的多次读取只查询一次版本号
+// 修改总是从数据库读取最新版本并按版本号写回，不受此间隔影响
+const versionCheckInterval = time.Second
+
+// FeishuRequestModel 请求头，服务和动作见 RequestServiceModel / ServiceActionModel
 type FeishuRequestModel struct {
-	ID        string `gorm:"primaryKey;size:191"`
-	Data      string `gorm:"type:longtext"` // Stores StoredRequest as JSON
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID            string `gorm:"primaryKey;size:191"`
+	Data          string `gorm:"type:longtext"`      // 旧版本存储的整个 StoredRequest JSON，迁移后为空
+	Version       int64  `gorm:"not null;default:0"` // 每次写入递增，用于多副本间的乐观锁
+	Title         string `gorm:"size:255"`
+	ObjectID      string `gorm:"size:191;index"`
+	Project       string `gorm:"size:191;index"`
+	Environment   string `gorm:"size:64"`
+	Initiator     string `gorm:"size:191"`
+	ReceiveID     string `gorm:"size:191"`
+	ReceiveIDType string `gorm:"size:32"`
+	DryRun        bool
+	TTLSeconds    int
+	RenewedAt     *time.Time
+	ExpiresAt     *time.Time `gorm:"index"`
+	ClosedAt      *time.Time `gorm:"index"`
+	SummarySent   bool
+	Detail        string `gorm:"type:longtext"` // requestDetail 的 JSON
+	CreatedAt     time.Time
+	UpdatedAt     time.Time `gorm:"index"`
 }
 
 func (FeishuRequestModel) TableName() string {
@@ -33,9 +60,7 @@ func init() {
 	// Try to ensure table exists on startup, but ignore errors if config not ready
 	if cfg, err := config.LoadConfig(); err == nil {
 		if db := cfg.GetDB(); db != nil {
-			if !db.Migrator().HasTable(&FeishuRequestModel{}) {
-				db.AutoMigrate(&FeishuRequestModel{})
-			}
+			GlobalStore.ensureTable(db)
 		}
 	}
 }
@@ -44,6 +69,19 @@ type StoredRequest struct {
 	OriginalRequest GrayCardRequest
 	DisabledActions map[string]bool // key: "serviceName:action"
 	ActionCounts    map[string]int  // key: "serviceName:action"
+
+	CreatedAt time.Time // 卡片创建时间
+	RenewedAt time.Time // 最近一次创建或续期的时间，动作级有效期从此刻起算
+	ExpiresAt time.Time // 卡片过期时间，零值时按 CreatedAt + REQUEST_TTL 计算
+	ClosedAt  time.Time // 管理员关闭请求的时间，关闭时同时将 ExpiresAt 置为此刻
+
+	Builds      []BuildRecord // 卡片触发的构建记录，按触发顺序追加
+	SummarySent bool          // 本轮发布的汇总卡片是否已发送，新构建开始时重置
+
+	Batch *BatchState // 最近一次批量发布的进度
+
+	version   int64     // 读取时数据库中的版本号，不序列化
+	checkedAt time.Time // 缓存最近一次与数据库核对版本的时间，只在持有 s.mu 时读写
 }
 
 func (s *RequestStore) getDB() *gorm.DB {
@@ -55,49 +93,79 @@ func (s *RequestStore) getDB() *gorm.DB {
 	return cfg.GetDB()
 }
 
-// ensureTable ensures the table exists (lazy init)
+// ensureTable 每个进程迁移一次：创建或补齐请求相关的表，并将旧版本的 JSON 数据转换为关系表
 func (s *RequestStore) ensureTable(db *gorm.DB) {
-	if !db.Migrator().HasTable(&FeishuRequestModel{}) {
-		db.AutoMigrate(&FeishuRequestModel{})
-	}
+	s.migrateOnce.Do(func() {
+		if err := db.AutoMigrate(&FeishuRequestModel{}, &RequestServiceModel{}, &ServiceActionModel{}); err != nil {
+			fmt.Printf("Failed to migrate request tables: %v\n", err)
+			return
+		}
+		if _, err := migrateLegacyRequests(db); err != nil {
+			fmt.Printf("Failed to migrate legacy requests: %v\n", err)
+		}
+	})
 }
 
-// saveToDB 将请求数据持久化到数据库
+// saveToDB 将新建的请求数据持久化到数据库，已存在时覆盖并递增版本
 // 注意：调用此方法前必须持有锁 s.mu
-func (s *RequestStore) saveToDB(id string, req *StoredRequest) {
+func (s *RequestStore) saveToDB(id string, req *StoredRequest) error {
 	db := s.getDB()
 	if db == nil {
-		fmt.Println("Failed to get DB connection")
-		return
+		return fmt.Errorf("database is not available")
 	}
 	s.ensureTable(db)
 
-	data, err := json.Marshal(req)
+	rows, err := toRows(id, req)
 	if err != nil {
-		fmt.Printf("Failed to marshal request data: %v\n", err)
-		return
+		return fmt.Errorf("failed to marshal request data: %v", err)
 	}
 
-	var model FeishuRequestModel
-	if err := db.First(&model, "id = ?", id).Error; err == nil {
-		// Update
-		model.Data = string(data)
-		model.UpdatedAt = time.Now()
-		if err := db.Save(&model).Error; err != nil {
-			fmt.Printf("Failed to update request data in DB: %v\n", err)
-		}
-	} else {
-		// Create
-		model = FeishuRequestModel{
-			ID:        id,
-			Data:      string(data),
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var existing FeishuRequestModel
+		if err := tx.First(&existing, "id = ?", id).Error; err == nil {
+			// Update
+			if err := writeHeader(tx, rows.header, existing.Version, time.Now()); err != nil {
+				return err
+			}
+			rows.header.Version = existing.Version + 1
+		} else {
+			// Create
+			if err := tx.Create(&rows.header).Error; err != nil {
+				return err
+			}
 		}
-		if err := db.Create(&model).Error; err != nil {
-			fmt.Printf("Failed to create request data in DB: %v\n", err)
+		return replaceChildren(tx, id, rows)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save request data in DB: %v", err)
+	}
+	req.version = rows.header.Version
+	return nil
+}
+
+// compareAndSwapLocked 仅当数据库中的版本仍为 req.version 时写回并递增版本
+// 返回 false 表示请求已被其他副本修改（或已删除），调用方需重新读取后重试
+// 注意：调用此方法前必须持有锁 s.mu
+func (s *RequestStore) compareAndSwapLocked(db *gorm.DB, id string, req *StoredRequest) (bool, error) {
+	rows, err := toRows(id, req)
+	if err != nil {
+		return false, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := writeHeader(tx, rows.header, req.version, time.Now()); err != nil {
+			return err
 		}
+		return replaceChildren(tx, id, rows)
+	})
+	if errors.Is(err, errVersionConflict) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
 	}
+	req.version++
+	return true, nil
 }
 
 // loadFromDB 从数据库加载请求数据
@@ -108,13 +176,22 @@ func (s *RequestStore) loadFromDB(id string) *StoredRequest {
 	}
 	s.ensureTable(db)
 
-	var model FeishuRequestModel
-	if err := db.First(&model, "id = ?", id).Error; err != nil {
+	rows, err := readRows(db, id)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			fmt.Printf("Failed to load request %s: %v\n", id, err)
+		}
 		return nil
 	}
 
-	var req StoredRequest
-	if err := json.Unmarshal([]byte(model.Data), &req); err != nil {
+	var req *StoredRequest
+	if rows.header.Data != "" {
+		// 尚未迁移的旧数据
+		req, err = legacyRequest(rows.header)
+	} else {
+		req, err = fromRows(rows)
+	}
+	if err != nil {
 		fmt.Printf("Failed to unmarshal request data: %v\n", err)
 		return nil
 	}
@@ -125,21 +202,37 @@ func (s *RequestStore) loadFromDB(id string) *StoredRequest {
 	if req.ActionCounts == nil {
 		req.ActionCounts = make(map[string]int)
 	}
-	return &req
+	// 旧数据没有记录创建时间，以数据库行的创建时间为准
+	if req.CreatedAt.IsZero() {
+		req.CreatedAt = rows.header.CreatedAt
+	}
+	return req
 }
 
 func (s *RequestStore) Save(id string, req GrayCardRequest) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	now := time.Now()
 	stored := &StoredRequest{
 		OriginalRequest: req,
 		DisabledActions: make(map[string]bool),
 		ActionCounts:    make(map[string]int),
+		CreatedAt:       now,
+		RenewedAt:       now,
+	}
+	if ttl := requestTTL(req); ttl > 0 {
+		stored.ExpiresAt = now.Add(ttl)
 	}
-	s.data.Store(id, stored)
 	// 持久化
-	s.saveToDB(id, stored)
+	if err := s.saveToDB(id, stored); err != nil {
+		fmt.Printf("Failed to save request %s: %v\n", id, err)
+	} else {
+		stored.checkedAt = now
+	}
+	s.data.Store(id, stored)
+	s.touchLocked(id)
+	s.evictLocked(now)
 }
 
 func (s *RequestStore) Delete(id string) {
@@ -147,88 +240,156 @@ func (s *RequestStore) Delete(id string) {
 	defer s.mu.Unlock()
 
 	s.data.Delete(id)
+	delete(s.lastUsed, id)
 
 	db := s.getDB()
 	if db != nil {
-		db.Delete(&FeishuRequestModel{}, "id = ?", id)
+		db.Transaction(func(tx *gorm.DB) error {
+			if err := deleteChildren(tx, id); err != nil {
+				return err
+			}
+			return tx.Delete(&FeishuRequestModel{}, "id = ?", id).Error
+		})
 	}
 }
 
+// Get 返回请求数据；返回的对象只读，修改需通过 RequestStore 的方法
+// 数据库可用时校验缓存的版本号，其他副本修改过的请求会重新加载
 func (s *RequestStore) Get(id string) (*StoredRequest, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// 先查内存
-	val, ok := s.data.Load(id)
-	if ok {
-		// 返回深拷贝，防止外部并发修改导致 panic
-		return val.(*StoredRequest), true
-	}
-
-	// 查数据库
-	loaded := s.loadFromDB(id)
-	if loaded != nil {
-		s.data.Store(id, loaded) // 回填内存
-		return loaded, true
-	}
-
-	return nil, false
+	req := s.loadLocked(id)
+	return req, req != nil
 }
 
-// MarkActionDisabled 标记某个动作已禁用
-func (s *RequestStore) MarkActionDisabled(id, serviceName, action string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	// 内部直接获取原始对象，避免深拷贝带来的开销和状态不一致
-	val, ok := s.data.Load(id)
-	var req *StoredRequest
+// loadLocked 返回请求的最新版本：内存中的版本与数据库一致时直接使用缓存，否则从数据库重新加载
+// 数据库不可用时只使用内存
+// 注意：调用此方法前必须持有锁 s.mu
+func (s *RequestStore) loadLocked(id string) *StoredRequest {
+	var cached *StoredRequest
+	if val, ok := s.data.Load(id); ok {
+		cached = val.(*StoredRequest)
+	}
 
-	if !ok {
-		// 尝试从数据库加载
-		req = s.loadFromDB(id)
-		if req == nil {
-			fmt.Printf("MarkActionDisabled: ID %s not found\n", id)
-			return
+	db := s.getDB()
+	if db == nil {
+		if cached != nil {
+			s.touchLocked(id)
 		}
-		s.data.Store(id, req)
-	} else {
-		req = val.(*StoredRequest)
+		return cached
 	}
+	s.ensureTable(db)
 
-	key := serviceName + ":" + action
-	req.DisabledActions[key] = true
+	now := time.Now()
+	if cached != nil && now.Sub(cached.checkedAt) < versionCheckInterval {
+		s.touchLocked(id)
+		return cached
+	}
+	if cached != nil {
+		var versions []int64
+		err := db.Model(&FeishuRequestModel{}).Where("id = ?", id).Pluck("version", &versions).Error
+		if err != nil {
+			// 数据库暂时不可用时继续使用缓存
+			fmt.Printf("Failed to check request version %s: %v\n", id, err)
+			s.touchLocked(id)
+			return cached
+		}
+		if len(versions) == 1 && versions[0] == cached.version {
+			cached.checkedAt = now
+			s.touchLocked(id)
+			return cached
+		}
+	}
 
-	// 更新持久化
-	s.saveToDB(id, req)
+	// 缓存缺失或已被其他副本修改、删除
+	req := s.loadFromDB(id)
+	if req == nil {
+		s.data.Delete(id)
+		delete(s.lastUsed, id)
+		return nil
+	}
+	req.checkedAt = now
+	s.data.Store(id, req)
+	s.touchLocked(id)
+	return req
 }
 
-// IncrementActionCount 增加动作执行次数
-func (s *RequestStore) IncrementActionCount(id, serviceName, action string) {
+// mutate 修改请求并写回：fn 作用于最新版本的副本，按版本号比较写回，被其他副本抢先修改时重新读取重试
+// fn 返回 false 表示不修改；请求不存在、fn 返回 false 或重试耗尽时返回 false
+// fn 在重试时会被再次调用，只能修改传入的请求和覆盖外部变量
+func (s *RequestStore) mutate(id string, fn func(req *StoredRequest) bool) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	val, ok := s.data.Load(id)
-	var req *StoredRequest
+	db := s.getDB()
+	if db == nil {
+		// 仅内存模式：修改副本后替换缓存，持有旧对象的读者不受影响
+		cached := s.loadLocked(id)
+		if cached == nil {
+			return false
+		}
+		req, err := cached.clone(id)
+		if err != nil {
+			fmt.Printf("Failed to copy request %s: %v\n", id, err)
+			return false
+		}
+		if !fn(req) {
+			return false
+		}
+		s.data.Store(id, req)
+		return true
+	}
 
-	if !ok {
-		req = s.loadFromDB(id)
+	for attempt := 0; attempt < maxUpdateRetries; attempt++ {
+		// 从数据库读取副本修改，写回成功前不影响缓存
+		req := s.loadFromDB(id)
 		if req == nil {
-			return
+			s.data.Delete(id)
+			delete(s.lastUsed, id)
+			return false
 		}
-		s.data.Store(id, req)
-	} else {
-		req = val.(*StoredRequest)
+		if !fn(req) {
+			return false
+		}
+
+		ok, err := s.compareAndSwapLocked(db, id, req)
+		if err != nil {
+			fmt.Printf("Failed to update request data in DB: %v\n", err)
+			return false
+		}
+		if ok {
+			req.checkedAt = time.Now()
+			s.data.Store(id, req)
+			s.touchLocked(id)
+			return true
+		}
+		fmt.Printf("Request %s was modified concurrently, retrying (%d/%d)\n", id, attempt+1, maxUpdateRetries)
 	}
+	fmt.Printf("Failed to update request %s: too many concurrent modifications\n", id)
+	return false
+}
 
-	key := serviceName + ":" + action
-	if req.ActionCounts == nil {
-		req.ActionCounts = make(map[string]int)
+// MarkActionDisabled 标记某个动作已禁用
+func (s *RequestStore) MarkActionDisabled(id, serviceName, action string) {
+	ok := s.mutate(id, func(req *StoredRequest) bool {
+		req.DisabledActions[serviceName+":"+action] = true
+		return true
+	})
+	if !ok {
+		fmt.Printf("MarkActionDisabled: ID %s not found\n", id)
 	}
-	req.ActionCounts[key]++
+}
 
-	// 更新持久化
-	s.saveToDB(id, req)
+// IncrementActionCount 增加动作执行次数
+func (s *RequestStore) IncrementActionCount(id, serviceName, action string) {
+	s.mutate(id, func(req *StoredRequest) bool {
+		if req.ActionCounts == nil {
+			req.ActionCounts = make(map[string]int)
+		}
+		req.ActionCounts[serviceName+":"+action]++
+		return true
+	})
 }
 
 // GetActionCount 获取动作执行次数
@@ -255,3 +416,206 @@ func (s *RequestStore) IsActionDisabled(id, serviceName, action string) bool {
 	key := serviceName + ":" + action
 	return req.DisabledActions[key]
 }
+
+// updateService 修改请求中指定的服务，服务不存在时返回 false
+func (s *RequestStore) updateService(id, serviceName string, fn func(svc *Service) bool) bool {
+	return s.mutate(id, func(req *StoredRequest) bool {
+		for i := range req.OriginalRequest.Services {
+			if req.OriginalRequest.Services[i].Name == serviceName {
+				return fn(&req.OriginalRequest.Services[i])
+			}
+		}
+		return false
+	})
+}
+
+// SelectBranch 记录某个服务在卡片下拉框中选中的分支，分支必须在候选列表中
+func (s *RequestStore) SelectBranch(id, serviceName, branch string) bool {
+	return s.updateService(id, serviceName, func(svc *Service) bool {
+		for _, b := range svc.Branches {
+			if b == branch {
+				svc.SelectedBranch = branch
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// SetRollbackOptions 设置（或以 nil 清空）服务的可回滚版本列表
+func (s *RequestStore) SetRollbackOptions(id, serviceName string, options []RollbackOption) bool {
+	return s.updateService(id, serviceName, func(svc *Service) bool {
+		svc.RollbackOptions = options
+		return true
+	})
+}
+
+// Extend 将请求的有效期延长到当前时间之后 ttl，已过期的请求也会被恢复
+// 返回续期前请求是否已过期
+func (s *RequestStore) Extend(id string, ttl time.Duration) (wasExpired bool, ok bool) {
+	ok = s.mutate(id, func(req *StoredRequest) bool {
+		now := time.Now()
+		wasExpired = req.IsExpired(now)
+		req.RenewedAt = now
+		req.ExpiresAt = now.Add(ttl)
+		// 续期重新打开已关闭的请求
+		req.ClosedAt = time.Time{}
+		return true
+	})
+	return wasExpired && ok, ok
+}
+
+// StartBuild 追加一条进行中的构建记录，返回记录下标
+func (s *RequestStore) StartBuild(id string, record BuildRecord) int {
+	index := -1
+	ok := s.mutate(id, func(req *StoredRequest) bool {
+		req.Builds = append(req.Builds, record)
+		req.SummarySent = false
+		index = len(req.Builds) - 1
+		return true
+	})
+	if !ok {
+		return -1
+	}
+	return index
+}
+
+// UpdateBuild 更新构建记录；构建结束后若所有服务都已到达终态，
+// 返回 true 且只返回一次，调用方据此发送汇总卡片
+func (s *RequestStore) UpdateBuild(id string, index int, update func(*BuildRecord)) (summaryDue bool) {
+	ok := s.mutate(id, func(req *StoredRequest) bool {
+		summaryDue = false
+		if index < 0 || index >= len(req.Builds) {
+			return false
+		}
+
+		update(&req.Builds[index])
+		if !req.SummarySent && req.allServicesFinished() {
+			req.SummarySent = true
+			summaryDue = true
+		}
+		return true
+	})
+	return ok && summaryDue
+}
+
+// allServicesFinished 卡片上展示的每个服务都有构建记录，且没有进行中的构建
+func (r *StoredRequest) allServicesFinished() bool {
+	for _, b := range r.Builds {
+		if !b.Finished() {
+			return false
+		}
+	}
+	for _, svc := range GrayView(r.OriginalRequest).Services {
+		if _, ok := r.LatestBuild(svc.Name); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// LatestBuild 返回服务最近一次构建记录
+func (r *StoredRequest) LatestBuild(serviceName string) (BuildRecord, bool) {
+	for i := len(r.Builds) - 1; i >= 0; i-- {
+		if r.Builds[i].Service == serviceName {
+			return r.Builds[i], true
+		}
+	}
+	return BuildRecord{}, false
+}
+
+// StartBatch 开始一次批量发布，已有批量发布在执行时返回 false
+func (s *RequestStore) StartBatch(id string, stages [][]string) bool {
+	return s.mutate(id, func(req *StoredRequest) bool {
+		if req.Batch != nil && req.Batch.Status == BatchRunning {
+			return false
+		}
+
+		req.Batch = &BatchState{
+			Stages:    stages,
+			Status:    BatchRunning,
+			StartedAt: time.Now(),
+		}
+		return true
+	})
+}
+
+// UpdateBatch 更新批量发布进度
+func (s *RequestStore) UpdateBatch(id string, update func(*BatchState)) {
+	s.mutate(id, func(req *StoredRequest) bool {
+		if req.Batch == nil {
+			return false
+		}
+		update(req.Batch)
+		return true
+	})
+}
+
+// AdvanceGrayPhase 记录服务触发的灰度阶段并返回该阶段的流量百分比，阶段无效时不记录（见 Service.GrayPhasePercent）
+func (s *RequestStore) AdvanceGrayPhase(id, serviceName string, phase int) (int, bool) {
+	var percent int
+	ok := s.updateService(id, serviceName, func(svc *Service) bool {
+		var valid bool
+		if percent, valid = svc.GrayPhasePercent(phase); !valid {
+			return false
+		}
+		svc.GrayPhase = phase + 1
+		return true
+	})
+	if !ok {
+		return 0, false
+	}
+	return percent, true
+}
+
+// SetPromoteAt 设置（或以零值清除）服务计划自动发布的时间
+func (s *RequestStore) SetPromoteAt(id, serviceName string, at time.Time) bool {
+	return s.updateService(id, serviceName, func(svc *Service) bool {
+		svc.PromoteNoticeSent = false
+		if at.IsZero() {
+			svc.PromoteAt = 0
+		} else {
+			svc.PromoteAt = at.Unix()
+		}
+		return true
+	})
+}
+
+// ClaimPromoteNotice 标记 promoteAt 计划的提醒已发送，返回 false 表示计划已变化或提醒已由其他副本发送
+func (s *RequestStore) ClaimPromoteNotice(id, serviceName string, promoteAt time.Time) bool {
+	return s.updateService(id, serviceName, func(svc *Service) bool {
+		if svc.PromoteAt != promoteAt.Unix() || svc.PromoteNoticeSent {
+			return false
+		}
+		svc.PromoteNoticeSent = true
+		return true
+	})
+}
+
+// ClaimPromotion 清除 promoteAt 计划并返回 true，计划已变化或已由其他副本执行时返回 false
+func (s *RequestStore) ClaimPromotion(id, serviceName string, promoteAt time.Time) bool {
+	return s.updateService(id, serviceName, func(svc *Service) bool {
+		if svc.PromoteAt == 0 || svc.PromoteAt != promoteAt.Unix() {
+			return false
+		}
+		svc.PromoteAt = 0
+		svc.PromoteNoticeSent = false
+		return true
+	})
+}
+
+// SetAcceptance 更新服务的验收状态
+func (s *RequestStore) SetAcceptance(id, serviceName string, acceptance Acceptance) bool {
+	return s.updateService(id, serviceName, func(svc *Service) bool {
+		svc.Acceptance = &acceptance
+		return true
+	})
+}
+
+// SetReasonAction 展开（或以空值收起）服务等待填写原因的动作表单
+func (s *RequestStore) SetReasonAction(id, serviceName, action string) bool {
+	return s.updateService(id, serviceName, func(svc *Service) bool {
+		svc.ReasonAction = action
+		return true
+	})
+}
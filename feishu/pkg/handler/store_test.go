@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"devops/feishu/config"
+)
+
+func TestRequestStoreReplicas(t *testing.T) {
+	if cfg, _ := config.LoadConfig(); cfg == nil || cfg.GetDB() == nil {
+		t.Skip("database is not available")
+	}
+
+	// 两个独立的存储模拟两个副本，共享同一个数据库
+	replicaA, replicaB := &RequestStore{}, &RequestStore{}
+	id := fmt.Sprintf("test-req-replicas-%d", time.Now().UnixNano())
+	replicaA.Save(id, GrayCardRequest{Services: []Service{
+		{Name: "svc", ObjectID: "proj", Branches: []string{"master", "dev"}, Actions: []string{"gray"}},
+	}})
+
+	// recheck 模拟超过版本核对间隔，下次读取时重新与数据库核对
+	recheck := func(s *RequestStore) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if val, ok := s.data.Load(id); ok {
+			val.(*StoredRequest).checkedAt = time.Time{}
+		}
+	}
+
+	t.Run("read through", func(t *testing.T) {
+		// 副本 B 先缓存，再由副本 A 修改
+		if _, ok := replicaB.Get(id); !ok {
+			t.Fatal("Replica B should load the request from database")
+		}
+		replicaA.MarkActionDisabled(id, "svc", "do_gray_release")
+		// 核对间隔内（同一次回调）直接使用缓存，不再查询版本号
+		if replicaB.IsActionDisabled(id, "svc", "do_gray_release") {
+			t.Error("Replica B should use its cache within the check interval")
+		}
+		recheck(replicaB)
+		if !replicaB.IsActionDisabled(id, "svc", "do_gray_release") {
+			t.Error("Replica B should see the change made by replica A")
+		}
+	})
+
+	t.Run("no lost updates", func(t *testing.T) {
+		replicaA.IncrementActionCount(id, "svc", "do_gray_release")
+		replicaB.IncrementActionCount(id, "svc", "do_gray_release")
+		recheck(replicaA)
+		if a, b := replicaA.GetActionCount(id, "svc", "do_gray_release"), replicaB.GetActionCount(id, "svc", "do_gray_release"); a != 2 || b != 2 {
+			t.Errorf("Expected count 2 on both replicas, got A=%d B=%d", a, b)
+		}
+	})
+
+	t.Run("retry on conflict", func(t *testing.T) {
+		attempts := 0
+		ok := replicaA.mutate(id, func(req *StoredRequest) bool {
+			attempts++
+			if attempts == 1 {
+				// 副本 A 写回前副本 B 抢先修改，A 的写回应失败并基于最新数据重试
+				replicaB.SelectBranch(id, "svc", "dev")
+			}
+			req.ActionCounts["svc:do_restart"]++
+			return true
+		})
+		if !ok || attempts != 2 {
+			t.Fatalf("Expected one retry, got ok=%v attempts=%d", ok, attempts)
+		}
+
+		recheck(replicaB)
+		req, _ := replicaB.Get(id)
+		if req.ActionCounts["svc:do_restart"] != 1 || req.OriginalRequest.Services[0].SelectedBranch != "dev" {
+			t.Errorf("Both updates should be kept, got counts=%v branch=%s", req.ActionCounts, req.OriginalRequest.Services[0].SelectedBranch)
+		}
+	})
+
+	t.Run("readers keep their snapshot", func(t *testing.T) {
+		before, _ := replicaA.Get(id)
+		count := before.ActionCounts["svc:do_restart"]
+		replicaA.IncrementActionCount(id, "svc", "do_restart")
+		after, _ := replicaA.Get(id)
+		if before.ActionCounts["svc:do_restart"] != count || after.ActionCounts["svc:do_restart"] != count+1 {
+			t.Errorf("Expected a new object after update, got before=%d after=%d", before.ActionCounts["svc:do_restart"], after.ActionCounts["svc:do_restart"])
+		}
+	})
+}
+
+func TestRequestClone(t *testing.T) {
+	req := &StoredRequest{
+		OriginalRequest: GrayCardRequest{Title: "发布", Services: []Service{
+			{Name: "svc", Branches: []string{"master"}, Actions: []string{"gray"}, GrayPhase: 1, Acceptance: &Acceptance{Status: AcceptancePending}},
+		}},
+		DisabledActions: map[string]bool{"svc:do_gray_release": true},
+		ActionCounts:    map[string]int{"svc:do_gray_release": 1},
+		Builds:          []BuildRecord{{Service: "svc", BuildNumber: 3}},
+		version:         4,
+	}
+	cp, err := req.clone("test-req-clone")
+	if err != nil {
+		t.Fatalf("clone failed: %v", err)
+	}
+	cp.ActionCounts["svc:do_gray_release"]++
+	cp.OriginalRequest.Services[0].Branches[0] = "dev"
+	cp.OriginalRequest.Services[0].Acceptance.Status = AcceptancePassed
+	cp.Builds[0].BuildNumber = 4
+
+	svc := req.OriginalRequest.Services[0]
+	if req.ActionCounts["svc:do_gray_release"] != 1 || svc.Branches[0] != "master" || svc.Acceptance.Status != AcceptancePending || req.Builds[0].BuildNumber != 3 {
+		t.Errorf("Original request should not change, got %+v", req)
+	}
+	if cp.version != 4 || cp.OriginalRequest.Services[0].GrayPhase != 1 || !cp.DisabledActions["svc:do_gray_release"] {
+		t.Errorf("Clone should keep state, got %+v", cp)
+	}
+}
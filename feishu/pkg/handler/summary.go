@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"devops/feishu/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// historyURL 返回请求构建历史接口的访问地址
+func historyURL(requestID string) string {
+	base := "http://localhost:8080"
+	if cfg, err := config.LoadConfig(); err == nil && cfg != nil && cfg.PublicURL != "" {
+		base = cfg.PublicURL
+	}
+	return fmt.Sprintf("%s/app/api/v1/feishu/requests/%s/history", strings.TrimRight(base, "/"), requestID)
+}
+
+// resultIcon 构建结果对应的图标
+func resultIcon(result string) string {
+	switch result {
+	case "SUCCESS":
+		return "✅"
+	case "ABORTED":
+		return "⏹️"
+	default:
+		return "❌"
+	}
+}
+
+// BuildSummaryCard 构建发布汇总卡片，列出每个服务最近一次构建的结果
+func BuildSummaryCard(requestID string, storedReq *StoredRequest) map[string]interface{} {
+	view := GrayView(storedReq.OriginalRequest)
+
+	elements := []interface{}{}
+	success, failed := 0, 0
+	var total time.Duration
+	for i, svc := range view.Services {
+		record, ok := storedReq.LatestBuild(svc.Name)
+		if !ok {
+			continue
+		}
+		if record.Result == "SUCCESS" {
+			success++
+		} else {
+			failed++
+		}
+		duration := time.Duration(record.DurationMs) * time.Millisecond
+		total += duration
+
+		operator := "-"
+		if record.Operator != "" {
+			operator = fmt.Sprintf("<at id=%s></at>", record.Operator)
+		}
+		deployType := record.DeployType
+		if record.GrayPercent > 0 {
+			deployType = fmt.Sprintf("%s %d%%", deployType, record.GrayPercent)
+		}
+		buildNumber := "-"
+		if record.BuildNumber > 0 {
+			buildNumber = fmt.Sprintf("#%d", record.BuildNumber)
+		}
+
+		content := fmt.Sprintf("**%d. %s** %s %s\n📦 分支：`%s`　类型：%s　构建：%s　耗时：%s　操作人：%s",
+			i+1, svc.Name, resultIcon(record.Result), record.Result,
+			record.Branch, deployType, buildNumber, duration.Round(time.Second), operator)
+		if reason := reasonText(record.Reason, record.IncidentID); reason != "" {
+			content += "\n📝 原因：" + reason
+		}
+		elements = append(elements, map[string]interface{}{
+			"tag": "div",
+			"text": map[string]interface{}{
+				"tag":     "lark_md",
+				"content": content,
+			},
+		})
+	}
+
+	template := "green"
+	if failed > 0 {
+		template = "red"
+	}
+
+	elements = append(elements,
+		map[string]interface{}{"tag": "hr"},
+		map[string]interface{}{
+			"tag": "div",
+			"text": map[string]interface{}{
+				"tag":     "lark_md",
+				"content": fmt.Sprintf("📊 **合计：** %d 个服务，成功 %d，失败 %d，总耗时 %s", success+failed, success, failed, total.Round(time.Second)),
+			},
+		},
+		map[string]interface{}{
+			"tag": "action",
+			"actions": []interface{}{
+				map[string]interface{}{
+					"tag": "button",
+					"text": map[string]interface{}{
+						"tag":     "plain_text",
+						"content": "📜 查看发布历史",
+					},
+					"type": "default",
+					"url":  historyURL(requestID),
+				},
+			},
+		},
+	)
+
+	title := "发布汇总"
+	if len(view.Services) > 0 && view.Services[0].ObjectID != "" {
+		title = fmt.Sprintf("📋%s-发布汇总", view.Services[0].ObjectID)
+	}
+	title = dryRunPrefix(view) + title
+
+	return map[string]interface{}{
+		"header": map[string]interface{}{
+			"title": map[string]interface{}{
+				"content": title,
+				"tag":     "plain_text",
+			},
+			"template": template,
+		},
+		"elements": elements,
+	}
+}
+
+// sendSummaryCard 所有服务发布结束后发送汇总卡片
+func sendSummaryCard(ctx context.Context, requestID string) {
+	storedReq, ok := GlobalStore.Get(requestID)
+	if !ok {
+		return
+	}
+	req := storedReq.OriginalRequest
+	if req.ReceiveID == "" || req.ReceiveIDType == "" {
+		return
+	}
+	client := clientFor(req.Project)
+	if client == nil {
+		fmt.Println("Feishu client is nil, cannot send summary card:", requestID)
+		return
+	}
+
+	cardBytes, err := json.Marshal(BuildSummaryCard(requestID, storedReq))
+	if err != nil {
+		fmt.Printf("Failed to marshal summary card: %v\n", err)
+		return
+	}
+	if err := client.SendMessage(ctx, req.ReceiveID, req.ReceiveIDType, "interactive", string(cardBytes)); err != nil {
+		fmt.Printf("Failed to send summary card: %v\n", err)
+	}
+}
+
+// RequestHistory 返回请求触发的全部构建记录
+func (h *Handler) RequestHistory(c *gin.Context) {
+	requestID := c.Param("id")
+	storedReq, ok := GlobalStore.Get(requestID)
+	if !ok {
+		h.writeError(c, http.StatusNotFound, fmt.Sprintf("request %s not found", requestID))
+		return
+	}
+
+	builds := storedReq.Builds
+	if builds == nil {
+		builds = []BuildRecord{}
+	}
+	h.writeSuccess(c, map[string]interface{}{
+		"request_id": requestID,
+		"title":      storedReq.OriginalRequest.Title,
+		"created_at": storedReq.CreatedAt,
+		"builds":     builds,
+	})
+}
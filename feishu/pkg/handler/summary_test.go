@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReleaseSummary(t *testing.T) {
+	reqID := "test-req-summary-001"
+	GlobalStore.Save(reqID, GrayCardRequest{
+		Services: []Service{
+			{Name: "svc-a", ObjectID: "proj", Branches: []string{"master"}, Actions: []string{"gray"}},
+			{Name: "svc-b", ObjectID: "proj", Branches: []string{"dev"}, Actions: []string{"gray"}},
+		},
+	})
+
+	finish := func(result string, buildNum int64) func(*BuildRecord) {
+		return func(r *BuildRecord) {
+			r.Result = result
+			r.BuildNumber = buildNum
+			r.DurationMs = 30000
+			r.FinishedAt = time.Now()
+		}
+	}
+
+	a := GlobalStore.StartBuild(reqID, BuildRecord{Service: "svc-a", Branch: "master", DeployType: "Gray", Operator: "ou_a"})
+	b := GlobalStore.StartBuild(reqID, BuildRecord{Service: "svc-b", Branch: "dev", DeployType: "Gray"})
+
+	// 只有一个服务结束时不发送汇总
+	if GlobalStore.UpdateBuild(reqID, a, finish("SUCCESS", 11)) {
+		t.Fatal("Summary should wait until every service has finished")
+	}
+	// 最后一个服务结束时发送汇总，且只发送一次
+	if !GlobalStore.UpdateBuild(reqID, b, finish("FAILURE", 7)) {
+		t.Fatal("Summary should be due once every service has finished")
+	}
+	if GlobalStore.UpdateBuild(reqID, b, finish("FAILURE", 7)) {
+		t.Error("Summary should only be sent once")
+	}
+
+	storedReq, _ := GlobalStore.Get(reqID)
+	card := BuildSummaryCard(reqID, storedReq)
+	header, _ := card["header"].(map[string]interface{})
+	if header["template"] != "red" {
+		t.Errorf("Expected red header when a build failed, got %v", header["template"])
+	}
+	content, _ := json.Marshal(card)
+	for _, want := range []string{"#11", "#7", "at id=ou_a", "成功 1，失败 1", "/app/api/v1/feishu/requests/" + reqID + "/history"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("Summary card should contain %q", want)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package handler
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 // APIResponse 统一API响应结构
 type APIResponse struct {
@@ -18,25 +21,183 @@ type SendRequest struct {
 }
 
 // Service 定义服务信息
+// json 标签为 "-" 的字段是服务端维护的状态，保存在 feishu_request_services 中，不从发卡请求读取，避免调用方预置（如直接标记验收通过）
 type Service struct {
-	Name     string   `json:"name"`
-	ObjectID string   `json:"object_id"`
-	Branches []string `json:"branches"`
-	Actions  []string `json:"actions"` // 支持多个动作，如 ["gray", "official"]
+	Name           string   `json:"name"` // 服务名即 Jenkins Job 全名，支持文件夹（team-a/service-x）和多分支流水线的分支 Job（service-x/feature%2Fabc）
+	ObjectID       string   `json:"object_id"`
+	Branches       []string `json:"branches"`
+	Actions        []string `json:"actions"`                   // 支持多个动作，如 ["gray", "official"]
+	SelectedBranch string   `json:"selected_branch,omitempty"` // 卡片下拉框选中的分支，为空时使用 Branches[0]
+
+	// RollbackOptions 点击回滚后展示的可选历史版本，选择或取消后清空
+	RollbackOptions []RollbackOption `json:"-"`
+
+	// DependsOn 批量发布时需先发布成功的服务，未配置 plan.stages 时据此划分阶段
+	DependsOn []string `json:"depends_on,omitempty"`
+
+	// GrayPhases 分阶段灰度的流量百分比，如 [5, 25, 50, 100]；为空时灰度为单次构建
+	GrayPhases []int `json:"gray_phases,omitempty"`
+	// GrayPhase 已触发的灰度阶段数，下一阶段为 GrayPhases[GrayPhase]
+	GrayPhase int `json:"-"`
+
+	// AutoPromote 灰度成功后自动转正式发布的策略，为空时不自动发布
+	AutoPromote *AutoPromotePolicy `json:"auto_promote,omitempty"`
+	// PromoteAt 计划自动发布的时间（Unix 秒），0 表示未计划或已取消
+	PromoteAt int64 `json:"-"`
+	// PromoteNoticeSent 本次计划的自动发布提醒已发送，多副本只发送一次
+	PromoteNoticeSent bool `json:"-"`
+
+	// ReasonAction 等待填写原因的动作回调值（如 do_restart），提交或取消后清空
+	ReasonAction string `json:"-"`
+
+	// Owner 服务负责人的飞书 open_id，生产构建失败时可对其加急
+	Owner string `json:"owner,omitempty"`
+
+	// Testers 可以验收的飞书 open_id，为空时使用卡片的 testers，都为空时不限制
+	Testers []string `json:"testers,omitempty"`
+	// Acceptance 验收状态，配置了 check 动作的服务灰度成功后进入待验收
+	Acceptance *Acceptance `json:"-"`
+}
+
+// Acceptance 服务的验收结果
+type Acceptance struct {
+	Status   string `json:"status"` // pending / passed / rejected
+	Comment  string `json:"comment,omitempty"`
+	Operator string `json:"operator,omitempty"` // 验收人的飞书 open_id
+	At       int64  `json:"at,omitempty"`       // 验收时间（Unix 秒）
+}
+
+// 验收状态
+const (
+	AcceptancePending  = "pending"
+	AcceptancePassed   = "passed"
+	AcceptanceRejected = "rejected"
+)
+
+// AutoPromotePolicy 灰度观察期结束后自动触发正式发布
+type AutoPromotePolicy struct {
+	SoakMinutes    int    `json:"soak_minutes"`               // 灰度成功后的观察时间
+	NoticeMinutes  int    `json:"notice_minutes,omitempty"`   // 提前多少分钟在群里提醒，默认 10 分钟
+	HealthCheckURL string `json:"health_check_url,omitempty"` // 发布前检查的健康检查地址，返回 2xx 视为通过
+}
+
+// RollbackOption 可回滚的历史构建
+type RollbackOption struct {
+	BuildNumber  int64  `json:"build_number"`
+	Branch       string `json:"branch"`
+	ImageVersion string `json:"image_version"`
+	BuiltAt      int64  `json:"built_at"` // Unix 秒
+}
+
+// GrayPhasePercent 返回可以触发的灰度阶段的流量百分比
+// 允许重试当前阶段或跳到后续阶段，已完成的更早阶段不可再触发
+func (s Service) GrayPhasePercent(phase int) (int, bool) {
+	if phase < 0 || phase >= len(s.GrayPhases) || phase < s.GrayPhase-1 {
+		return 0, false
+	}
+	return s.GrayPhases[phase], true
+}
+
+// resetState 清空服务端维护的状态，用于以已有请求为模板生成新卡片
+func (s *Service) resetState() {
+	s.RollbackOptions = nil
+	s.GrayPhase = 0
+	s.PromoteAt = 0
+	s.PromoteNoticeSent = false
+	s.ReasonAction = ""
+	s.Acceptance = nil
+}
+
+// CurrentBranch 返回当前用于发布的分支：优先使用下拉框选中的分支（需在候选列表中），否则取第一个候选分支
+func (s Service) CurrentBranch() string {
+	if s.SelectedBranch != "" {
+		for _, b := range s.Branches {
+			if b == s.SelectedBranch {
+				return b
+			}
+		}
+	}
+	if len(s.Branches) > 0 {
+		return s.Branches[0]
+	}
+	return ""
 }
 
 // GrayCardRequest 定义灰度卡片构建请求
 type GrayCardRequest struct {
-	Title         string    `json:"title"`
-	Services      []Service `json:"services"`
-	ObjectID      string    `json:"object_id"`
-	ReceiveID     string    `json:"receive_id,omitempty"`
-	ReceiveIDType string    `json:"receive_id_type,omitempty"`
+	Title         string       `json:"title"`
+	Services      []Service    `json:"services"`
+	ObjectID      string       `json:"object_id"`
+	Project       string       `json:"project,omitempty"`         // 所属项目，用于选择发送消息的飞书应用
+	Environment   string       `json:"environment,omitempty"`     // 发布环境，如 prod / staging，记录到发布历史
+	Testers       []string     `json:"testers,omitempty"`         // 默认验收人的飞书 open_id，服务未配置 testers 时使用
+	Initiator     string       `json:"initiator,omitempty"`       // 发布申请发起人的飞书 ID，构建结果通知中 @ 提醒
+	DryRun        bool         `json:"dry_run,omitempty"`         // 演练模式，构建由模拟替代，卡片和通知标注「演练」
+	DryRunResult  string       `json:"dry_run_result,omitempty"`  // 演练时模拟的构建结果，为空时使用 DRY_RUN_RESULT
+	DryRunSeconds int          `json:"dry_run_seconds,omitempty"` // 演练时模拟的构建耗时（秒），为空时使用 DRY_RUN_DURATION
+	TTLSeconds    int          `json:"ttl_seconds,omitempty"`     // 卡片有效期（秒），为空时使用 REQUEST_TTL
+	Plan          *ReleasePlan `json:"plan,omitempty"`            // 批量发布计划，为空时所有服务同时发布
+	ReceiveID     string       `json:"receive_id,omitempty"`
+	ReceiveIDType string       `json:"receive_id_type,omitempty"`
+}
+
+// ReleasePlan 批量发布计划：按阶段顺序发布，上一阶段全部成功后才开始下一阶段
+type ReleasePlan struct {
+	Stages      [][]string `json:"stages,omitempty"`       // 每个阶段包含的服务，为空时按服务的 depends_on 划分
+	MaxParallel int        `json:"max_parallel,omitempty"` // 每个阶段同时构建的服务数，0 表示不限制
+	OnFailure   string     `json:"on_failure,omitempty"`   // 构建失败时的策略：stop（默认）/ continue / rollback
 }
 
+// BatchState 记录一次批量发布的执行进度
+type BatchState struct {
+	Stages     [][]string `json:"stages"`
+	Current    int        `json:"current"` // 正在执行的阶段下标
+	Status     string     `json:"status"`  // running / succeeded / failed
+	Paused     bool       `json:"paused,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt time.Time  `json:"finished_at,omitempty"`
+}
+
+// 批量发布状态
+const (
+	BatchRunning   = "running"
+	BatchSucceeded = "succeeded"
+	BatchFailed    = "failed"
+)
+
+// 批量发布失败策略
+const (
+	FailureStop     = "stop"     // 停止尚未开始的构建
+	FailureContinue = "continue" // 继续发布其余服务
+	FailureRollback = "rollback" // 停止并回滚本批次已发布成功的服务
+)
+
 // SendGrayCardRequest 发送灰度卡片请求结构
 type SendGrayCardRequest struct {
 	ReceiveID     string          `json:"receive_id"`
 	ReceiveIDType string          `json:"receive_id_type"`
+	Project       string          `json:"project,omitempty"`
 	CardData      GrayCardRequest `json:"card_data"`
 }
+
+// BuildRecord 记录卡片触发的一次 Jenkins 构建
+type BuildRecord struct {
+	Service      string    `json:"service"`
+	Branch       string    `json:"branch"`
+	DeployType   string    `json:"deploy_type"`
+	ImageVersion string    `json:"image_version,omitempty"`
+	GrayPercent  int       `json:"gray_percent,omitempty"`
+	BuildNumber  int64     `json:"build_number,omitempty"`
+	Result       string    `json:"result,omitempty"` // 为空表示构建仍在进行
+	DurationMs   int64     `json:"duration_ms,omitempty"`
+	Operator     string    `json:"operator,omitempty"` // 点击按钮的飞书 open_id
+	Reason       string    `json:"reason,omitempty"`   // 回滚、重启等操作填写的原因
+	IncidentID   string    `json:"incident_id,omitempty"`
+	StartedAt    time.Time `json:"started_at"`
+	FinishedAt   time.Time `json:"finished_at,omitempty"`
+}
+
+// Finished 构建是否已到达终态
+func (r BuildRecord) Finished() bool {
+	return r.Result != ""
+}
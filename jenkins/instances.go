@@ -0,0 +1,332 @@
+package jenkins
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+
+	c "devops/feishu/config"
+)
+
+// DefaultInstance 默认 Jenkins 实例名（JENKINS_URL / JENKINS_USER / JENKINS_TOKEN），未匹配任何路由时使用
+const DefaultInstance = "default"
+
+// Instance 一个 Jenkins master 及路由到它的项目和 Job
+type Instance struct {
+	Name     string   `json:"name"`
+	URL      string   `json:"url"`
+	User     string   `json:"user"`
+	Token    string   `json:"token,omitempty"`
+	Projects []string `json:"projects,omitempty"` // 路由到此实例的项目
+	// JobPrefixes 路由到此实例的 Job 名前缀，如 "java-"；填写完整的 Job 名即按服务单独路由
+	JobPrefixes []string `json:"job_prefixes,omitempty"`
+}
+
+// InstanceStatus 实例最近一次健康检查的结果
+type InstanceStatus struct {
+	Instance
+	Up        bool      `json:"up"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at,omitempty"`
+}
+
+var instanceUp = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "jenkins_instance_up",
+		Help: "Jenkins 实例是否可访问 (1=可访问, 0=不可访问)",
+	},
+	[]string{"instance"},
+)
+
+func init() {
+	prometheus.MustRegister(instanceUp)
+}
+
+// InstanceRegistry 管理多个 Jenkins 实例，按 Job 前缀或项目选择客户端
+type InstanceRegistry struct {
+	mu        sync.RWMutex
+	instances map[string]*Instance // key: 实例名
+	clients   map[string]*Client
+	status    map[string]InstanceStatus
+	// newDefault 创建默认实例的客户端，测试中可替换
+	newDefault func() *Client
+}
+
+// Instances 全局 Jenkins 实例注册表
+var Instances = NewInstanceRegistry()
+
+// NewInstanceRegistry 创建只有默认实例的注册表
+func NewInstanceRegistry() *InstanceRegistry {
+	return &InstanceRegistry{
+		instances:  make(map[string]*Instance),
+		clients:    make(map[string]*Client),
+		status:     make(map[string]InstanceStatus),
+		newDefault: NewClient,
+	}
+}
+
+// Register 注册或覆盖实例；注册名为 default 的实例会替换 JENKINS_URL 配置的默认实例
+func (r *InstanceRegistry) Register(inst Instance) error {
+	inst.Name = strings.TrimSpace(inst.Name)
+	if inst.Name == "" || inst.URL == "" {
+		return fmt.Errorf("jenkins instance name and url are required")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.instances[inst.Name] = &inst
+	r.clients[inst.Name] = newClient(inst.Name, inst.URL, inst.User, inst.Token)
+	return nil
+}
+
+// Route 返回 Job 应使用的实例名：最长匹配的 Job 前缀优先，其次是项目，都未匹配时为默认实例
+func (r *InstanceRegistry) Route(project, jobName string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	name, longest := "", -1
+	for _, inst := range r.instances {
+		for _, prefix := range inst.JobPrefixes {
+			// 长度相同时按实例名取较小者，保证结果稳定
+			if prefix != "" && strings.HasPrefix(jobName, prefix) &&
+				(len(prefix) > longest || (len(prefix) == longest && inst.Name < name)) {
+				name, longest = inst.Name, len(prefix)
+			}
+		}
+	}
+	if name != "" {
+		return name
+	}
+
+	if project != "" {
+		for _, inst := range r.sortedLocked() {
+			for _, p := range inst.Projects {
+				if p == project {
+					return inst.Name
+				}
+			}
+		}
+	}
+	return DefaultInstance
+}
+
+// Resolve 返回 Job 应使用的客户端，路由到的实例不可用时返回 nil
+func (r *InstanceRegistry) Resolve(project, jobName string) *Client {
+	return r.Client(r.Route(project, jobName))
+}
+
+// Client 返回指定实例的客户端，默认实例未注册时按 JENKINS_URL 创建
+func (r *InstanceRegistry) Client(name string) *Client {
+	r.mu.RLock()
+	client, ok := r.clients[name]
+	r.mu.RUnlock()
+	if ok || name != DefaultInstance {
+		return client
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if client, ok := r.clients[name]; ok {
+		return client
+	}
+	client = r.newDefault()
+	if client != nil {
+		r.clients[name] = client
+	}
+	return client
+}
+
+// List 返回所有实例及最近一次健康检查的结果（按实例名排序），不包含 Token
+func (r *InstanceRegistry) List() []InstanceStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]InstanceStatus, 0, len(r.clients)+1)
+	seen := make(map[string]bool)
+	for _, inst := range r.sortedLocked() {
+		status := r.status[inst.Name]
+		status.Instance = *inst
+		status.Token = ""
+		list = append(list, status)
+		seen[inst.Name] = true
+	}
+	if !seen[DefaultInstance] {
+		status := r.status[DefaultInstance]
+		status.Instance = Instance{Name: DefaultInstance}
+		if cfg, err := c.LoadConfig(); err == nil && cfg != nil {
+			status.URL = cfg.JenkinsURL
+		}
+		list = append([]InstanceStatus{status}, list...)
+	}
+	return list
+}
+
+// sortedLocked 按实例名排序返回实例，调用前必须持有读锁
+func (r *InstanceRegistry) sortedLocked() []*Instance {
+	list := make([]*Instance, 0, len(r.instances))
+	for _, inst := range r.instances {
+		list = append(list, inst)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// CheckHealth 依次访问每个实例的 /api/json，更新健康状态和 jenkins_instance_up 指标
+func (r *InstanceRegistry) CheckHealth(ctx context.Context) []InstanceStatus {
+	names := []string{DefaultInstance}
+	r.mu.RLock()
+	for name := range r.instances {
+		if name != DefaultInstance {
+			names = append(names, name)
+		}
+	}
+	r.mu.RUnlock()
+
+	for _, name := range names {
+		client := r.Client(name)
+		status := InstanceStatus{CheckedAt: time.Now()}
+		if client == nil {
+			status.Error = "client init failed"
+		} else if err := client.Ping(ctx); err != nil {
+			status.Error = err.Error()
+		} else {
+			status.Up = true
+		}
+
+		up := 0.0
+		if status.Up {
+			up = 1
+		}
+		instanceUp.WithLabelValues(name).Set(up)
+
+		r.mu.Lock()
+		r.status[name] = status
+		r.mu.Unlock()
+	}
+	return r.List()
+}
+
+// StartHealthCheck 按 interval 定期检查所有实例，interval 为 0 时不检查
+func (r *InstanceRegistry) StartHealthCheck(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			checkCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			r.CheckHealth(checkCtx)
+			cancel()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Ping 访问实例的 /api/json 检查是否可用
+func (c *Client) Ping(ctx context.Context) error {
+	var resp struct {
+		Mode string `json:"mode"`
+	}
+	r, err := c.jenkins.Requester.GetJSON(ctx, "/api/json", &resp, map[string]string{"tree": "mode"})
+	if err != nil {
+		return err
+	}
+	if r.StatusCode != http.StatusOK {
+		return fmt.Errorf("jenkins returned status code: %d", r.StatusCode)
+	}
+	return nil
+}
+
+// LoadFile 从 JSON 文件（实例数组）加载实例，路径为空时忽略
+func (r *InstanceRegistry) LoadFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var list []Instance
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, inst := range list {
+		if err := r.Register(inst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InstanceModel 数据库中的 Jenkins 实例，项目和 Job 前缀以逗号分隔
+type InstanceModel struct {
+	Name        string `gorm:"primaryKey;size:64"`
+	URL         string `gorm:"size:255"`
+	User        string `gorm:"size:128"`
+	Token       string `gorm:"size:255"`
+	Projects    string `gorm:"type:text"`
+	JobPrefixes string `gorm:"type:text"`
+	Del         int    `gorm:"default:0"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (InstanceModel) TableName() string {
+	return "jenkins_instances"
+}
+
+// LoadFromDB 从 jenkins_instances 表加载实例，表不存在时自动创建
+func (r *InstanceRegistry) LoadFromDB(db *gorm.DB) error {
+	if db == nil {
+		return nil
+	}
+	if !db.Migrator().HasTable(&InstanceModel{}) {
+		if err := db.AutoMigrate(&InstanceModel{}); err != nil {
+			return err
+		}
+	}
+
+	var models []InstanceModel
+	if err := db.Where("del = ?", 0).Order("name").Find(&models).Error; err != nil {
+		return err
+	}
+	for _, m := range models {
+		if err := r.Register(Instance{
+			Name:        m.Name,
+			URL:         m.URL,
+			User:        m.User,
+			Token:       m.Token,
+			Projects:    splitList(m.Projects),
+			JobPrefixes: splitList(m.JobPrefixes),
+		}); err != nil {
+			return fmt.Errorf("register jenkins instance %s: %w", m.Name, err)
+		}
+	}
+	return nil
+}
+
+// splitList 拆分逗号分隔的列表，忽略空项
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,106 @@
+package jenkins
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInstanceRegistry(t *testing.T) {
+	t.Run("route by job prefix and project", func(t *testing.T) {
+		r := NewInstanceRegistry()
+		for _, inst := range []Instance{
+			{Name: "java", URL: "http://java-jenkins", Projects: []string{"java"}, JobPrefixes: []string{"java-"}},
+			{Name: "frontend", URL: "http://fe-jenkins", Projects: []string{"web"}, JobPrefixes: []string{"web-"}},
+			// 完整 Job 名作为前缀，单独路由某个服务
+			{Name: "data", URL: "http://data-jenkins", JobPrefixes: []string{"java-etl"}},
+		} {
+			if err := r.Register(inst); err != nil {
+				t.Fatalf("Register(%s) failed: %v", inst.Name, err)
+			}
+		}
+
+		tests := []struct {
+			project, job, want string
+		}{
+			{"", "java-order", "java"},
+			{"", "java-etl", "data"},
+			{"web", "admin-console", "frontend"},
+			{"web", "java-user", "java"},
+			{"unknown", "other", DefaultInstance},
+			{"", "", DefaultInstance},
+		}
+		for _, tt := range tests {
+			if got := r.Route(tt.project, tt.job); got != tt.want {
+				t.Errorf("Route(%q, %q) = %s, want %s", tt.project, tt.job, got, tt.want)
+			}
+		}
+
+		if client := r.Resolve("", "web-home"); client == nil || client.Instance() != "frontend" {
+			t.Errorf("Expected frontend client, got %v", client)
+		}
+		if err := r.Register(Instance{Name: "broken"}); err == nil {
+			t.Error("Expected error when url is missing")
+		}
+	})
+
+	t.Run("default instance", func(t *testing.T) {
+		r := NewInstanceRegistry()
+		created := 0
+		r.newDefault = func() *Client {
+			created++
+			return newClient(DefaultInstance, "http://default-jenkins", "", "")
+		}
+		if r.Client(DefaultInstance) == nil || r.Client(DefaultInstance) == nil || created != 1 {
+			t.Errorf("Default client should be created once, created=%d", created)
+		}
+		if r.Client("missing") != nil {
+			t.Error("Unknown instance should not resolve to a client")
+		}
+	})
+
+	t.Run("health check", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"mode":"NORMAL"}`))
+		}))
+		defer srv.Close()
+		down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer down.Close()
+
+		r := NewInstanceRegistry()
+		r.Register(Instance{Name: DefaultInstance, URL: srv.URL})
+		r.Register(Instance{Name: "data", URL: down.URL, Token: "secret"})
+
+		statuses := r.CheckHealth(context.Background())
+		if len(statuses) != 2 {
+			t.Fatalf("Expected 2 statuses, got %+v", statuses)
+		}
+		for _, s := range statuses {
+			if s.Token != "" {
+				t.Error("Token should not be listed")
+			}
+			if want := s.Name == DefaultInstance; s.Up != want {
+				t.Errorf("Instance %s up=%v, want %v (error: %s)", s.Name, s.Up, want, s.Error)
+			}
+		}
+	})
+
+	t.Run("load file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "instances.json")
+		os.WriteFile(path, []byte(`[{"name":"java","url":"http://java-jenkins","projects":["java"]}]`), 0644)
+
+		r := NewInstanceRegistry()
+		if err := r.LoadFile(path); err != nil {
+			t.Fatalf("LoadFile failed: %v", err)
+		}
+		if got := r.Route("java", "order"); got != "java" {
+			t.Errorf("Expected java, got %s", got)
+		}
+	})
+}
@@ -36,7 +36,18 @@ func init() {
 }
 
 type Client struct {
-	jenkins *gojenkins.Jenkins
+	jenkins  *gojenkins.Jenkins
+	instance string // 所属 Jenkins 实例名，用于指标标签
+
+	// Job 参数定义缓存，paramTTL 为 0 时不缓存
+	paramMu    sync.Mutex
+	paramCache map[string]paramCacheEntry
+	paramTTL   time.Duration
+}
+
+// Instance 返回客户端所属的 Jenkins 实例名
+func (c *Client) Instance() string {
+	return c.instance
 }
 
 func (c *Client) Init() error {
@@ -61,8 +72,18 @@ func NewJobSupervisor(client *Client) *JobSupervisor {
 	}
 }
 
-// NewClient 创建 Jenkins 客户端
+// NewClient 创建默认 Jenkins 实例（JENKINS_URL）的客户端
 func NewClient() *Client {
+	cfg, err := c.LoadConfig()
+	if err != nil {
+		log.Printf("无法加载配置: %v", err)
+		return nil
+	}
+	return newClient(DefaultInstance, cfg.JenkinsURL, cfg.JenkinsUser, cfg.JenkinsToken)
+}
+
+// newClient 创建指定 Jenkins 实例的客户端
+func newClient(instance, baseURL, user, token string) *Client {
 	httpClient := httpc.CreateClient()
 
 	// 创建 http.Client 的副本以修改 CheckRedirect，而不影响全局 client
@@ -72,24 +93,81 @@ func NewClient() *Client {
 		return http.ErrUseLastResponse
 	}
 
-	cfg, err := c.LoadConfig()
-	if err != nil {
-		log.Printf("无法加载配置: %v", err)
-		return nil
+	jenkins := gojenkins.CreateJenkins(&clientCopy, baseURL, user, token)
+	client := &Client{
+		jenkins:  jenkins,
+		instance: instance,
 	}
+	if cfg, err := c.LoadConfig(); err == nil && cfg != nil {
+		client.paramTTL = cfg.JenkinsParamCacheTTL
+	}
+	return client
+}
 
-	jenkins := gojenkins.CreateJenkins(&clientCopy, cfg.JenkinsURL, cfg.JenkinsUser, cfg.JenkinsToken)
-	return &Client{
-		jenkins: jenkins,
+// jobSegments 拆分 Job 全名：文件夹以 / 分隔，如 team-a/service-x；
+// 多分支流水线的分支 Job 名按 Jenkins 显示的形式填写，分支名中的 / 为 %2F，如 service-x/feature%2Fabc
+func jobSegments(fullName string) []string {
+	var segments []string
+	for _, s := range strings.Split(fullName, "/") {
+		if s = strings.TrimSpace(s); s != "" {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+// jobPath 返回 Job 的 URL 路径，如 /job/team-a/job/service-x，每段按 URL 转义（%2F 转为 %252F）
+func jobPath(fullName string) string {
+	segments := jobSegments(fullName)
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return "/job/" + strings.Join(segments, "/job/")
+}
+
+// getJob 按 Job 全名获取 Job，支持文件夹和多分支流水线
+func (c *Client) getJob(ctx context.Context, fullName string) (*gojenkins.Job, error) {
+	segments := jobSegments(fullName)
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("job name is empty")
+	}
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
 	}
+	last := len(segments) - 1
+	return c.jenkins.GetJob(ctx, segments[last], segments[:last]...)
+}
+
+// getBuild 获取 Job 的指定构建
+// gojenkins 的 Job.GetBuild 使用解码后的 Job URL，分支名中的 %2F 会丢失，这里沿用 Job 的已转义路径
+func (c *Client) getBuild(ctx context.Context, job *gojenkins.Job, number int64) (*gojenkins.Build, error) {
+	build := &gojenkins.Build{
+		Jenkins: c.jenkins,
+		Job:     job,
+		Raw:     new(gojenkins.BuildResponse),
+		Depth:   1,
+		Base:    job.Base + "/" + strconv.FormatInt(number, 10),
+	}
+	status, err := build.Poll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("jenkins returned status code: %d", status)
+	}
+	return build, nil
 }
 
 // BuildRequest 结构体定义
 type BuildRequest struct {
-	JobName      string `json:"job_name"`
+	JobName      string `json:"job_name"` // Job 全名，支持文件夹和多分支流水线，见 jobSegments
 	Branch       string `json:"branch"`
 	DeployType   string `json:"deploy_type"`
 	ImageVersion string `json:"image_version"`
+	GrayPercent  int    `json:"gray_percent,omitempty"` // 分阶段灰度的流量百分比，0 表示不传 GRAY_PERCENT
+
+	// Params 额外的构建参数（来自动作注册表），不覆盖上面的固定参数
+	Params map[string]string `json:"params,omitempty"`
 }
 
 // BuildHandler 函数
@@ -100,17 +178,17 @@ func (c *Client) Build(ctx context.Context, req BuildRequest) (int64, error) {
 	defer cancel()
 
 	// 获取指定 Job 的信息
-	job, err := jenkins.GetJob(ctx, req.JobName)
+	job, err := c.getJob(ctx, req.JobName)
 	if err != nil {
 		log.Printf("无法获取 Job '%s': %v", req.JobName, err)
 		return 0, err
 	}
 
-	// 为指定 Job 和分支构建
-	params := map[string]string{
-		"BRANCH":        req.Branch,
-		"DEPLOY_TYPE":   req.DeployType,
-		"IMAGE_VERSION": req.ImageVersion,
+	// 为指定 Job 和分支构建，参数与 Job 定义不匹配时拒绝触发
+	params, err := c.ValidateBuild(ctx, req)
+	if err != nil {
+		log.Printf("Job '%s' 的构建参数校验失败: %v", req.JobName, err)
+		return 0, err
 	}
 
 	var invokeErr error
@@ -179,11 +257,12 @@ func (c *Client) Build(ctx context.Context, req BuildRequest) (int64, error) {
 
 						queue, err := jenkins.GetQueue(ctx)
 						if err == nil {
-							// 遍历队列寻找匹配 JobName 的任务
+							// 遍历队列寻找匹配 JobName 的任务（文件夹中的 Job 按 URL 匹配）
 							// 注意：这里可能有多条，我们取最新的一条（ID 最大的）
 							var foundID int64
+							path := jobPath(req.JobName)
 							for _, item := range queue.Raw.Items {
-								if item.Task.Name == req.JobName {
+								if item.Task.Name == req.JobName || strings.HasSuffix(strings.TrimRight(item.Task.URL, "/"), path) {
 									if item.ID > foundID {
 										foundID = item.ID
 									}
@@ -289,15 +368,94 @@ func (c *Client) WaitForBuildToStart(ctx context.Context, queueID int64) (int64,
 // buildNumber: 构建号
 // 返回值: 构建信息结构体指针和错误信息
 func (c *Client) GetJobBuildInfo(ctx context.Context, jobName string, buildNumber int) (*gojenkins.Build, error) {
-	job, err := c.jenkins.GetJob(ctx, jobName)
+	job, err := c.getJob(ctx, jobName)
 	if err != nil {
 		return nil, err
 	}
 
-	build, err := job.GetBuild(ctx, int64(buildNumber))
+	build, err := c.getBuild(ctx, job, int64(buildNumber))
 	if err != nil {
 		return nil, err
 	}
 
 	return build, nil
 }
+
+// BuildSummary 构建历史摘要（用于回滚版本选择等场景）
+type BuildSummary struct {
+	Number       int64     `json:"number"`
+	Result       string    `json:"result"`
+	Branch       string    `json:"branch"`
+	DeployType   string    `json:"deploy_type"`
+	ImageVersion string    `json:"image_version"`
+	Timestamp    time.Time `json:"timestamp"`
+	DurationMs   int64     `json:"duration_ms"`
+}
+
+// GetRecentSuccessfulBuilds 获取 Job 最近 limit 个成功且带有 IMAGE_VERSION 的构建（按构建号倒序）
+// 回滚和重启构建不会产生新镜像，因此被排除
+func (c *Client) GetRecentSuccessfulBuilds(ctx context.Context, jobName string, limit int) ([]BuildSummary, error) {
+	job, err := c.getJob(ctx, jobName)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Builds []struct {
+			Number    int64  `json:"number"`
+			Result    string `json:"result"`
+			Timestamp int64  `json:"timestamp"`
+			Duration  int64  `json:"duration"`
+			Actions   []struct {
+				Parameters []struct {
+					Name  string      `json:"name"`
+					Value interface{} `json:"value"`
+				} `json:"parameters"`
+			} `json:"actions"`
+		} `json:"builds"`
+	}
+	// 只扫描最近 50 次构建，避免拉取完整历史
+	query := map[string]string{
+		"tree": "builds[number,result,timestamp,duration,actions[parameters[name,value]]]{0,50}",
+	}
+	if _, err := c.jenkins.Requester.GetJSON(ctx, job.Base, &resp, query); err != nil {
+		return nil, err
+	}
+
+	summaries := make([]BuildSummary, 0, limit)
+	for _, b := range resp.Builds {
+		if len(summaries) >= limit {
+			break
+		}
+		if b.Result != "SUCCESS" {
+			continue
+		}
+
+		summary := BuildSummary{
+			Number:     b.Number,
+			Result:     b.Result,
+			Timestamp:  time.UnixMilli(b.Timestamp),
+			DurationMs: b.Duration,
+		}
+		for _, a := range b.Actions {
+			for _, p := range a.Parameters {
+				value, _ := p.Value.(string)
+				switch p.Name {
+				case "BRANCH":
+					summary.Branch = value
+				case "DEPLOY_TYPE":
+					summary.DeployType = value
+				case "IMAGE_VERSION":
+					summary.ImageVersion = value
+				}
+			}
+		}
+
+		if summary.ImageVersion == "" || summary.DeployType == "Rollback" || summary.DeployType == "Restart" {
+			continue
+		}
+		summaries = append(summaries, summary)
+	}
+
+	return summaries, nil
+}
@@ -15,7 +15,7 @@ var (
 			Name: "jenkins_job_status",
 			Help: "Jenkins Job状态 (0=失败, 1=成功, 2=构建中, 3=未知)",
 		},
-		[]string{"job_name", "branch", "deploy_type", "image_version"},
+		[]string{"instance", "job_name", "branch", "deploy_type", "image_version"},
 	)
 
 	buildDuration = prometheus.NewGaugeVec(
@@ -23,7 +23,7 @@ var (
 			Name: "jenkins_build_duration_seconds",
 			Help: "构建持续时间（秒）",
 		},
-		[]string{"job_name", "build_number", "branch", "deploy_type", "image_version"},
+		[]string{"instance", "job_name", "build_number", "branch", "deploy_type", "image_version"},
 	)
 
 	buildTimestamp = prometheus.NewGaugeVec(
@@ -31,7 +31,7 @@ var (
 			Name: "jenkins_build_timestamp",
 			Help: "构建时间戳",
 		},
-		[]string{"job_name", "build_number", "branch", "deploy_type", "image_version"},
+		[]string{"instance", "job_name", "build_number", "branch", "deploy_type", "image_version"},
 	)
 )
 
@@ -41,7 +41,8 @@ func init() {
 	prometheus.MustRegister(buildTimestamp)
 }
 
-func UpdateMetrics(jobName string, build *gojenkins.Build) {
+// UpdateMetrics 按 Jenkins 实例和 Job 更新构建指标
+func UpdateMetrics(instance, jobName string, build *gojenkins.Build) {
 	// Extract parameters
 	var branch, deployType, imageVersion string
 	for _, p := range build.GetParameters() {
@@ -72,13 +73,13 @@ func UpdateMetrics(jobName string, build *gojenkins.Build) {
 		statusValue = 3
 	}
 
-	jobStatus.WithLabelValues(jobName, branch, deployType, imageVersion).Set(statusValue)
+	jobStatus.WithLabelValues(instance, jobName, branch, deployType, imageVersion).Set(statusValue)
 
 	// 更新持续时间指标
-	buildDuration.WithLabelValues(jobName, fmt.Sprintf("%d", build.GetBuildNumber()), branch, deployType, imageVersion).Set(float64(build.Raw.Duration) / 1000)
+	buildDuration.WithLabelValues(instance, jobName, fmt.Sprintf("%d", build.GetBuildNumber()), branch, deployType, imageVersion).Set(float64(build.Raw.Duration) / 1000)
 
 	// 更新时间戳指标
-	buildTimestamp.WithLabelValues(jobName, fmt.Sprintf("%d", build.GetBuildNumber()), branch, deployType, imageVersion).Set(float64(build.Raw.Timestamp) / 1000)
+	buildTimestamp.WithLabelValues(instance, jobName, fmt.Sprintf("%d", build.GetBuildNumber()), branch, deployType, imageVersion).Set(float64(build.Raw.Timestamp) / 1000)
 }
 
 // MonitorBuildUntilCompletion 监控特定构建直到完成
@@ -95,17 +96,17 @@ func (jc *Client) MonitorBuildUntilCompletion(ctx context.Context, jobName strin
 			// 获取构建信息
 			// 注意：这里我们使用 Client 的 GetJobBuildInfo 方法或者直接通过 gojenkins 获取
 			// 为了方便，直接获取
-			job, err := jc.jenkins.GetJob(ctx, jobName)
+			job, err := jc.getJob(ctx, jobName)
 			if err != nil {
 				continue
 			}
-			build, err := job.GetBuild(ctx, buildNumber)
+			build, err := jc.getBuild(ctx, job, buildNumber)
 			if err != nil {
 				continue
 			}
 
 			// 更新指标
-			UpdateMetrics(jobName, build)
+			UpdateMetrics(jc.instance, jobName, build)
 
 			// 检查构建是否完成
 			if !build.IsRunning(ctx) {
@@ -2,8 +2,16 @@ package jenkins
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/bndr/gojenkins"
 )
 
 func TestJenkinsClient(t *testing.T) {
@@ -53,3 +61,159 @@ func TestJenkinsClient(t *testing.T) {
 		}
 	})
 }
+
+func TestGetRecentSuccessfulBuilds(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/job/service-a/api/json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("tree") == "" {
+			// GetJob 轮询
+			fmt.Fprint(w, `{"name":"service-a"}`)
+			return
+		}
+		fmt.Fprint(w, `{"builds":[
+			{"number":12,"result":"FAILURE","timestamp":1700000400000,"actions":[{"parameters":[{"name":"IMAGE_VERSION","value":"v12"}]}]},
+			{"number":11,"result":"SUCCESS","timestamp":1700000300000,"actions":[{"parameters":[{"name":"DEPLOY_TYPE","value":"Rollback"},{"name":"IMAGE_VERSION","value":"v9"}]}]},
+			{"number":10,"result":"SUCCESS","timestamp":1700000200000,"duration":61000,"actions":[{},{"parameters":[{"name":"BRANCH","value":"master"},{"name":"DEPLOY_TYPE","value":"Deploy"},{"name":"IMAGE_VERSION","value":"v10"}]}]},
+			{"number":9,"result":"SUCCESS","timestamp":1700000100000,"actions":[{"parameters":[{"name":"BRANCH","value":"release/1.0"},{"name":"DEPLOY_TYPE","value":"Gray"},{"name":"IMAGE_VERSION","value":"v9"}]}]},
+			{"number":8,"result":"SUCCESS","timestamp":1700000000000,"actions":[{"parameters":[{"name":"IMAGE_VERSION","value":"v8"}]}]}
+		]}`)
+	}))
+	defer srv.Close()
+
+	client := &Client{jenkins: gojenkins.CreateJenkins(srv.Client(), srv.URL)}
+	builds, err := client.GetRecentSuccessfulBuilds(context.Background(), "service-a", 2)
+	if err != nil {
+		t.Fatalf("GetRecentSuccessfulBuilds() returned error: %v", err)
+	}
+	if len(builds) != 2 {
+		t.Fatalf("expected 2 builds, got %d: %+v", len(builds), builds)
+	}
+	if builds[0].Number != 10 || builds[0].ImageVersion != "v10" || builds[0].Branch != "master" || builds[0].DurationMs != 61000 {
+		t.Errorf("unexpected first build: %+v", builds[0])
+	}
+	if builds[1].Number != 9 || builds[1].Branch != "release/1.0" {
+		t.Errorf("unexpected second build: %+v", builds[1])
+	}
+}
+
+func TestFolderAndMultibranchJobs(t *testing.T) {
+	if got := jobPath("team-a/service-x"); got != "/job/team-a/job/service-x" {
+		t.Errorf("unexpected folder job path: %s", got)
+	}
+	if got := jobPath("service-x/feature%2Fabc"); got != "/job/service-x/job/feature%252Fabc" {
+		t.Errorf("unexpected branch job path: %s", got)
+	}
+
+	// 只响应转义正确的路径
+	jobs := map[string]bool{
+		"/job/team-a/job/service-x":          true,
+		"/job/service-x/job/feature%252Fabc": true,
+	}
+	var triggered []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.EscapedPath()
+		w.Header().Set("Content-Type", "application/json")
+		for job := range jobs {
+			switch path {
+			case job + "/api/json":
+				fmt.Fprint(w, `{"name":"job","property":[{"parameterDefinitions":[{"name":"BRANCH","type":"StringParameterDefinition"},{"name":"DEPLOY_TYPE","type":"ChoiceParameterDefinition","choices":["Deploy","Gray"]}]}]}`)
+				return
+			case job + "/build":
+				triggered = append(triggered, job)
+				w.Header().Set("Location", "http://"+r.Host+"/queue/item/42/")
+				w.WriteHeader(http.StatusCreated)
+				return
+			case job + "/7/api/json":
+				fmt.Fprint(w, `{"number":7,"result":"SUCCESS","building":false}`)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	client := &Client{jenkins: gojenkins.CreateJenkins(srv.Client(), srv.URL)}
+	for _, name := range []string{"team-a/service-x", "service-x/feature%2Fabc"} {
+		t.Run(name, func(t *testing.T) {
+			queueID, err := client.Build(context.Background(), BuildRequest{JobName: name, Branch: "master", DeployType: "Deploy"})
+			if err != nil || queueID != 42 {
+				t.Fatalf("Build() = %d, %v", queueID, err)
+			}
+			build, err := client.GetJobBuildInfo(context.Background(), name, 7)
+			if err != nil || build.GetResult() != "SUCCESS" {
+				t.Fatalf("GetJobBuildInfo() = %v, %v", build, err)
+			}
+		})
+	}
+	if len(triggered) != 2 {
+		t.Errorf("expected both jobs to be triggered, got %v", triggered)
+	}
+}
+
+func TestValidateBuild(t *testing.T) {
+	definitions := `{"property":[{},{"parameterDefinitions":[
+		{"name":"BRANCH","type":"StringParameterDefinition"},
+		{"name":"deploy_type","type":"ChoiceParameterDefinition","choices":["Deploy","Gray","Rollback"]},
+		{"name":"IMAGE_VERSION","type":"StringParameterDefinition"},
+		{"name":"NOTIFY","type":"BooleanParameterDefinition"}
+	]}]}`
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/job/service-a/api/json" {
+			http.NotFound(w, r)
+			return
+		}
+		fetches++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, definitions)
+	}))
+	defer srv.Close()
+
+	client := &Client{jenkins: gojenkins.CreateJenkins(srv.Client(), srv.URL), paramTTL: time.Minute}
+	ctx := context.Background()
+
+	t.Run("map names and choices", func(t *testing.T) {
+		params, err := client.ValidateBuild(ctx, BuildRequest{JobName: "service-a", Branch: "master", DeployType: "gray", Params: map[string]string{"NOTIFY": "true"}})
+		if err != nil {
+			t.Fatalf("ValidateBuild() returned error: %v", err)
+		}
+		// 空的 IMAGE_VERSION 按定义原样传递，选项值映射为 Job 定义的写法
+		want := map[string]string{"BRANCH": "master", "deploy_type": "Gray", "IMAGE_VERSION": "", "NOTIFY": "true"}
+		if fmt.Sprint(params) != fmt.Sprint(want) {
+			t.Errorf("ValidateBuild() = %v, want %v", params, want)
+		}
+		if fetches != 1 {
+			t.Errorf("expected 1 fetch, got %d", fetches)
+		}
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		fetches = 0
+		_, err := client.ValidateBuild(ctx, BuildRequest{JobName: "service-a", DeployType: "Restart", GrayPercent: 5, Params: map[string]string{"NOTIFY": "yes"}})
+		var mismatch *ParamMismatchError
+		if !errors.As(err, &mismatch) {
+			t.Fatalf("expected ParamMismatchError, got %v", err)
+		}
+		want := []string{"deploy_type=Restart is not one of [Deploy, Gray, Rollback]", "GRAY_PERCENT is not defined", "NOTIFY=yes is not a boolean"}
+		if fmt.Sprint(mismatch.Problems) != fmt.Sprint(want) {
+			t.Errorf("unexpected problems: %v", mismatch.Problems)
+		}
+		// 缓存的定义校验失败时重新获取一次
+		if fetches != 1 {
+			t.Errorf("expected definitions to be refetched once, got %d", fetches)
+		}
+	})
+
+	t.Run("build refuses mismatch", func(t *testing.T) {
+		definitions = `{"property":[{"parameterDefinitions":[{"name":"BRANCH","type":"StringParameterDefinition"}]}]}`
+		client.forgetParams("service-a")
+		// Job 未定义 DEPLOY_TYPE 时拒绝触发，不访问 /build
+		if _, err := client.Build(ctx, BuildRequest{JobName: "service-a", Branch: "master", DeployType: "Deploy"}); err == nil || !strings.Contains(err.Error(), "DEPLOY_TYPE is not defined") {
+			t.Errorf("expected Build to refuse, got %v", err)
+		}
+	})
+}
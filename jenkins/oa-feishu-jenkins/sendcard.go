@@ -3,12 +3,12 @@ package oafeishujenkins
 import (
 	"context"
 	c "devops/feishu/config"
+	"devops/feishu/pkg/action"
 	feishu "devops/feishu/pkg/feishu"
 	h "devops/feishu/pkg/handler"
 	oajenkins "devops/jenkins/oa-jenkins"
 	"encoding/json"
 	"fmt"
-	"strings"
 	"time"
 )
 
@@ -43,7 +43,7 @@ func SendCard(ctx context.Context, receive_id, receive_id_type string, jobs []*o
 			Name:     job.JobName,
 			ObjectID: job.JobName,
 			Branches: []string{job.JobBranch},
-			Actions:  []string{"check", "gray", "official"},
+			Actions:  []string{action.Check, action.Gray, action.Official},
 		})
 	}
 	req.CardData.Services = services
@@ -53,49 +53,7 @@ func SendCard(ctx context.Context, receive_id, receive_id_type string, jobs []*o
 
 	// 1. 动态构建卡片内容 (V1 Message Card)
 	// 检查是否包含灰度服务，如果包含，则过滤显示
-	displayCardData := req.CardData
-	hasGray := false
-	for _, s := range req.CardData.Services {
-		for _, a := range s.Actions {
-			if strings.EqualFold(a, "gray") || a == "灰度" {
-				hasGray = true
-				break
-			}
-		}
-		if hasGray {
-			break
-		}
-	}
-
-	if hasGray {
-		// 灰度模式：只显示灰度服务，且只显示灰度按钮（或非正式按钮）
-		var filteredServices []h.Service
-		for _, s := range req.CardData.Services {
-			hasGrayAction := false
-			for _, a := range s.Actions {
-				if strings.EqualFold(a, "gray") || a == "灰度" {
-					hasGrayAction = true
-					break
-				}
-			}
-
-			if hasGrayAction {
-				// 复制服务并过滤动作
-				newService := s
-				newActions := []string{}
-				for _, a := range s.Actions {
-					// 过滤掉正式发布按钮
-					if strings.EqualFold(a, "official") || strings.EqualFold(a, "release") || a == "正式" {
-						continue
-					}
-					newActions = append(newActions, a)
-				}
-				newService.Actions = newActions
-				filteredServices = append(filteredServices, newService)
-			}
-		}
-		displayCardData.Services = filteredServices
-	}
+	displayCardData := h.GrayView(req.CardData)
 
 	cardContent := h.BuildCard(displayCardData, requestID, nil, nil)
 	// 2. 序列化为 JSON 字符串
@@ -3,6 +3,7 @@ package oajenkins
 import (
 	"context"
 	"devops/feishu/config"
+	"devops/feishu/pkg/action"
 	"devops/feishu/pkg/feishu"
 	"devops/feishu/pkg/feishu/groupchat"
 	"devops/feishu/pkg/handler"
@@ -90,6 +91,7 @@ func (h *JKServer) UpdateFeishuToken(c *gin.Context) {
 type TestFlowRequest struct {
 	ReceiveID     string `json:"receive_id"`      // 接收通知的用户ID/群ID
 	ReceiveIDType string `json:"receive_id_type"` // ID类型: open_id, chat_id, etc.
+	DryRun        bool   `json:"dry_run"`         // 演练模式：卡片流程照常执行，构建由模拟替代
 }
 
 func (h *JKServer) TestFlow(c *gin.Context) {
@@ -107,14 +109,14 @@ func (h *JKServer) TestFlow(c *gin.Context) {
 	// 异步执行完整流程模拟
 	go func() {
 		ctx := context.Background()
-		h.simulateOAFlow(ctx, req.ReceiveID, req.ReceiveIDType)
+		h.simulateOAFlow(ctx, req.ReceiveID, req.ReceiveIDType, req.DryRun)
 	}()
 
 	c.JSON(http.StatusOK, gin.H{"message": "Test flow started"})
 }
 
 // simulateOAFlow 模拟 OA 推送 -> 生成卡片 -> 发送卡片 的流程
-func (h *JKServer) simulateOAFlow(ctx context.Context, receiveID, receiveIDType string) {
+func (h *JKServer) simulateOAFlow(ctx context.Context, receiveID, receiveIDType string, dryRun bool) {
 	// 1. 获取 OA 数据
 	oaData, err := GetLatestJson()
 	if err != nil {
@@ -122,27 +124,41 @@ func (h *JKServer) simulateOAFlow(ctx context.Context, receiveID, receiveIDType
 		return
 	}
 
-	if err := h.processOARequest(ctx, oaData, receiveID, receiveIDType); err != nil {
+	if err := h.processOARequest(ctx, oaData, receiveID, receiveIDType, dryRun); err != nil {
 		fmt.Printf("processOARequest failed: %v\n", err)
 	}
 }
 
-func (h *JKServer) processOARequest(ctx context.Context, oaData map[string]interface{}, receiveID, receiveIDType string) error {
+// processOARequest 解析 OA 数据、建群并发送发布卡片；dryRun 或全局 DRY_RUN 开启时以演练模式发送
+func (h *JKServer) processOARequest(ctx context.Context, oaData map[string]interface{}, receiveID, receiveIDType string, dryRun bool) error {
+	if c, _ := config.LoadConfig(); c != nil && c.DryRun {
+		dryRun = true
+	}
+	// 演练模式下所有消息标注「演练」
+	var label string
+	if dryRun {
+		label = handler.DryRunLabel
+	}
+	notify := func(receiveID, receiveIDType, content string) {
+		h.sendFeishuMessage(ctx, receiveID, receiveIDType, label+content)
+	}
+
 	logReceiveID := receiveID
 	logReceiveIDType := receiveIDType
 	cardReceiveID := receiveID
 	cardReceiveIDType := receiveIDType
+	var initiatorID string // 发起人的飞书 user_id，构建结果通知中 @ 提醒
 
 	// 2. 解析 OA 数据
 	dummy := &JenkinsJob{}
 	jobs, err := dummy.HandleLatestJson(oaData)
 	if err != nil {
-		h.sendFeishuMessage(ctx, logReceiveID, logReceiveIDType, fmt.Sprintf("❌ 解析 OA 数据失败: %v", err))
+		notify(logReceiveID, logReceiveIDType, fmt.Sprintf("❌ 解析 OA 数据失败: %v", err))
 		return err
 	}
 
 	if len(jobs) == 0 {
-		h.sendFeishuMessage(ctx, logReceiveID, logReceiveIDType, "⚠️ OA 数据中没有找到 Job")
+		notify(logReceiveID, logReceiveIDType, "⚠️ OA 数据中没有找到 Job")
 		return nil
 	}
 
@@ -166,25 +182,26 @@ func (h *JKServer) processOARequest(ctx context.Context, oaData map[string]inter
 
 		fmt.Printf("SimulateOAFlow: Found initiator '%s'\n", initiatorName)
 		if logReceiveID != "" {
-			h.sendFeishuMessage(ctx, logReceiveID, logReceiveIDType, fmt.Sprintf("🔍 正在查找发起人: %s", initiatorName))
+			notify(logReceiveID, logReceiveIDType, fmt.Sprintf("🔍 正在查找发起人: %s", initiatorName))
 		}
 
 		userID, err := h.groupChatClient.GetUserIDByUsername(ctx, initiatorName)
 		if err != nil {
 			fmt.Printf("SimulateOAFlow: Failed to find user ID for '%s': %v\n", initiatorName, err)
 			if logReceiveID != "" {
-				h.sendFeishuMessage(ctx, logReceiveID, logReceiveIDType, fmt.Sprintf("⚠️ 无法找到发起人 '%s' 的 ID: %v", initiatorName, err))
+				notify(logReceiveID, logReceiveIDType, fmt.Sprintf("⚠️ 无法找到发起人 '%s' 的 ID: %v", initiatorName, err))
 			}
 		} else {
 			fmt.Printf("SimulateOAFlow: Found UserID '%s' for '%s'\n", userID, initiatorName)
 			cardReceiveID = userID
 			cardReceiveIDType = "user_id"
+			initiatorID = userID
 
 			reqName := jobs[0].RequestName
 			if reqName == "" {
 				reqName = "OA Release"
 			}
-			groupName := fmt.Sprintf("🚀 发布群 - %s", reqName)
+			groupName := fmt.Sprintf("%s🚀 发布群 - %s", label, reqName)
 			desc := fmt.Sprintf("OA发布申请: %s\n发起人: %s", reqName, initiatorName)
 
 			// 尝试在群里查找已存在的群
@@ -211,13 +228,13 @@ func (h *JKServer) processOARequest(ctx context.Context, oaData map[string]inter
 			if err != nil {
 				fmt.Printf("SimulateOAFlow: Failed to create group: %v\n", err)
 				if logReceiveID != "" {
-					h.sendFeishuMessage(ctx, logReceiveID, logReceiveIDType, fmt.Sprintf("❌ 创建群失败: %v", err))
+					notify(logReceiveID, logReceiveIDType, fmt.Sprintf("❌ 创建群失败: %v", err))
 				}
 			} else {
 				fmt.Printf("SimulateOAFlow: Group created successfully. ChatID: %s\n", chatID)
 				cardReceiveID = chatID
 				cardReceiveIDType = "chat_id"
-				h.sendFeishuMessage(ctx, chatID, "chat_id", fmt.Sprintf("✅ 群已创建，欢迎 %s", initiatorName))
+				notify(chatID, "chat_id", fmt.Sprintf("✅ 群已创建，欢迎 %s", initiatorName))
 			}
 		}
 	} else {
@@ -244,7 +261,7 @@ func (h *JKServer) processOARequest(ctx context.Context, oaData map[string]inter
 		// 如果没有特别标识，默认为 "release" (正式发布)
 		// 如果需要灰度，必须在 Job 信息或配置中有所体现，这里为了测试，我们简单地默认只给 release
 		// 除非你需要测试灰度流程，可以手动修改这里
-		actions := []string{"gray", "rollback", "restart"}
+		actions := []string{action.Gray, action.Rollback, action.Restart}
 
 		// 示例：如果 Job 名称包含 "gray"，则添加灰度动作
 		// if strings.Contains(job.JobName, "gray") {
@@ -265,6 +282,8 @@ func (h *JKServer) processOARequest(ctx context.Context, oaData map[string]inter
 		Services:      services,
 		ReceiveID:     cardReceiveID,
 		ReceiveIDType: cardReceiveIDType,
+		Initiator:     initiatorID,
+		DryRun:        dryRun,
 	}
 
 	// 4. 保存到 GlobalStore (这一步对于回调处理是必须的)
@@ -283,14 +302,14 @@ func (h *JKServer) processOARequest(ctx context.Context, oaData map[string]inter
 
 	err = h.feishuClient.SendMessage(ctx, cardReceiveID, cardReceiveIDType, "interactive", string(cardBytes))
 	if err != nil {
-		h.sendFeishuMessage(ctx, logReceiveID, logReceiveIDType, fmt.Sprintf("❌ 发送卡片失败: %v", err))
+		notify(logReceiveID, logReceiveIDType, fmt.Sprintf("❌ 发送卡片失败: %v", err))
 		// 如果发送失败，返回 nil 以防止无限重试（特别是在群已解散等不可恢复的场景下）。
 		// 这样会标记请求为 processed，停止骚扰用户。
 		fmt.Printf("Error sending card: %v. Marking as processed to avoid loops.\n", err)
 		return nil
 	}
 
-	h.sendFeishuMessage(ctx, logReceiveID, logReceiveIDType, "✅ 卡片已发送，请点击卡片按钮测试 Jenkins 触发")
+	notify(logReceiveID, logReceiveIDType, "✅ 卡片已发送，请点击卡片按钮测试 Jenkins 触发")
 	// 如果发送成功，返回 nil 以触发重试机制。
 
 	return nil
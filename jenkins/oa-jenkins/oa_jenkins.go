@@ -4,6 +4,7 @@ import (
 	oa "devops/oa/pkg/handler"
 	"encoding/json"
 	"fmt"
+	"html"
 	"math"
 	"strconv"
 	"strings"
@@ -246,6 +247,8 @@ func (j *JenkinsJob) HandleLatestJson(jsonData map[string]interface{}) ([]*Jenki
 
 		// Replace &nbsp; with space
 		project = strings.ReplaceAll(project, "&nbsp;", " ")
+		// OA 富文本会转义特殊字符，如文件夹路径中的 / 为 &#47;
+		project = html.UnescapeString(project)
 
 		// 提取项目名称和分支
 		parts := strings.Fields(project)
@@ -254,6 +257,7 @@ func (j *JenkinsJob) HandleLatestJson(jsonData map[string]interface{}) ([]*Jenki
 			continue
 		}
 
+		// 项目名即 Jenkins Job 全名，可以是文件夹路径（team-a/service-x）或多分支流水线的分支 Job（service-x/feature%2Fabc）
 		projectName := parts[0]
 		branch := parts[1]
 		oa.Logger.Info("Project Name: %s, Branch: %s, Initiator: %s", projectName, branch, initiator)
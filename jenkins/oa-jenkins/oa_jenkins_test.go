@@ -59,3 +59,18 @@ func TestGetLatestJson(t *testing.T) {
 
 	})
 }
+
+func TestHandleLatestJsonJobPaths(t *testing.T) {
+	jobs, err := (&JenkinsJob{}).HandleLatestJson(map[string]interface{}{
+		"fwm": "team-a&#47;service-x&nbsp;master<br>service-y/feature%2Fabc master",
+	})
+	if err != nil {
+		t.Fatalf("HandleLatestJson failed: %v", err)
+	}
+	if len(jobs) != 2 || jobs[0].JobName != "team-a/service-x" || jobs[1].JobName != "service-y/feature%2Fabc" {
+		for _, j := range jobs {
+			t.Logf("job: %+v", j)
+		}
+		t.Fatalf("Expected folder and branch job paths, got %d jobs", len(jobs))
+	}
+}
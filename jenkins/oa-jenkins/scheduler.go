@@ -76,7 +76,7 @@ func (h *JKServer) checkOAData(ctx context.Context) {
 		fmt.Printf("Scheduler: Processing request %s...\n", id)
 
 		// 触发流程
-		err := h.processOARequest(ctx, req, "", "")
+		err := h.processOARequest(ctx, req, "", "", false)
 		if err != nil {
 			fmt.Printf("Scheduler: Failed to process request %s: %v\n", id, err)
 			// Continue to next request. This one remains unprocessed in DB.
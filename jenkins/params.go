@@ -0,0 +1,199 @@
+package jenkins
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParamDefinition Job 的参数定义
+type ParamDefinition struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`              // 如 StringParameterDefinition / ChoiceParameterDefinition / BooleanParameterDefinition
+	Choices []string `json:"choices,omitempty"` // 选项参数的可选值
+}
+
+// ParamMismatchError 构建参数与 Job 的参数定义不匹配
+type ParamMismatchError struct {
+	JobName  string
+	Problems []string
+}
+
+func (e *ParamMismatchError) Error() string {
+	return fmt.Sprintf("job %s parameters mismatch: %s", e.JobName, strings.Join(e.Problems, "; "))
+}
+
+// paramCacheEntry 缓存的 Job 参数定义
+type paramCacheEntry struct {
+	defs      []ParamDefinition
+	fetchedAt time.Time
+}
+
+// parameters 返回请求要传给 Jenkins 的参数，Params 不覆盖固定参数
+func (req BuildRequest) parameters() map[string]string {
+	params := map[string]string{
+		"BRANCH":        req.Branch,
+		"DEPLOY_TYPE":   req.DeployType,
+		"IMAGE_VERSION": req.ImageVersion,
+	}
+	if req.GrayPercent > 0 {
+		params["GRAY_PERCENT"] = strconv.Itoa(req.GrayPercent)
+	}
+	for k, v := range req.Params {
+		if _, ok := params[k]; !ok {
+			params[k] = v
+		}
+	}
+	return params
+}
+
+// ValidateBuild 按 Job 的参数定义校验并映射构建参数，返回实际传给 Jenkins 的参数
+// 不匹配时返回 *ParamMismatchError；使用缓存的定义校验失败时重新获取一次，以免 Job 刚修改过参数
+func (c *Client) ValidateBuild(ctx context.Context, req BuildRequest) (map[string]string, error) {
+	defs, cached, err := c.paramDefinitions(ctx, req.JobName)
+	if err != nil {
+		return nil, err
+	}
+	params, err := mapParams(req.JobName, defs, req.parameters())
+	if err != nil && cached {
+		c.forgetParams(req.JobName)
+		if defs, _, fetchErr := c.paramDefinitions(ctx, req.JobName); fetchErr == nil {
+			params, err = mapParams(req.JobName, defs, req.parameters())
+		}
+	}
+	return params, err
+}
+
+// paramDefinitions 返回 Job 的参数定义，缓存未过期时直接使用缓存，第二个返回值表示是否来自缓存
+func (c *Client) paramDefinitions(ctx context.Context, jobName string) ([]ParamDefinition, bool, error) {
+	c.paramMu.Lock()
+	entry, ok := c.paramCache[jobName]
+	c.paramMu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < c.paramTTL {
+		return entry.defs, true, nil
+	}
+
+	defs, err := c.fetchParamDefinitions(ctx, jobName)
+	if err != nil {
+		return nil, false, err
+	}
+	if c.paramTTL > 0 {
+		c.paramMu.Lock()
+		if c.paramCache == nil {
+			c.paramCache = make(map[string]paramCacheEntry)
+		}
+		c.paramCache[jobName] = paramCacheEntry{defs: defs, fetchedAt: time.Now()}
+		c.paramMu.Unlock()
+	}
+	return defs, false, nil
+}
+
+// forgetParams 清除 Job 缓存的参数定义
+func (c *Client) forgetParams(jobName string) {
+	c.paramMu.Lock()
+	delete(c.paramCache, jobName)
+	c.paramMu.Unlock()
+}
+
+// fetchParamDefinitions 从 Jenkins 获取 Job 的参数定义，Job 不是参数化构建时返回空
+func (c *Client) fetchParamDefinitions(ctx context.Context, jobName string) ([]ParamDefinition, error) {
+	if len(jobSegments(jobName)) == 0 {
+		return nil, fmt.Errorf("job name is empty")
+	}
+	var resp struct {
+		Property []struct {
+			ParameterDefinitions []ParamDefinition `json:"parameterDefinitions"`
+		} `json:"property"`
+	}
+	query := map[string]string{"tree": "property[parameterDefinitions[name,type,choices]]"}
+	r, err := c.jenkins.Requester.GetJSON(ctx, jobPath(jobName), &resp, query)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jenkins returned status code: %d", r.StatusCode)
+	}
+
+	var defs []ParamDefinition
+	for _, p := range resp.Property {
+		defs = append(defs, p.ParameterDefinitions...)
+	}
+	return defs, nil
+}
+
+// mapParams 将参数映射到 Job 定义的参数：
+//   - 参数名不区分大小写，按 Job 定义的名称传递
+//   - 选项参数的值必须是可选值之一（不区分大小写），布尔参数的值必须是 true / false
+//   - 空值且 Job 未定义（或为选项参数）时不传，由 Job 使用默认值；非空值 Job 未定义时视为不匹配
+func mapParams(jobName string, defs []ParamDefinition, params map[string]string) (map[string]string, error) {
+	byName := make(map[string]ParamDefinition, len(defs))
+	for _, d := range defs {
+		byName[strings.ToUpper(d.Name)] = d
+	}
+
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	mapped := make(map[string]string, len(params))
+	var problems []string
+	for _, name := range names {
+		value := params[name]
+		def, ok := byName[strings.ToUpper(name)]
+		if !ok {
+			if value != "" {
+				problems = append(problems, fmt.Sprintf("%s is not defined", name))
+			}
+			continue
+		}
+		// 大小写不同的同名参数只取第一个（固定参数为大写，排序在前）
+		if _, dup := mapped[def.Name]; dup {
+			continue
+		}
+
+		switch {
+		case def.Type == "ChoiceParameterDefinition" || len(def.Choices) > 0:
+			if value == "" {
+				continue
+			}
+			choice, ok := matchChoice(def.Choices, value)
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s=%s is not one of [%s]", def.Name, value, strings.Join(def.Choices, ", ")))
+				continue
+			}
+			value = choice
+		case def.Type == "BooleanParameterDefinition" && value != "":
+			if _, err := strconv.ParseBool(value); err != nil {
+				problems = append(problems, fmt.Sprintf("%s=%s is not a boolean", def.Name, value))
+				continue
+			}
+		}
+		mapped[def.Name] = value
+	}
+
+	if len(problems) > 0 {
+		return nil, &ParamMismatchError{JobName: jobName, Problems: problems}
+	}
+	return mapped, nil
+}
+
+// matchChoice 返回与值匹配的可选值，优先精确匹配
+func matchChoice(choices []string, value string) (string, bool) {
+	for _, choice := range choices {
+		if choice == value {
+			return choice, true
+		}
+	}
+	for _, choice := range choices {
+		if strings.EqualFold(choice, value) {
+			return choice, true
+		}
+	}
+	return "", false
+}
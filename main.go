@@ -10,11 +10,13 @@ import (
 	"time"
 
 	"devops/feishu/config"
+	"devops/feishu/pkg/action"
 	"devops/feishu/pkg/feishu"
 	_ "devops/feishu/pkg/handler"
 	_ "devops/feishu/pkg/reg"
 	_ "devops/feishu/pkg/robot/api"
 	_ "devops/feishu/pkg/robot/impl"
+	"devops/jenkins"
 	_ "devops/jenkins/oa-jenkins"
 
 	_ "devops/oa/pkg/handler"
@@ -37,12 +39,41 @@ func main() {
 	log := logger.NewLogger(cfg.LogLevel)
 	log.Info("Starting feishu message service...")
 
-	// 启动回调监听（长连接）
+	// 加载按项目配置的飞书应用（feishu_robots 表）
+	if err := feishu.Apps.LoadFromDB(cfg, cfg.GetDB()); err != nil {
+		log.Error("Failed to load Feishu apps: %v", err)
+	}
+
+	// 加载动作注册表：内置动作之外，先读配置文件，再读 feishu_actions 表
+	if err := action.Default.LoadFile(cfg.ActionRegistryFile); err != nil {
+		log.Error("Failed to load action registry file: %v", err)
+	}
+	if err := action.Default.LoadFromDB(cfg.GetDB()); err != nil {
+		log.Error("Failed to load actions from DB: %v", err)
+	}
+
+	// 加载 Jenkins 实例：JENKINS_URL 为默认实例，先读配置文件，再读 jenkins_instances 表
+	if err := jenkins.Instances.LoadFile(cfg.JenkinsInstancesFile); err != nil {
+		log.Error("Failed to load Jenkins instances file: %v", err)
+	}
+	if err := jenkins.Instances.LoadFromDB(cfg.GetDB()); err != nil {
+		log.Error("Failed to load Jenkins instances from DB: %v", err)
+	}
+
+	// 子命令（如 devops migrate import-requests）在加载动作注册表后执行，执行完即退出，不启动服务
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
+	// 启动回调监听（每个飞书应用一条长连接）
 	go func() {
 		log.Info("Starting Feishu WebSocket client...")
 		feishu.RegisterCallback(cfg)
 	}()
 
+	// 定期检查各 Jenkins 实例是否可用
+	jenkins.Instances.StartHealthCheck(context.Background(), cfg.JenkinsHealthInterval)
+
 	// 初始化 IOC 容器
 	if err := ioc.ConController.Init(); err != nil {
 		log.Fatal("Failed to init ioc: %v", err)
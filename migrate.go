@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"devops/feishu/pkg/handler"
+)
+
+const migrateUsage = `Usage:
+  devops migrate import-requests [-dry-run] <dir>    导入旧版文件存储的请求数据（req_*.json）
+`
+
+// runCommand 执行命令行子命令，返回进程退出码
+func runCommand(args []string) int {
+	if len(args) < 2 || args[0] != "migrate" {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	switch args[1] {
+	case "import-requests":
+		return importRequests(args[2:])
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+}
+
+// importRequests 导入旧版请求文件并打印报告，存在无效文件时返回非零退出码
+func importRequests(args []string) int {
+	fs := flag.NewFlagSet("import-requests", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "只校验并报告，不写入数据库")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	report, err := handler.GlobalStore.ImportRequests(fs.Arg(0), *dryRun)
+	if report != nil {
+		printImportReport(report, *dryRun)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Import failed: %v\n", err)
+		return 1
+	}
+	if len(report.Invalid) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func printImportReport(report *handler.ImportReport, dryRun bool) {
+	verb := "Imported"
+	if dryRun {
+		verb = "Would import"
+	}
+	for _, id := range report.Created {
+		fmt.Printf("created  %s\n", id)
+	}
+	for _, id := range report.Updated {
+		fmt.Printf("updated  %s\n", id)
+	}
+	for _, name := range sortedKeys(report.Skipped) {
+		fmt.Printf("skipped  %s: %s\n", name, report.Skipped[name])
+	}
+	for _, name := range sortedKeys(report.Invalid) {
+		fmt.Printf("invalid  %s: %s\n", name, report.Invalid[name])
+	}
+	fmt.Printf("%s %d requests (%d created, %d updated), %d skipped, %d invalid\n",
+		verb, len(report.Created)+len(report.Updated), len(report.Created), len(report.Updated),
+		len(report.Skipped), len(report.Invalid))
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}